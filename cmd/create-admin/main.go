@@ -0,0 +1,99 @@
+// Command create-admin creates an account for signing in to the admin API,
+// or with -update resets the password and role of an existing account and
+// lifts its lockout. The password is read from the ADMIN_PASSWORD variable
+// or, when it is not set, from the first line of standard input, so that it
+// does not end up in the shell history.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("SERVICE_DSN"), "data source name of the database")
+	username := flag.String("username", "", "username of the account")
+	role := flag.String("role", auth.RoleViewer, "role of the account: viewer, dispatcher or superadmin")
+	update := flag.Bool("update", false, "reset the password and role of an existing account")
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalf("failed initializing logger : %v", err)
+	}
+
+	*username = strings.TrimSpace(*username)
+	if len(*username) == 0 {
+		logger.Fatal("username is required")
+	}
+
+	if !auth.IsAdminRole(*role) {
+		logger.Fatal("unknown role", zap.String("role", *role))
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if len(password) == 0 {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && len(line) == 0 {
+			logger.Fatal("failed reading password from stdin", zap.Error(err))
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		logger.Fatal("failed hashing password", zap.Error(err))
+	}
+
+	dbConn, err := sqlx.Open("mysql", *dsn)
+	if err != nil {
+		logger.Fatal("failed initializing db connection", zap.Error(err))
+	}
+	defer dbConn.Close()
+
+	ctx := context.Background()
+	repo := db.NewUserAccountsRepo(dbConn)
+	account, err := repo.GetByUsername(ctx, *username)
+	if err != nil {
+		logger.Fatal("failed fetching user account", zap.Error(err))
+	}
+
+	switch {
+	case account == nil && *update:
+		logger.Fatal("account does not exist", zap.String("username", *username))
+	case account != nil && !*update:
+		logger.Fatal("account already exists, use -update to reset it", zap.String("username", *username))
+	case account == nil:
+		account, err = repo.Create(ctx, &db.UserAccount{
+			Username: *username,
+			Password: hash,
+			IsAdmin:  true,
+			Role:     *role,
+		})
+		if err != nil {
+			logger.Fatal("failed creating user account", zap.Error(err))
+		}
+	default:
+		account.Password, account.IsAdmin, account.Role = hash, true, *role
+		err = repo.Update(ctx, account)
+		if err != nil {
+			logger.Fatal("failed updating user account", zap.Error(err))
+		}
+	}
+
+	logger.Info("admin account saved successfully",
+		zap.Int("id", account.ID),
+		zap.String("username", account.Username),
+		zap.String("role", account.Role),
+	)
+}
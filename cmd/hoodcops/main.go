@@ -8,12 +8,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/go-chi/chi/middleware"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/hoodcops/xcore/pkg/api/v1"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/discovery"
+	"github.com/hoodcops/xcore/pkg/escalation"
+	"github.com/hoodcops/xcore/pkg/migrate"
+	"github.com/hoodcops/xcore/pkg/notify"
+	"github.com/hoodcops/xcore/pkg/phone"
+	"github.com/hoodcops/xcore/pkg/push"
+	"github.com/hoodcops/xcore/pkg/ratelimit"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"github.com/hoodcops/xcore/pkg/stream"
 	"github.com/hoodcops/xcore/pkg/twilio"
+	"github.com/hoodcops/xcore/pkg/verification"
 	"github.com/jmoiron/sqlx"
 	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
@@ -25,18 +39,114 @@ const (
 	driver      = "mysql"
 )
 
+const (
+	twilioSender = "twilio"
+	logSender    = "log"
+)
+
+const (
+	memoryLimitStore = "memory"
+	mysqlLimitStore  = "mysql"
+)
+
+const (
+	twilioVerifier  = "twilio"
+	builtinVerifier = "builtin"
+	consoleVerifier = "console"
+)
+
 var env = struct {
-	Port                      int           `envconfig:"PORT" required:"true"`
-	Environment               string        `envconfig:"ENVIRONMENT" default:"development"`
-	ServiceDSN                string        `envconfig:"SERVICE_DSN" required:"true"`
-	SecretKey                 string        `envconfig:"SECRET_KEY" required:"true"`
-	DbConnMaxLife             time.Duration `envconfig:"DB_CONN_MAX_LIFE" default:"14400s"`
-	DbMaxIdleConns            int           `envconfig:"DB_MAX_IDLE_CONNS" default:"50"`
-	DbMaxOpenConns            int           `envconfig:"DB_MAX_OPEN_CONNS" default:"100"`
-	City                      string        `envconfig:"CITY" required:"true"`
-	Locale                    string        `envconfig:"LOCALE" default:"en"`
-	TwilioVerificationAPIHost string        `envconfig:"TWILIO_VERIFICATION_API_HOST" required:"true"`
-	TwilioVerificationAPIKey  string        `envconfig:"TWILIO_VERIFICATION_API_KEY" required:"true"`
+	Port                      int               `envconfig:"PORT" required:"true"`
+	Environment               string            `envconfig:"ENVIRONMENT" default:"development"`
+	ServiceDSN                string            `envconfig:"SERVICE_DSN" required:"true"`
+	SecretKey                 string            `envconfig:"SECRET_KEY" required:"true"`
+	SecretKeyID               string            `envconfig:"SECRET_KEY_ID" default:"default"`
+	VerificationKeys          map[string]string `envconfig:"VERIFICATION_KEYS"`
+	TokenIssuer               string            `envconfig:"TOKEN_ISSUER" default:"hoodcops"`
+	TokenAudience             string            `envconfig:"TOKEN_AUDIENCE" default:"hoodcops-mobile"`
+	AccessTokenTTL            time.Duration     `envconfig:"ACCESS_TOKEN_TTL" default:"30m"`
+	AdminTokenAudience        string            `envconfig:"ADMIN_TOKEN_AUDIENCE" default:"hoodcops-admin"`
+	AdminTokenTTL             time.Duration     `envconfig:"ADMIN_TOKEN_TTL" default:"1h"`
+	AdminMaxFailedLogins      int               `envconfig:"ADMIN_MAX_FAILED_LOGINS" default:"5"`
+	AdminLockout              time.Duration     `envconfig:"ADMIN_LOCKOUT" default:"15m"`
+	RefreshTokenTTL           time.Duration     `envconfig:"REFRESH_TOKEN_TTL" default:"720h"`
+	VerificationTicketTTL     time.Duration     `envconfig:"VERIFICATION_TICKET_TTL" default:"10m"`
+	DbConnMaxLife             time.Duration     `envconfig:"DB_CONN_MAX_LIFE" default:"14400s"`
+	DbMaxIdleConns            int               `envconfig:"DB_MAX_IDLE_CONNS" default:"50"`
+	DbQueryTimeout            time.Duration     `envconfig:"DB_QUERY_TIMEOUT" default:"10s"`
+	DbMaxOpenConns            int               `envconfig:"DB_MAX_OPEN_CONNS" default:"100"`
+	City                      string            `envconfig:"CITY" required:"true"`
+	Locale                    string            `envconfig:"LOCALE" default:"en"`
+	Region                    string            `envconfig:"REGION" default:"GH"`
+	VerificationProvider      string            `envconfig:"VERIFICATION_PROVIDER" default:"twilio"`
+	VerificationCodeLength    int               `envconfig:"VERIFICATION_CODE_LENGTH" default:"6"`
+	VerificationCodeTTL       time.Duration     `envconfig:"VERIFICATION_CODE_TTL" default:"10m"`
+	VerificationMaxAttempts   int               `envconfig:"VERIFICATION_MAX_ATTEMPTS" default:"5"`
+	TwilioAccountSID          string            `envconfig:"TWILIO_ACCOUNT_SID"`
+	TwilioAuthToken           string            `envconfig:"TWILIO_AUTH_TOKEN"`
+	TwilioVerifyHost          string            `envconfig:"TWILIO_VERIFY_HOST" default:"https://verify.twilio.com"`
+	TwilioVerifyServiceSID    string            `envconfig:"TWILIO_VERIFY_SERVICE_SID"`
+	TwilioVerifyChannel       string            `envconfig:"TWILIO_VERIFY_CHANNEL" default:"sms"`
+	SMSProvider               string            `envconfig:"SMS_PROVIDER" default:"log"`
+	TwilioMessagingHost       string            `envconfig:"TWILIO_MESSAGING_HOST" default:"https://api.twilio.com"`
+	TwilioMessagingFrom       string            `envconfig:"TWILIO_MESSAGING_FROM"`
+	TwilioMessagingServiceSID string            `envconfig:"TWILIO_MESSAGING_SERVICE_SID"`
+	NotifyMaxAttempts         int               `envconfig:"NOTIFY_MAX_ATTEMPTS" default:"4"`
+	NotifyBackoff             time.Duration     `envconfig:"NOTIFY_BACKOFF" default:"5s"`
+	NotifyMaxBackoff          time.Duration     `envconfig:"NOTIFY_MAX_BACKOFF" default:"1m"`
+	AlertLocationURL          string            `envconfig:"ALERT_LOCATION_URL" default:"https://maps.google.com/?q=%s,%s"`
+	FCMHost                   string            `envconfig:"FCM_HOST" default:"https://fcm.googleapis.com"`
+	FCMTokenURL               string            `envconfig:"FCM_TOKEN_URL" default:"https://oauth2.googleapis.com/token"`
+	FCMProjectID              string            `envconfig:"FCM_PROJECT_ID"`
+	FCMClientEmail            string            `envconfig:"FCM_CLIENT_EMAIL"`
+	FCMPrivateKey             string            `envconfig:"FCM_PRIVATE_KEY"`
+	APNsHost                  string            `envconfig:"APNS_HOST" default:"https://api.push.apple.com"`
+	APNsKeyID                 string            `envconfig:"APNS_KEY_ID"`
+	APNsTeamID                string            `envconfig:"APNS_TEAM_ID"`
+	APNsPrivateKey            string            `envconfig:"APNS_PRIVATE_KEY"`
+	APNsTopic                 string            `envconfig:"APNS_TOPIC"`
+	EscalationInterval        time.Duration     `envconfig:"ESCALATION_INTERVAL" default:"15s"`
+	EscalateVolunteersAfter   time.Duration     `envconfig:"ESCALATE_VOLUNTEERS_AFTER" default:"2m"`
+	EscalateAdminsAfter       time.Duration     `envconfig:"ESCALATE_ADMINS_AFTER" default:"5m"`
+	VolunteerRadius           float64           `envconfig:"VOLUNTEER_RADIUS" default:"2000"`
+	AdminAlertMsisdns         []string          `envconfig:"ADMIN_ALERT_MSISDNS"`
+	MigrateOnStartup          bool              `envconfig:"MIGRATE_ON_STARTUP" default:"false"`
+	MigrateLockTimeout        time.Duration     `envconfig:"MIGRATE_LOCK_TIMEOUT" default:"60s"`
+	ContactsMaxPerUser        int               `envconfig:"CONTACTS_MAX_PER_USER" default:"500"`
+	ContactsFallback          string            `envconfig:"CONTACTS_FALLBACK" default:"none_accepted"`
+	ContactInviteURL          string            `envconfig:"CONTACT_INVITE_URL"`
+	ContactInviteBurst        int               `envconfig:"CONTACT_INVITE_BURST" default:"20"`
+	ContactInviteInterval     time.Duration     `envconfig:"CONTACT_INVITE_INTERVAL" default:"1h"`
+	DiscoverySecret           string            `envconfig:"DISCOVERY_SECRET" required:"true"`
+	DiscoveryRotation         time.Duration     `envconfig:"DISCOVERY_ROTATION" default:"24h"`
+	DiscoveryRefresh          time.Duration     `envconfig:"DISCOVERY_REFRESH" default:"1m"`
+	DiscoveryUserBurst        int               `envconfig:"DISCOVERY_USER_BURST" default:"5"`
+	DiscoveryUserInterval     time.Duration     `envconfig:"DISCOVERY_USER_INTERVAL" default:"10m"`
+	DiscoveryIPBurst          int               `envconfig:"DISCOVERY_IP_BURST" default:"30"`
+	DiscoveryIPInterval       time.Duration     `envconfig:"DISCOVERY_IP_INTERVAL" default:"1m"`
+	DiscoveryDailyQuota       int               `envconfig:"DISCOVERY_DAILY_QUOTA" default:"5000"`
+	StreamHistory             int               `envconfig:"STREAM_HISTORY" default:"1000"`
+	StreamBuffer              int               `envconfig:"STREAM_BUFFER" default:"64"`
+	StreamHeartbeat           time.Duration     `envconfig:"STREAM_HEARTBEAT" default:"20s"`
+	StreamWriteTimeout        time.Duration     `envconfig:"STREAM_WRITE_TIMEOUT" default:"10s"`
+	TrustProxyHeaders         bool              `envconfig:"TRUST_PROXY_HEADERS" default:"false"`
+	SMSLimitStore             string            `envconfig:"SMS_LIMIT_STORE" default:"mysql"`
+	SMSAllowedRegions         []string          `envconfig:"SMS_ALLOWED_REGIONS" default:"GH"`
+	SMSDeviceBurst            int               `envconfig:"SMS_DEVICE_BURST" default:"5"`
+	SMSDeviceInterval         time.Duration     `envconfig:"SMS_DEVICE_INTERVAL" default:"10m"`
+	SMSIPBurst                int               `envconfig:"SMS_IP_BURST" default:"20"`
+	SMSIPInterval             time.Duration     `envconfig:"SMS_IP_INTERVAL" default:"1m"`
+	SMSMsisdnBurst            int               `envconfig:"SMS_MSISDN_BURST" default:"3"`
+	SMSMsisdnInterval         time.Duration     `envconfig:"SMS_MSISDN_INTERVAL" default:"20m"`
+	SMSGlobalBurst            int               `envconfig:"SMS_GLOBAL_BURST" default:"500"`
+	SMSGlobalInterval         time.Duration     `envconfig:"SMS_GLOBAL_INTERVAL" default:"200ms"`
+	SMSResendCooldown         time.Duration     `envconfig:"SMS_RESEND_COOLDOWN" default:"30s"`
+	SMSMaxResendCooldown      time.Duration     `envconfig:"SMS_MAX_RESEND_COOLDOWN" default:"30m"`
+	SMSDailyCap               int               `envconfig:"SMS_DAILY_CAP" default:"10"`
+	VerifyIPBurst             int               `envconfig:"VERIFY_IP_BURST" default:"30"`
+	VerifyIPInterval          time.Duration     `envconfig:"VERIFY_IP_INTERVAL" default:"1m"`
+	VerifyMsisdnBurst         int               `envconfig:"VERIFY_MSISDN_BURST" default:"10"`
+	VerifyMsisdnInterval      time.Duration     `envconfig:"VERIFY_MSISDN_INTERVAL" default:"10m"`
 }{}
 
 func init() {
@@ -54,6 +164,136 @@ func initLogger(environment string) (*zap.Logger, error) {
 	return zap.NewDevelopment()
 }
 
+func initSMSSender(provider string, client *http.Client, logger *zap.Logger) (sms.Sender, error) {
+	switch provider {
+	case twilioSender:
+		if len(env.TwilioAccountSID) == 0 || len(env.TwilioAuthToken) == 0 {
+			return nil, fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required by the %s sms provider", provider)
+		}
+
+		if len(env.TwilioMessagingFrom) == 0 && len(env.TwilioMessagingServiceSID) == 0 {
+			return nil, fmt.Errorf("TWILIO_MESSAGING_FROM or TWILIO_MESSAGING_SERVICE_SID is required by the %s sms provider", provider)
+		}
+
+		return twilio.NewTwilioSender(client, twilio.SenderConfig{
+			Host:                env.TwilioMessagingHost,
+			AccountSID:          env.TwilioAccountSID,
+			AuthToken:           env.TwilioAuthToken,
+			From:                env.TwilioMessagingFrom,
+			MessagingServiceSID: env.TwilioMessagingServiceSID,
+		}), nil
+	case logSender:
+		return sms.NewLogSender(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", provider)
+	}
+}
+
+func initVerifier(provider string, client *http.Client, sender sms.Sender, store db.Store, logger *zap.Logger) (verification.Verifier, error) {
+	cfg := verification.BuiltinConfig{
+		Secret:      env.SecretKey,
+		CodeLength:  env.VerificationCodeLength,
+		TTL:         env.VerificationCodeTTL,
+		MaxAttempts: env.VerificationMaxAttempts,
+	}
+
+	switch provider {
+	case twilioVerifier:
+		if len(env.TwilioAccountSID) == 0 || len(env.TwilioAuthToken) == 0 || len(env.TwilioVerifyServiceSID) == 0 {
+			return nil, fmt.Errorf("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_VERIFY_SERVICE_SID are required by the %s verifier", provider)
+		}
+
+		return twilio.NewTwilioVerifier(client, twilio.VerifierConfig{
+			Host:       env.TwilioVerifyHost,
+			AccountSID: env.TwilioAccountSID,
+			AuthToken:  env.TwilioAuthToken,
+			ServiceSID: env.TwilioVerifyServiceSID,
+			Channel:    env.TwilioVerifyChannel,
+			Locale:     env.Locale,
+		}), nil
+	case builtinVerifier:
+		repo := store.VerificationCodes()
+		return verification.NewBuiltinVerifier(repo, sender, cfg), nil
+	case consoleVerifier:
+		return verification.NewConsoleVerifier(logger, cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown verification provider %q", provider)
+	}
+}
+
+// initPushService sets up push delivery through the providers that are
+// configured. Private keys may be given with escaped newlines, as is common
+// for multi-line env vars.
+func initPushService(client *http.Client, store db.Store, logger *zap.Logger) (*push.Service, error) {
+	var providers []push.Provider
+
+	if len(env.FCMProjectID) > 0 {
+		fcm, err := push.NewFCMProvider(client, push.FCMConfig{
+			Host:        env.FCMHost,
+			TokenURL:    env.FCMTokenURL,
+			ProjectID:   env.FCMProjectID,
+			ClientEmail: env.FCMClientEmail,
+			PrivateKey:  strings.Replace(env.FCMPrivateKey, `\n`, "\n", -1),
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, fcm)
+	} else {
+		logger.Warn("FCM_PROJECT_ID is not set, push notifications will not be sent to android devices")
+	}
+
+	if len(env.APNsKeyID) > 0 {
+		apns, err := push.NewAPNsProvider(client, push.APNsConfig{
+			Host:       env.APNsHost,
+			KeyID:      env.APNsKeyID,
+			TeamID:     env.APNsTeamID,
+			PrivateKey: strings.Replace(env.APNsPrivateKey, `\n`, "\n", -1),
+			Topic:      env.APNsTopic,
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, apns)
+	} else {
+		logger.Warn("APNS_KEY_ID is not set, push notifications will not be sent to iOS devices")
+	}
+
+	return push.NewService(store.DeviceTokens(), logger, providers...), nil
+}
+
+func initLimitStore(limitStore string, store db.Store) (ratelimit.Store, error) {
+	switch limitStore {
+	case mysqlLimitStore:
+		return store.RateLimits(), nil
+	case memoryLimitStore:
+		return ratelimit.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", limitStore)
+	}
+}
+
+func initSMSLimiter(limitStore ratelimit.Store) (*ratelimit.SMSLimiter, error) {
+	cfg := ratelimit.SMSConfig{
+		PerDevice:      ratelimit.Bucket{Burst: env.SMSDeviceBurst, Interval: env.SMSDeviceInterval},
+		PerIP:          ratelimit.Bucket{Burst: env.SMSIPBurst, Interval: env.SMSIPInterval},
+		PerMsisdn:      ratelimit.Bucket{Burst: env.SMSMsisdnBurst, Interval: env.SMSMsisdnInterval},
+		Global:         ratelimit.Bucket{Burst: env.SMSGlobalBurst, Interval: env.SMSGlobalInterval},
+		Cooldown:       env.SMSResendCooldown,
+		MaxCooldown:    env.SMSMaxResendCooldown,
+		DailyCap:       env.SMSDailyCap,
+		AllowedRegions: env.SMSAllowedRegions,
+	}
+
+	for _, region := range cfg.AllowedRegions {
+		if !phone.IsSupportedRegion(region) {
+			return nil, fmt.Errorf("unsupported SMS region %q", region)
+		}
+	}
+
+	return ratelimit.NewSMSLimiter(limitStore, cfg), nil
+}
+
 func main() {
 	logger, err := initLogger(env.Environment)
 	if err != nil {
@@ -64,6 +304,10 @@ func main() {
 		logger.Info("loaded env vars successfully", zap.Any("configs", env))
 	}
 
+	if !phone.IsSupportedRegion(env.Region) {
+		logger.Fatal("unsupported phone number region", zap.String("region", env.Region))
+	}
+
 	dbConn, err := sqlx.Open(driver, env.ServiceDSN)
 	if err != nil {
 		logger.Fatal("failed initializing db connection", zap.Error(err))
@@ -79,6 +323,30 @@ func main() {
 	dbConn.SetConnMaxLifetime(env.DbConnMaxLife)
 	dbConn.SetMaxIdleConns(env.DbMaxIdleConns)
 	dbConn.SetMaxOpenConns(env.DbMaxOpenConns)
+	db.QueryTimeout = env.DbQueryTimeout
+
+	migrations, err := migrate.Embedded()
+	if err != nil {
+		logger.Fatal("failed loading migrations", zap.Error(err))
+	}
+	store := db.NewStore(dbConn)
+	migrator := migrate.NewMigrator(dbConn, migrations, env.MigrateLockTimeout, logger)
+
+	// hoodcops migrate <command> manages the schema of the database and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate.Command(context.Background(), migrator, os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Fatal("failed running migrations", zap.Error(err))
+		}
+		return
+	}
+
+	if env.MigrateOnStartup {
+		_, err = migrator.Up(context.Background())
+		if err != nil {
+			logger.Fatal("failed running migrations", zap.Error(err))
+		}
+	}
 
 	listener, err := net.Listen("tcp4", fmt.Sprintf(":%d", env.Port))
 	if err != nil {
@@ -87,14 +355,181 @@ func main() {
 	defer listener.Close()
 
 	client := &http.Client{Timeout: 30 * time.Second}
-	verifier := twilio.NewTwilioVerifier(
-		client,
-		env.TwilioVerificationAPIHost,
-		env.Locale,
-		env.TwilioVerificationAPIKey,
+	sender, err := initSMSSender(env.SMSProvider, client, logger)
+	if err != nil {
+		logger.Fatal("failed initializing sms sender", zap.Error(err))
+	}
+
+	verifier, err := initVerifier(env.VerificationProvider, client, sender, store, logger)
+	if err != nil {
+		logger.Fatal("failed initializing phone verifier", zap.Error(err))
+	}
+
+	tokens, err := auth.NewTokenService(auth.TokenConfig{
+		SigningKeyID:     env.SecretKeyID,
+		SigningKey:       env.SecretKey,
+		VerificationKeys: env.VerificationKeys,
+		Issuer:           env.TokenIssuer,
+		Audience:         env.TokenAudience,
+		TTL:              env.AccessTokenTTL,
+		AdminAudience:    env.AdminTokenAudience,
+		AdminTTL:         env.AdminTokenTTL,
+		RefreshTTL:       env.RefreshTokenTTL,
+		TicketTTL:        env.VerificationTicketTTL,
+	})
+	if err != nil {
+		logger.Fatal("failed initializing token service", zap.Error(err))
+	}
+
+	limitStore, err := initLimitStore(env.SMSLimitStore, store)
+	if err != nil {
+		logger.Fatal("failed initializing rate limit store", zap.Error(err))
+	}
+
+	limiter, err := initSMSLimiter(limitStore)
+	if err != nil {
+		logger.Fatal("failed initializing SMS rate limiter", zap.Error(err))
+	}
+
+	verifyLimiter := ratelimit.NewLimiter(limitStore, "verify", ratelimit.LimiterConfig{
+		Subject:    ratelimit.LimitMsisdn,
+		PerSubject: ratelimit.Bucket{Burst: env.VerifyMsisdnBurst, Interval: env.VerifyMsisdnInterval},
+		PerIP:      ratelimit.Bucket{Burst: env.VerifyIPBurst, Interval: env.VerifyIPInterval},
+	})
+
+	pusher, err := initPushService(client, store, logger)
+	if err != nil {
+		logger.Fatal("failed initializing push notifications", zap.Error(err))
+	}
+
+	switch env.ContactsFallback {
+	case notify.FallbackNone, notify.FallbackNoneAccepted, notify.FallbackPending:
+	default:
+		logger.Fatal("unknown contacts fallback policy", zap.String("policy", env.ContactsFallback))
+	}
+
+	contacts := notify.NewContactsNotifier(
+		store.UserContacts(),
+		store.MobileUsers(),
+		store.UserProfiles(),
+		store.NotificationAttempts(),
+		sender,
+		pusher,
+		notify.ContactsConfig{
+			Locale:      env.Locale,
+			LocationURL: env.AlertLocationURL,
+			MaxAttempts: env.NotifyMaxAttempts,
+			Backoff:     env.NotifyBackoff,
+			MaxBackoff:  env.NotifyMaxBackoff,
+			Fallback:    env.ContactsFallback,
+		},
+		logger,
 	)
 
-	routes := v1.InitRoutes(dbConn, verifier, env.SecretKey, logger)
+	var inviter notify.Inviter = notify.NewLogInviter(logger)
+	if len(env.ContactInviteURL) > 0 {
+		inviter = notify.NewSMSInviter(
+			store.UserContacts(),
+			store.MobileUsers(),
+			store.UserProfiles(),
+			sender,
+			tokens,
+			limiter,
+			ratelimit.NewLimiter(limitStore, "invite", ratelimit.LimiterConfig{
+				Subject:    ratelimit.LimitUser,
+				PerSubject: ratelimit.Bucket{Burst: env.ContactInviteBurst, Interval: env.ContactInviteInterval},
+			}),
+			notify.InvitesConfig{
+				Locale:    env.Locale,
+				InviteURL: env.ContactInviteURL,
+			},
+			logger,
+		)
+	} else {
+		logger.Warn("CONTACT_INVITE_URL is not set, contacts will not be invited")
+	}
+
+	// peppers are published, so they must not be derived from a key
+	// that signs anything
+	if env.DiscoverySecret == env.SecretKey {
+		logger.Fatal("DISCOVERY_SECRET must differ from SECRET_KEY")
+	}
+
+	discoverer := discovery.NewService(store.MobileUsers(), env.DiscoverySecret, discovery.Config{
+		Rotation: env.DiscoveryRotation,
+		Refresh:  env.DiscoveryRefresh,
+	})
+
+	discoveryLimiter := ratelimit.NewLimiter(limitStore, "discovery", ratelimit.LimiterConfig{
+		Subject:    ratelimit.LimitUser,
+		PerSubject: ratelimit.Bucket{Burst: env.DiscoveryUserBurst, Interval: env.DiscoveryUserInterval},
+		PerIP:      ratelimit.Bucket{Burst: env.DiscoveryIPBurst, Interval: env.DiscoveryIPInterval},
+		DailyQuota: env.DiscoveryDailyQuota,
+	})
+
+	events := stream.NewHub(stream.HubConfig{
+		History: env.StreamHistory,
+		Buffer:  env.StreamBuffer,
+	})
+	streamCfg := stream.ConnConfig{
+		Heartbeat:    env.StreamHeartbeat,
+		WriteTimeout: env.StreamWriteTimeout,
+	}
+
+	if len(env.AdminAlertMsisdns) == 0 {
+		logger.Warn("ADMIN_ALERT_MSISDNS is not set, alerts will not be escalated to administrators")
+	}
+
+	escalator := escalation.NewEscalator(store.Alerts(), events, escalation.Config{
+		Interval: env.EscalationInterval,
+		Levels: []escalation.Level{
+			{Name: "contacts", Notify: contacts},
+			{
+				Name:  "volunteers",
+				After: env.EscalateVolunteersAfter,
+				Notify: notify.NewVolunteersNotifier(
+					store.UserProfiles(),
+					pusher,
+					notify.VolunteersConfig{
+						Radius:      env.VolunteerRadius,
+						Locale:      env.Locale,
+						LocationURL: env.AlertLocationURL,
+					},
+					logger,
+				),
+			},
+			{
+				Name:  "admins",
+				After: env.EscalateAdminsAfter,
+				Notify: notify.NewAdminsNotifier(
+					store.MobileUsers(),
+					store.UserProfiles(),
+					store.NotificationAttempts(),
+					sender,
+					notify.AdminsConfig{
+						Msisdns:     env.AdminAlertMsisdns,
+						Locale:      env.Locale,
+						LocationURL: env.AlertLocationURL,
+					},
+					logger,
+				),
+			},
+		},
+	}, logger)
+
+	// work left running in the background, escalating alerts and
+	// notifying contacts about them, is stopped on shutdown
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+
+	var routes http.Handler = v1.InitRoutes(bgCtx, store, verifier, limiter, verifyLimiter, escalator, inviter, discoverer, discoveryLimiter, events, streamCfg, tokens, v1.AdminAuthConfig{
+		MaxFailedLogins: env.AdminMaxFailedLogins,
+		Lockout:         env.AdminLockout,
+	}, v1.ContactsConfig{
+		MaxPerUser: env.ContactsMaxPerUser,
+	}, env.Region, logger)
+	if env.TrustProxyHeaders {
+		routes = middleware.RealIP(routes)
+	}
 
 	server := http.Server{
 		ReadHeaderTimeout: 30 * time.Second,
@@ -106,12 +541,15 @@ func main() {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
+	go escalator.Run(bgCtx)
+
 	connsClosed := make(chan struct{})
 	go func() {
 		defer close(connsClosed)
 
 		recv := <-sigs
 		logger.Info("received signal, shutting down", zap.Any("signal", recv.String()))
+		stopBackground()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -0,0 +1,306 @@
+// Command normalize-msisdns is a one-off migration that rewrites the msisdns
+// of mobile users and their contacts into canonical E.164 format. Mobile users
+// whose numbers turn out to be the same are merged into the oldest of them,
+// and duplicate contacts of a user are removed. Numbers that cannot be parsed
+// are logged and left untouched.
+//
+// It should be run before migration 0013, which only removes contacts whose
+// msisdns are exactly the same before making msisdns unique per user, e.g.
+// with "hoodcops migrate to 12" first. It still works after, since colliding
+// rows are removed before any msisdn is rewritten.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/hoodcops/xcore/pkg/phone"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// tables whose user_id column references mobile_users, apart from
+// mobile_user_profiles which allows a single profile per user
+var userTables = []string{
+	"mobile_user_tokens",
+	"mobile_user_contacts",
+	"mobile_user_alerts",
+	"mobile_user_refresh_tokens",
+}
+
+// declinesTable holds the numbers that declined to be a user's contact,
+// once per user and msisdn. It only exists from migration 0016 on.
+const declinesTable = "mobile_user_contact_declines"
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("SERVICE_DSN"), "data source name of the database")
+	region := flag.String("region", os.Getenv("REGION"), "region of numbers without an international prefix")
+	dryRun := flag.Bool("dry-run", false, "report changes without saving them")
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalf("failed initializing logger : %v", err)
+	}
+
+	if len(*region) == 0 {
+		*region = "GH"
+	}
+
+	if !phone.IsSupportedRegion(*region) {
+		logger.Fatal("unsupported phone number region", zap.String("region", *region))
+	}
+
+	dbConn, err := sqlx.Open("mysql", *dsn)
+	if err != nil {
+		logger.Fatal("failed initializing db connection", zap.Error(err))
+	}
+	defer dbConn.Close()
+
+	tx, err := dbConn.Beginx()
+	if err != nil {
+		logger.Fatal("failed starting transaction", zap.Error(err))
+	}
+
+	err = normalizeUsers(tx, *region, logger)
+	if err != nil {
+		tx.Rollback()
+		logger.Fatal("failed normalizing mobile users", zap.Error(err))
+	}
+
+	err = normalizeContacts(tx, *region, logger)
+	if err != nil {
+		tx.Rollback()
+		logger.Fatal("failed normalizing contacts", zap.Error(err))
+	}
+
+	if *dryRun {
+		tx.Rollback()
+		logger.Info("dry run complete, no changes were saved")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		logger.Fatal("failed committing changes", zap.Error(err))
+	}
+
+	logger.Info("msisdns normalized successfully")
+}
+
+func normalizeUsers(tx *sqlx.Tx, region string, logger *zap.Logger) error {
+	var users []struct {
+		ID     int    `db:"id"`
+		Msisdn string `db:"msisdn"`
+	}
+
+	err := tx.Select(&users, "SELECT id, msisdn FROM mobile_users ORDER BY id")
+	if err != nil {
+		return err
+	}
+
+	// users are grouped by normalized msisdn, oldest first
+	groups := map[string][]int{}
+	var order []string
+	raw := map[int]string{}
+
+	for _, user := range users {
+		msisdn, err := phone.Parse(user.Msisdn, region)
+		if err != nil {
+			logger.Warn("skipping mobile user with invalid msisdn", zap.Int("id", user.ID), zap.String("msisdn", user.Msisdn))
+			continue
+		}
+
+		if _, ok := groups[msisdn.String()]; !ok {
+			order = append(order, msisdn.String())
+		}
+		groups[msisdn.String()] = append(groups[msisdn.String()], user.ID)
+		raw[user.ID] = user.Msisdn
+	}
+
+	for _, msisdn := range order {
+		ids := groups[msisdn]
+		keep := ids[0]
+
+		for _, dup := range ids[1:] {
+			logger.Info("merging duplicate mobile user", zap.Int("id", dup), zap.Int("into", keep), zap.String("msisdn", msisdn))
+
+			err := mergeUser(tx, dup, keep)
+			if err != nil {
+				return err
+			}
+		}
+
+		if raw[keep] != msisdn {
+			logger.Info("normalizing mobile user msisdn", zap.Int("id", keep), zap.String("from", raw[keep]), zap.String("to", msisdn))
+
+			_, err := tx.Exec("UPDATE mobile_users SET msisdn = ? WHERE id = ?", msisdn, keep)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeUser moves all records of the mobile user dup over to the mobile user
+// keep and deletes dup. The profile of dup is only kept if keep has none.
+func mergeUser(tx *sqlx.Tx, dup, keep int) error {
+	var profiles int
+	err := tx.Get(&profiles, "SELECT COUNT(*) FROM mobile_user_profiles WHERE user_id = ?", keep)
+	if err != nil {
+		return err
+	}
+
+	if profiles > 0 {
+		_, err = tx.Exec("DELETE FROM mobile_user_profiles WHERE user_id = ?", dup)
+	} else {
+		_, err = tx.Exec("UPDATE mobile_user_profiles SET user_id = ? WHERE user_id = ?", keep, dup)
+	}
+	if err != nil {
+		return err
+	}
+
+	tables := userTables
+	hasDeclines, err := tableExists(tx, declinesTable)
+	if err != nil {
+		return err
+	}
+
+	if hasDeclines {
+		tables = append(tables, declinesTable)
+	}
+
+	// msisdns are unique per user in these tables, so the rows of dup
+	// that keep already has are dropped rather than moved
+	for _, table := range []string{"mobile_user_contacts", declinesTable} {
+		if table == declinesTable && !hasDeclines {
+			continue
+		}
+
+		_, err = tx.Exec("DELETE d FROM "+table+" AS d JOIN "+table+" AS k ON k.user_id = ? AND k.msisdn = d.msisdn WHERE d.user_id = ?", keep, dup)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range tables {
+		_, err = tx.Exec("UPDATE "+table+" SET user_id = ? WHERE user_id = ?", keep, dup)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM mobile_users WHERE id = ?", dup)
+	return err
+}
+
+// tableExists reports whether the current database has a table called name
+func tableExists(tx *sqlx.Tx, name string) (bool, error) {
+	var n int
+	err := tx.Get(&n, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", name)
+	return n > 0, err
+}
+
+func normalizeContacts(tx *sqlx.Tx, region string, logger *zap.Logger) error {
+	var contacts []struct {
+		ID     int    `db:"id"`
+		UserID int    `db:"user_id"`
+		Msisdn string `db:"msisdn"`
+	}
+
+	err := tx.Select(&contacts, "SELECT id, user_id, msisdn FROM mobile_user_contacts ORDER BY id")
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		userID int
+		msisdn string
+	}
+	seen := map[key]bool{}
+	renames := map[int]string{}
+	var renamed []int
+
+	// duplicates are all removed before any msisdn is rewritten, as
+	// msisdns are unique per user once migration 0013 has run
+	for _, contact := range contacts {
+		msisdn, err := phone.Parse(contact.Msisdn, region)
+		if err != nil {
+			logger.Warn("skipping contact with invalid msisdn", zap.Int("id", contact.ID), zap.String("msisdn", contact.Msisdn))
+			continue
+		}
+
+		k := key{userID: contact.UserID, msisdn: msisdn.String()}
+		if seen[k] {
+			logger.Info("removing duplicate contact", zap.Int("id", contact.ID), zap.Int("userId", contact.UserID), zap.String("msisdn", k.msisdn))
+
+			_, err := tx.Exec("DELETE FROM mobile_user_contacts WHERE id = ?", contact.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		seen[k] = true
+
+		if contact.Msisdn != k.msisdn {
+			renames[contact.ID] = k.msisdn
+			renamed = append(renamed, contact.ID)
+		}
+	}
+
+	for _, id := range renamed {
+		_, err := tx.Exec("UPDATE mobile_user_contacts SET msisdn = ? WHERE id = ?", renames[id], id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return normalizeDeclines(tx, region, logger)
+}
+
+// normalizeDeclines rewrites the msisdns of declined invitations, merging
+// those that turn out to be the same
+func normalizeDeclines(tx *sqlx.Tx, region string, logger *zap.Logger) error {
+	ok, err := tableExists(tx, declinesTable)
+	if err != nil || !ok {
+		return err
+	}
+
+	var declines []struct {
+		UserID int    `db:"user_id"`
+		Msisdn string `db:"msisdn"`
+	}
+
+	err = tx.Select(&declines, "SELECT user_id, msisdn FROM "+declinesTable)
+	if err != nil {
+		return err
+	}
+
+	for _, decline := range declines {
+		msisdn, err := phone.Parse(decline.Msisdn, region)
+		if err != nil {
+			logger.Warn("skipping declined invitation with invalid msisdn", zap.Int("userId", decline.UserID), zap.String("msisdn", decline.Msisdn))
+			continue
+		}
+
+		if decline.Msisdn == msisdn.String() {
+			continue
+		}
+
+		_, err = tx.Exec("INSERT IGNORE INTO "+declinesTable+" (user_id, msisdn, declined_at) SELECT user_id, ?, declined_at FROM "+declinesTable+" WHERE user_id = ? AND msisdn = ?", msisdn.String(), decline.UserID, decline.Msisdn)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM "+declinesTable+" WHERE user_id = ? AND msisdn = ?", decline.UserID, decline.Msisdn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,5 +1,7 @@
 module github.com/hoodcops/xcore
 
+go 1.27.1
+
 require (
 	github.com/DATA-DOG/go-sqlmock v1.3.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
@@ -9,8 +11,20 @@ require (
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/kelseyhightower/envconfig v1.3.0
 	github.com/pkg/errors v0.8.0
+	go.uber.org/zap v1.9.1
+	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/lib/pq v1.0.0 // indirect
+	github.com/mattn/go-sqlite3 v1.9.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.2.0 // indirect
+	github.com/stretchr/objx v0.1.1 // indirect
+	github.com/stretchr/testify v1.2.2 // indirect
 	go.uber.org/atomic v1.3.2 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
-	go.uber.org/zap v1.9.1
+	golang.org/x/sys v0.0.0-20180905080454-ebe1bf3edb33 // indirect
 )
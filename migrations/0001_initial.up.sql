@@ -1,5 +1,3 @@
--- SQL in this section is executed when migration is applied.
-
 -- name: create-user-accounts
 CREATE TABLE IF NOT EXISTS user_accounts
 (
@@ -16,7 +14,6 @@ CREATE TABLE IF NOT EXISTS user_accounts
 -- name: create-user-accounts-username-index
 CREATE UNIQUE INDEX user_accounts_username_index ON user_accounts(username);
 
-
 -- name: create-mobile-users
 CREATE TABLE IF NOT EXISTS mobile_users
 (
@@ -30,7 +27,6 @@ CREATE TABLE IF NOT EXISTS mobile_users
 -- name: create-mobile-users-msisdn-index
 CREATE UNIQUE INDEX mobile_users_msisdn_index ON mobile_users(msisdn);
 
-
 -- name: create-mobile-user-tokens
 CREATE TABLE IF NOT EXISTS mobile_user_tokens
 (
@@ -59,7 +55,6 @@ CREATE TABLE IF NOT EXISTS mobile_user_contacts
     CONSTRAINT fk_mobile_user_contacts_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)
 );
 
-
 -- name: create-mobile-user-profiles
 CREATE TABLE IF NOT EXISTS mobile_user_profiles
 (
@@ -92,4 +87,3 @@ CREATE TABLE IF NOT EXISTS mobile_user_alerts
     PRIMARY KEY(id),
     CONSTRAINT fk_mobile_user_alerts_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)
 );
-
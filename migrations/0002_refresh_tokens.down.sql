@@ -0,0 +1,2 @@
+-- name: remove-mobile-user-refresh-tokens
+DROP TABLE IF EXISTS mobile_user_refresh_tokens;
@@ -0,0 +1,24 @@
+-- name: create-mobile-user-refresh-tokens
+CREATE TABLE IF NOT EXISTS mobile_user_refresh_tokens
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    user_id         INT            NOT NULL,
+    family_id       VARCHAR(64)    NOT NULL,
+    device_id       VARCHAR(255)   NOT NULL,
+    token_hash      CHAR(64)       NOT NULL,
+    expires_at      DATETIME       NOT NULL,
+    used_at         DATETIME       NULL,
+    revoked_at      DATETIME       NULL,
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id),
+    CONSTRAINT fk_mobile_user_refresh_tokens_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)
+);
+
+-- name: create-mobile-user-refresh-tokens-hash-index
+CREATE UNIQUE INDEX mobile_user_refresh_tokens_hash_index ON mobile_user_refresh_tokens(token_hash);
+
+-- name: create-mobile-user-refresh-tokens-family-index
+CREATE INDEX mobile_user_refresh_tokens_family_index ON mobile_user_refresh_tokens(family_id);
+
+-- name: create-mobile-user-refresh-tokens-device-index
+CREATE INDEX mobile_user_refresh_tokens_device_index ON mobile_user_refresh_tokens(user_id, device_id);
@@ -0,0 +1,2 @@
+-- name: remove-phone-verification-tickets
+DROP TABLE IF EXISTS phone_verification_tickets;
@@ -0,0 +1,14 @@
+-- name: create-phone-verification-tickets
+CREATE TABLE IF NOT EXISTS phone_verification_tickets
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    msisdn          VARCHAR(255)   NOT NULL,
+    ticket_hash     CHAR(64)       NOT NULL,
+    expires_at      DATETIME       NOT NULL,
+    used_at         DATETIME       NULL,
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id)
+);
+
+-- name: create-phone-verification-tickets-hash-index
+CREATE UNIQUE INDEX phone_verification_tickets_hash_index ON phone_verification_tickets(ticket_hash);
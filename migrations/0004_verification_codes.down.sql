@@ -0,0 +1,2 @@
+-- name: remove-phone-verification-codes
+DROP TABLE IF EXISTS phone_verification_codes;
@@ -0,0 +1,16 @@
+-- name: create-phone-verification-codes
+CREATE TABLE IF NOT EXISTS phone_verification_codes
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    msisdn          VARCHAR(255)   NOT NULL,
+    code_hash       CHAR(64)       NOT NULL,
+    attempts        INT            NOT NULL     DEFAULT 0,
+    expires_at      DATETIME       NOT NULL,
+    verified_at     DATETIME       NULL,
+    canceled_at     DATETIME       NULL,
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id)
+);
+
+-- name: create-phone-verification-codes-msisdn-index
+CREATE INDEX phone_verification_codes_msisdn_index ON phone_verification_codes(msisdn);
@@ -0,0 +1,2 @@
+-- name: remove-rate-limits
+DROP TABLE IF EXISTS rate_limits;
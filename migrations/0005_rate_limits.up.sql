@@ -0,0 +1,11 @@
+-- name: create-rate-limits
+CREATE TABLE IF NOT EXISTS rate_limits
+(
+    rate_key        VARCHAR(255)   NOT NULL,
+    tokens          DOUBLE         NOT NULL     DEFAULT 0,
+    count           INT            NOT NULL     DEFAULT 0,
+    window_ends_at  DATETIME       NULL,
+    next_allowed_at DATETIME       NULL,
+    updated_at      DATETIME       NULL,
+    PRIMARY KEY(rate_key)
+);
@@ -0,0 +1,15 @@
+-- name: remove-mobile-user-alert-events
+DROP TABLE IF EXISTS mobile_user_alert_events;
+
+-- name: drop-mobile-user-alerts-user-index
+DROP INDEX mobile_user_alerts_user_index ON mobile_user_alerts;
+
+-- name: restore-mobile-user-alerts
+ALTER TABLE mobile_user_alerts
+    MODIFY geo_lng  VARCHAR(255)   NULL,
+    MODIFY geo_lat  VARCHAR(255)   NULL,
+    DROP accuracy,
+    DROP category,
+    DROP message,
+    DROP status,
+    DROP updated_at;
@@ -0,0 +1,43 @@
+-- Legacy alerts were stored with free text coordinates, so those that are
+-- missing or out of range are canceled and placed at 0,0 before the
+-- coordinates become numbers.
+
+-- name: alter-mobile-user-alerts
+ALTER TABLE mobile_user_alerts
+    ADD accuracy    DOUBLE         NOT NULL     DEFAULT 0,
+    ADD category    VARCHAR(64)    NOT NULL     DEFAULT 'general',
+    ADD message     VARCHAR(1024)  NOT NULL     DEFAULT '',
+    ADD status      VARCHAR(32)    NOT NULL     DEFAULT 'raised',
+    ADD updated_at  DATETIME       NULL;
+
+-- name: update-mobile-user-alerts-invalid-location
+UPDATE mobile_user_alerts
+    SET status = 'canceled',
+        message = 'Alert had no valid location',
+        geo_lng = '0',
+        geo_lat = '0'
+    WHERE geo_lat IS NULL
+       OR geo_lng IS NULL
+       OR geo_lat NOT REGEXP '^-?([0-8]?[0-9](\\.[0-9]+)?|90(\\.0+)?)$'
+       OR geo_lng NOT REGEXP '^-?((1[0-7][0-9]|[0-9]?[0-9])(\\.[0-9]+)?|180(\\.0+)?)$';
+
+-- name: alter-mobile-user-alerts-location
+ALTER TABLE mobile_user_alerts
+    MODIFY geo_lng  DOUBLE         NOT NULL,
+    MODIFY geo_lat  DOUBLE         NOT NULL;
+
+-- name: create-mobile-user-alerts-user-index
+CREATE INDEX mobile_user_alerts_user_index ON mobile_user_alerts(user_id, created_at);
+
+-- name: create-mobile-user-alert-events
+CREATE TABLE IF NOT EXISTS mobile_user_alert_events
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    alert_id        INT            NOT NULL,
+    status          VARCHAR(32)    NOT NULL,
+    note            VARCHAR(1024)  NOT NULL     DEFAULT '',
+    user_id         INT            NULL,
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id),
+    CONSTRAINT fk_mobile_user_alert_events_alert_id  FOREIGN KEY  (alert_id) REFERENCES mobile_user_alerts(id)
+);
@@ -0,0 +1,2 @@
+-- name: remove-alert-notification-attempts
+DROP TABLE IF EXISTS alert_notification_attempts;
@@ -0,0 +1,18 @@
+-- name: create-alert-notification-attempts
+CREATE TABLE IF NOT EXISTS alert_notification_attempts
+(
+    id              INT            NOT NULL     AUTO_INCREMENT,
+    alert_id        INT            NOT NULL,
+    contact_id      INT            NULL,
+    channel         VARCHAR(16)    NOT NULL,
+    recipient       VARCHAR(255)   NOT NULL,
+    attempt         INT            NOT NULL,
+    status          VARCHAR(16)    NOT NULL,
+    error           VARCHAR(1024)  NOT NULL     DEFAULT '',
+    created_at      DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(id),
+    CONSTRAINT fk_alert_notification_attempts_alert_id  FOREIGN KEY  (alert_id) REFERENCES mobile_user_alerts(id)
+);
+
+-- name: create-alert-notification-attempts-alert-index
+CREATE INDEX alert_notification_attempts_alert_index ON alert_notification_attempts(alert_id);
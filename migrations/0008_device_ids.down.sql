@@ -0,0 +1,6 @@
+-- name: drop-mobile-user-tokens-device-index
+DROP INDEX mobile_user_tokens_device_index ON mobile_user_tokens;
+
+-- name: restore-mobile-user-tokens
+ALTER TABLE mobile_user_tokens
+    DROP device_id;
@@ -0,0 +1,6 @@
+-- name: alter-mobile-user-tokens
+ALTER TABLE mobile_user_tokens
+    ADD device_id   VARCHAR(255)   NOT NULL     DEFAULT '';
+
+-- name: create-mobile-user-tokens-device-index
+CREATE INDEX mobile_user_tokens_device_index ON mobile_user_tokens(user_id, device_id);
@@ -0,0 +1,34 @@
+-- name: restore-mobile-user-profiles-geo
+ALTER TABLE mobile_user_profiles
+    ADD geo_lng     VARCHAR(255)   NULL,
+    ADD geo_lat     VARCHAR(255)   NULL;
+
+-- name: update-mobile-user-profiles-geo
+UPDATE mobile_user_profiles
+    SET geo_lng = ST_Longitude(location),
+        geo_lat = ST_Latitude(location)
+    WHERE has_location;
+
+-- name: drop-mobile-user-profiles-location
+ALTER TABLE mobile_user_profiles
+    DROP INDEX mobile_user_profiles_location_index,
+    DROP location,
+    DROP has_location,
+    DROP responder;
+
+-- name: restore-mobile-user-alerts-geo
+ALTER TABLE mobile_user_alerts
+    ADD geo_lng     DOUBLE         NULL,
+    ADD geo_lat     DOUBLE         NULL;
+
+-- name: update-mobile-user-alerts-geo
+UPDATE mobile_user_alerts
+    SET geo_lng = ST_Longitude(location),
+        geo_lat = ST_Latitude(location);
+
+-- name: drop-mobile-user-alerts-location
+ALTER TABLE mobile_user_alerts
+    MODIFY geo_lng  DOUBLE         NOT NULL,
+    MODIFY geo_lat  DOUBLE         NOT NULL,
+    DROP INDEX mobile_user_alerts_location_index,
+    DROP location;
@@ -0,0 +1,43 @@
+-- name: alter-mobile-user-alerts-location
+ALTER TABLE mobile_user_alerts
+    ADD location    POINT          NULL         SRID 4326;
+
+-- name: update-mobile-user-alerts-location
+UPDATE mobile_user_alerts
+    SET location = ST_GeomFromWKB(ST_AsBinary(POINT(geo_lng, geo_lat)), 4326, 'axis-order=long-lat');
+
+-- name: alter-mobile-user-alerts-drop-geo
+ALTER TABLE mobile_user_alerts
+    MODIFY location POINT          NOT NULL     SRID 4326,
+    DROP geo_lng,
+    DROP geo_lat;
+
+-- name: create-mobile-user-alerts-location-index
+CREATE SPATIAL INDEX mobile_user_alerts_location_index ON mobile_user_alerts(location);
+
+-- name: alter-mobile-user-profiles-location
+ALTER TABLE mobile_user_profiles
+    ADD location    POINT          NULL         SRID 4326,
+    ADD has_location BOOLEAN       NOT NULL     DEFAULT FALSE,
+    ADD responder   BOOLEAN        NOT NULL     DEFAULT FALSE;
+
+-- name: update-mobile-user-profiles-location
+UPDATE mobile_user_profiles
+    SET location = ST_GeomFromWKB(ST_AsBinary(POINT(geo_lng, geo_lat)), 4326, 'axis-order=long-lat'),
+        has_location = TRUE
+    WHERE geo_lat REGEXP '^-?([0-8]?[0-9](\\.[0-9]+)?|90(\\.0+)?)$'
+      AND geo_lng REGEXP '^-?((1[0-7][0-9]|[0-9]?[0-9])(\\.[0-9]+)?|180(\\.0+)?)$';
+
+-- name: update-mobile-user-profiles-unknown-location
+UPDATE mobile_user_profiles
+    SET location = ST_GeomFromText('POINT(0 0)', 4326)
+    WHERE location IS NULL;
+
+-- name: alter-mobile-user-profiles-drop-geo
+ALTER TABLE mobile_user_profiles
+    MODIFY location POINT          NOT NULL     SRID 4326,
+    DROP geo_lng,
+    DROP geo_lat;
+
+-- name: create-mobile-user-profiles-location-index
+CREATE SPATIAL INDEX mobile_user_profiles_location_index ON mobile_user_profiles(location);
@@ -0,0 +1,7 @@
+-- name: drop-mobile-user-alerts-escalation-index
+DROP INDEX mobile_user_alerts_escalation_index ON mobile_user_alerts;
+
+-- name: restore-mobile-user-alerts-escalation
+ALTER TABLE mobile_user_alerts
+    DROP escalation_level,
+    DROP escalate_at;
@@ -0,0 +1,12 @@
+-- name: alter-mobile-user-alerts-escalation
+ALTER TABLE mobile_user_alerts
+    ADD escalation_level INT       NOT NULL     DEFAULT 0,
+    ADD escalate_at     DATETIME   NULL;
+
+-- name: update-mobile-user-alerts-escalation
+UPDATE mobile_user_alerts
+    SET escalation_level = 1
+    WHERE status = 'raised';
+
+-- name: create-mobile-user-alerts-escalation-index
+CREATE INDEX mobile_user_alerts_escalation_index ON mobile_user_alerts(status, escalate_at);
@@ -0,0 +1,6 @@
+-- name: restore-user-accounts-admin-auth
+ALTER TABLE user_accounts
+    MODIFY is_admin BOOLEAN        DEFAULT TRUE,
+    DROP role,
+    DROP failed_logins,
+    DROP locked_until;
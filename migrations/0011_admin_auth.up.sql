@@ -0,0 +1,9 @@
+-- name: update-user-accounts-is-admin
+UPDATE user_accounts SET is_admin = FALSE WHERE is_admin IS NULL;
+
+-- name: alter-user-accounts-admin-auth
+ALTER TABLE user_accounts
+    MODIFY is_admin BOOLEAN        NOT NULL     DEFAULT FALSE,
+    ADD role        VARCHAR(32)    NOT NULL     DEFAULT 'viewer',
+    ADD failed_logins INT          NOT NULL     DEFAULT 0,
+    ADD locked_until DATETIME      NULL;
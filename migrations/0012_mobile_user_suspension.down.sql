@@ -0,0 +1,4 @@
+-- name: restore-mobile-users-suspension
+ALTER TABLE mobile_users
+    DROP suspended_at,
+    DROP sessions_revoked_at;
@@ -0,0 +1,4 @@
+-- name: alter-mobile-users-suspension
+ALTER TABLE mobile_users
+    ADD suspended_at DATETIME      NULL,
+    ADD sessions_revoked_at DATETIME NULL;
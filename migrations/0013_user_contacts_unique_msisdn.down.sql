@@ -0,0 +1,4 @@
+-- name: restore-contacts-unique-msisdn
+ALTER TABLE mobile_user_contacts
+    DROP INDEX uq_mobile_user_contacts_user_msisdn,
+    DROP updated_at;
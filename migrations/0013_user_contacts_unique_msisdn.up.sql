@@ -0,0 +1,11 @@
+-- Duplicates are only found by exact msisdn, so cmd/normalize-msisdns must
+-- be run before this migration to catch numbers written in different forms.
+
+-- name: remove-duplicate-contacts
+DELETE c FROM mobile_user_contacts AS c
+    JOIN mobile_user_contacts AS d ON d.user_id = c.user_id AND d.msisdn = c.msisdn AND d.id < c.id;
+
+-- name: alter-contacts-unique-msisdn
+ALTER TABLE mobile_user_contacts
+    ADD updated_at  DATETIME       NULL,
+    ADD CONSTRAINT uq_mobile_user_contacts_user_msisdn UNIQUE (user_id, msisdn);
@@ -0,0 +1,4 @@
+-- name: restore-contacts-priority
+ALTER TABLE mobile_user_contacts
+    DROP priority,
+    DROP relationship;
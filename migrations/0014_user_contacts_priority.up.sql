@@ -0,0 +1,4 @@
+-- name: alter-contacts-priority
+ALTER TABLE mobile_user_contacts
+    ADD priority        INT            NOT NULL     DEFAULT 0,
+    ADD relationship    VARCHAR(32)    NOT NULL     DEFAULT '';
@@ -0,0 +1,5 @@
+-- name: restore-contacts-consent
+ALTER TABLE mobile_user_contacts
+    DROP status,
+    DROP invited_at,
+    DROP responded_at;
@@ -0,0 +1,5 @@
+-- name: alter-contacts-consent
+ALTER TABLE mobile_user_contacts
+    ADD status          VARCHAR(16)    NOT NULL     DEFAULT 'pending',
+    ADD invited_at      DATETIME       NULL,
+    ADD responded_at    DATETIME       NULL;
@@ -0,0 +1,2 @@
+-- name: remove-contact-declines
+DROP TABLE IF EXISTS mobile_user_contact_declines;
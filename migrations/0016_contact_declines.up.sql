@@ -0,0 +1,13 @@
+-- name: create-contact-declines
+CREATE TABLE IF NOT EXISTS mobile_user_contact_declines
+(
+    user_id         INT            NOT NULL,
+    msisdn          VARCHAR(255)   NOT NULL,
+    declined_at     DATETIME       DEFAULT NOW(),
+    PRIMARY KEY(user_id, msisdn),
+    CONSTRAINT fk_mobile_user_contact_declines_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)
+);
+
+-- name: backfill-contact-declines
+INSERT IGNORE INTO mobile_user_contact_declines (user_id, msisdn, declined_at)
+    SELECT user_id, msisdn, COALESCE(responded_at, NOW()) FROM mobile_user_contacts WHERE status = 'declined';
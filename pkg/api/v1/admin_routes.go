@@ -0,0 +1,207 @@
+package v1
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// AdminAuthConfig holds the settings of sign-in to the admin API. Accounts
+// are locked for Lockout after MaxFailedLogins failed sign-ins in a row.
+type AdminAuthConfig struct {
+	MaxFailedLogins int
+	Lockout         time.Duration
+}
+
+// AdminSessionResponse is the response payload sent to
+// clients when staff sign in to the admin API
+type AdminSessionResponse struct {
+	Data      interface{} `json:"data"`
+	AuthToken string      `json:"authToken"`
+	ExpiresIn int64       `json:"expiresIn"`
+	Info      string      `json:"info"`
+}
+
+// adminLogin signs staff in to the admin API with the username and password
+// of their account. Unknown usernames and wrong passwords are answered alike,
+// so that the usernames of accounts cannot be probed.
+func adminLogin(store db.Store, tokens *auth.TokenService, cfg AdminAuthConfig, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
+			return
+		}
+
+		payload.Username = strings.TrimSpace(payload.Username)
+
+		errRes := NewErrorResponse("Missing values for required parameters")
+		if len(payload.Username) == 0 {
+			errRes.AddError(NewMissingParamError("username"))
+		}
+
+		if len(payload.Password) == 0 {
+			errRes.AddError(NewMissingParamError("password"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		repo := store.UserAccounts()
+		account, err := repo.GetByUsername(r.Context(), payload.Username)
+		if err != nil {
+			logger.Error("failed fetching user account from db", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if account == nil || !account.IsAdmin {
+			auth.CheckPassword("", payload.Password)
+			renderUnauthorized(w, NewUnauthorizedResponse("Username or password is incorrect"))
+			return
+		}
+
+		now := time.Now()
+		if account.IsLocked(now) {
+			renderAccountLocked(w, account.LockedUntil.Time.Sub(now))
+			return
+		}
+
+		if !auth.CheckPassword(account.Password, payload.Password) {
+			lockUntil := now.Add(cfg.Lockout)
+			err := repo.RecordFailedLogin(r.Context(), account.ID, cfg.MaxFailedLogins, lockUntil)
+			if err != nil {
+				logger.Error("failed recording failed sign-in", zap.Int("accountId", account.ID), zap.Error(err))
+			}
+
+			if account.FailedLogins+1 >= cfg.MaxFailedLogins {
+				logger.Warn("locked admin account after failed sign-ins", zap.Int("accountId", account.ID))
+				renderAccountLocked(w, cfg.Lockout)
+				return
+			}
+
+			renderUnauthorized(w, NewUnauthorizedResponse("Username or password is incorrect"))
+			return
+		}
+
+		token, err := tokens.IssueAdminToken(account.ID, account.Username, account.Role)
+		if err != nil {
+			logger.Error("failed issuing admin token", zap.Int("accountId", account.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		err = repo.RecordLogin(r.Context(), account.ID)
+		if err != nil {
+			logger.Error("failed recording sign-in", zap.Int("accountId", account.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		// passwords hashed with a lower cost are upgraded while the
+		// password is at hand; failing to do so does not fail sign-in
+		if auth.PasswordNeedsRehash(account.Password) {
+			hash, err := auth.HashPassword(payload.Password)
+			if err == nil {
+				err = repo.SetPassword(r.Context(), account.ID, hash)
+			}
+
+			if err != nil {
+				logger.Warn("failed rehashing password", zap.Int("accountId", account.ID), zap.Error(err))
+			}
+		}
+
+		account.FailedLogins = 0
+		account.LockedUntil = db.NullableTime{}
+		account.LastLoginAt = db.NewNullableTime(now)
+
+		renderData(w, AdminSessionResponse{
+			Data:      account,
+			AuthToken: token,
+			ExpiresIn: int64(tokens.AdminTTL().Seconds()),
+			Info:      "Signed in successfully",
+		})
+	}
+}
+
+// getAdminAccount returns the account of the authenticated staff member
+func getAdminAccount(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := mustPrincipal(r)
+
+		account, err := store.UserAccounts().GetByID(r.Context(), principal.UserID)
+		if err != nil {
+			logger.Error("failed fetching user account from db", zap.Int("accountId", principal.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if account == nil || !account.IsAdmin {
+			renderNotFound(w, NewNotFoundResponse("Account does not exist"))
+			return
+		}
+
+		renderData(w, OkResponse{Data: account})
+	}
+}
+
+// renderAccountLocked responds to a sign-in to an
+// account that is locked for retryAfter
+func renderAccountLocked(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+
+	errRes := NewErrorResponse("Too many failed sign-ins. Please try again later")
+	errRes.AddError(Error{Code: ErrCodeAccountLocked, Message: "account is temporarily locked"})
+	renderJSON(w, http.StatusTooManyRequests, errRes)
+}
+
+func adminRoutes(store db.Store, tokens *auth.TokenService, cfg AdminAuthConfig, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Post("/login", adminLogin(store, tokens, cfg, logger))
+
+	router.Group(func(router chi.Router) {
+		router.Use(AuthenticateAdmin(store, tokens, logger))
+		router.Use(RequireRole(auth.RoleViewer))
+
+		router.Get("/me", getAdminAccount(store, logger))
+		router.Get("/users", searchMobileUsers(store, logger))
+		router.Get("/users/{userID}", getMobileUserDetails(store, logger))
+		router.Get("/profiles", getAllUserProfiles(store, logger))
+		router.Get("/contacts", getAllContacts(store, logger))
+
+		router.Group(func(router chi.Router) {
+			router.Use(RequireRole(auth.RoleDispatcher))
+
+			router.Post("/users/{userID}/suspend", suspendMobileUser(store, true, logger))
+			router.Post("/users/{userID}/unsuspend", suspendMobileUser(store, false, logger))
+			router.Post("/users/{userID}/logout", logoutMobileUser(store, logger))
+		})
+
+		router.Group(func(router chi.Router) {
+			router.Use(RequireRole(auth.RoleSuperadmin))
+
+			router.Put("/users/{userID}/responder", setMobileUserResponder(store, true, logger))
+			router.Delete("/users/{userID}/responder", setMobileUserResponder(store, false, logger))
+			router.Delete("/users/{userID}", deleteMobileUser(store, logger))
+		})
+	})
+
+	return router
+}
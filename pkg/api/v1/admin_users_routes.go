@@ -0,0 +1,293 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// PageResponse is the response payload sent to clients
+// for a page of a list of resources
+type PageResponse struct {
+	Data    interface{} `json:"data"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"perPage"`
+	Total   int         `json:"total"`
+}
+
+// MobileUserDetails is a mobile user with all their records,
+// as viewed by operations staff
+type MobileUserDetails struct {
+	User      *db.MobileUser    `json:"user"`
+	Profile   *db.UserProfile   `json:"profile"`
+	Responder bool              `json:"responder"`
+	Contacts  []*db.UserContact `json:"contacts"`
+	Devices   []*db.DeviceToken `json:"devices"`
+	Alerts    []*db.Alert       `json:"alerts"`
+}
+
+// parsePage parses the page and perPage query params of r, which
+// default to the first page of defaultPerPage items
+func parsePage(r *http.Request, errRes *ErrorResponse) (int, int) {
+	page, perPage := 1, defaultPerPage
+	query := r.URL.Query()
+
+	if v := query.Get("page"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			errRes.AddError(NewInvalidParamError("page", "must be a positive number"))
+		} else {
+			page = n
+		}
+	}
+
+	if v := query.Get("perPage"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPerPage {
+			errRes.AddError(NewInvalidParamError("perPage", "must be a number from 1 to "+strconv.Itoa(maxPerPage)))
+		} else {
+			perPage = n
+		}
+	}
+
+	return page, perPage
+}
+
+// searchMobileUsers lists the mobile users whose msisdn or profile
+// name contains the q query param, newest first, a page at a time
+func searchMobileUsers(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		errRes := NewErrorResponse("Invalid values for parameters")
+		page, perPage := parsePage(r, errRes)
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		users, total, err := store.MobileUsers().Search(r.Context(), query, perPage, (page-1)*perPage)
+		if err != nil {
+			logger.Error("failed searching mobile users in db", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, PageResponse{
+			Data:    users,
+			Page:    page,
+			PerPage: perPage,
+			Total:   total,
+		})
+	}
+}
+
+// getMobileUserDetails returns a mobile user with their profile,
+// contacts, devices and the alerts they raised
+func getMobileUserDetails(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadMobileUser(w, r, store, logger)
+		if !ok {
+			return
+		}
+
+		details := MobileUserDetails{User: user}
+		var err error
+
+		details.Profile, err = store.UserProfiles().GetByUserID(r.Context(), user.ID)
+		if err == nil {
+			details.Contacts, err = store.UserContacts().GetUserContacts(r.Context(), user.ID)
+		}
+
+		if err == nil {
+			details.Devices, err = store.DeviceTokens().GetUserTokens(r.Context(), user.ID)
+		}
+
+		if err == nil {
+			details.Alerts, err = store.Alerts().GetUserAlerts(r.Context(), user.ID)
+		}
+
+		if details.Profile != nil {
+			details.Responder = details.Profile.Responder
+		}
+
+		if err != nil {
+			logger.Error("failed fetching records of mobile user from db", zap.Int("userId", user.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{Data: details})
+	}
+}
+
+// suspendMobileUser suspends a mobile user, or lifts their suspension when
+// suspend is false. Suspended users cannot sign in or use their sessions.
+func suspendMobileUser(store db.Store, suspend bool, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadMobileUser(w, r, store, logger)
+		if !ok {
+			return
+		}
+
+		repo := store.MobileUsers()
+		info := "User suspended successfully"
+
+		var err error
+		if suspend {
+			err = repo.Suspend(r.Context(), user.ID)
+		} else {
+			err = repo.Unsuspend(r.Context(), user.ID)
+			info = "User unsuspended successfully"
+		}
+
+		if err != nil {
+			logger.Error("failed updating suspension of mobile user", zap.Int("userId", user.ID), zap.Bool("suspend", suspend), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		logger.Info("updated suspension of mobile user",
+			zap.Int("userId", user.ID),
+			zap.Bool("suspend", suspend),
+			zap.String("by", mustPrincipal(r).Username),
+		)
+
+		user, err = repo.GetByID(r.Context(), user.ID)
+		if err != nil {
+			logger.Error("failed fetching user from db", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{Data: user, Info: info})
+	}
+}
+
+// logoutMobileUser ends every session of a mobile user
+// on all their devices
+func logoutMobileUser(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadMobileUser(w, r, store, logger)
+		if !ok {
+			return
+		}
+
+		err := store.RefreshTokens().RevokeUser(r.Context(), user.ID)
+		if err == nil {
+			err = store.MobileUsers().RevokeSessions(r.Context(), user.ID, time.Now())
+		}
+
+		if err != nil {
+			logger.Error("failed revoking sessions of mobile user", zap.Int("userId", user.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		logger.Info("signed mobile user out everywhere", zap.Int("userId", user.ID), zap.String("by", mustPrincipal(r).Username))
+		renderData(w, OkResponse{Info: "User signed out of all devices successfully"})
+	}
+}
+
+// setMobileUserResponder makes a mobile user a responder, or stops them
+// being one when responder is false. Responders may act on any alert and
+// follow the alerts raised near them, so only admins can grant it.
+func setMobileUserResponder(store db.Store, responder bool, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadMobileUser(w, r, store, logger)
+		if !ok {
+			return
+		}
+
+		repo := store.UserProfiles()
+		profile, err := repo.GetByUserID(r.Context(), user.ID)
+		if err != nil {
+			logger.Error("failed fetching user profile from db", zap.Int("userId", user.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if profile == nil {
+			renderNotFound(w, NewNotFoundResponse("User has not created a profile"))
+			return
+		}
+
+		err = repo.SetResponder(r.Context(), user.ID, responder)
+		if err != nil {
+			logger.Error("failed updating responder of mobile user", zap.Int("userId", user.ID), zap.Bool("responder", responder), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		logger.Info("updated responder of mobile user",
+			zap.Int("userId", user.ID),
+			zap.Bool("responder", responder),
+			zap.String("by", mustPrincipal(r).Username),
+		)
+
+		info := "User made a responder successfully"
+		if !responder {
+			info = "User is no longer a responder"
+		}
+
+		renderData(w, OkResponse{Info: info})
+	}
+}
+
+// deleteMobileUser permanently deletes a mobile user and all their records
+func deleteMobileUser(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadMobileUser(w, r, store, logger)
+		if !ok {
+			return
+		}
+
+		deleted, err := store.MobileUsers().Delete(r.Context(), user.ID)
+		if err != nil {
+			logger.Error("failed deleting mobile user", zap.Int("userId", user.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if !deleted {
+			renderNotFound(w, NewNotFoundResponse("User does not exist"))
+			return
+		}
+
+		logger.Info("deleted mobile user", zap.Int("userId", user.ID), zap.String("by", mustPrincipal(r).Username))
+		renderData(w, OkResponse{Info: "User deleted successfully"})
+	}
+}
+
+// loadMobileUser fetches the mobile user whose ID is in the path of r. It
+// responds with Not Found when there is no such user.
+func loadMobileUser(w http.ResponseWriter, r *http.Request, store db.Store, logger *zap.Logger) (*db.MobileUser, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		renderNotFound(w, NewNotFoundResponse("User does not exist"))
+		return nil, false
+	}
+
+	user, err := store.MobileUsers().GetByID(r.Context(), id)
+	if err != nil {
+		logger.Error("failed fetching user from db", zap.Int("userId", id), zap.Error(err))
+		renderInternalServerError(w, NewInternalServerErrorResponse(err))
+		return nil, false
+	}
+
+	if user == nil {
+		renderNotFound(w, NewNotFoundResponse("User does not exist"))
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,347 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/notify"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"go.uber.org/zap"
+)
+
+const maxAlertMessageLength = 1024
+
+func raiseAlert(ctx context.Context, store db.Store, notifier notify.AlertNotifier, events stream.Broker, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			GeoLat   *float64 `json:"geoLat"`
+			GeoLng   *float64 `json:"geoLng"`
+			Accuracy float64  `json:"accuracy"`
+			Category string   `json:"category"`
+			Message  string   `json:"message"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
+			return
+		}
+
+		errRes := NewErrorResponse("Missing values for required parameters")
+		if payload.GeoLat == nil {
+			errRes.AddError(NewMissingParamError("geoLat"))
+		}
+
+		if payload.GeoLng == nil {
+			errRes.AddError(NewMissingParamError("geoLng"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		category := strings.ToLower(strings.TrimSpace(payload.Category))
+		if len(category) == 0 {
+			category = db.AlertCategoryGeneral
+		}
+
+		location := db.Coordinate{Lat: *payload.GeoLat, Lng: *payload.GeoLng}
+
+		errRes = NewErrorResponse("Invalid values for parameters")
+		errRes.AddCoordinateErrors(location)
+
+		if payload.Accuracy < 0 {
+			errRes.AddError(NewInvalidParamError("accuracy", "must not be negative"))
+		}
+
+		if !db.IsAlertCategory(category) {
+			errRes.AddError(NewInvalidParamError("category", "is not a known alert category"))
+		}
+
+		if len(payload.Message) > maxAlertMessageLength {
+			errRes.AddError(NewInvalidParamError("message", "must not be longer than 1024 characters"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		principal := mustPrincipal(r)
+		repo := store.Alerts()
+		alert, err := repo.Create(r.Context(), &db.Alert{
+			UserID:     principal.UserID,
+			Coordinate: location,
+			Accuracy:   payload.Accuracy,
+			Category:   category,
+			Message:    strings.TrimSpace(payload.Message),
+		})
+		if err != nil {
+			logger.Error("failed saving alert into db", zap.Int("userId", principal.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		events.Publish(stream.EventAlertCreated, alert)
+
+		// contacts are notified in the background so that the user learns
+		// their alert was raised without waiting for every notification,
+		// which must not be cut short when the request ends, only when
+		// the server shuts down
+		go func(alert db.Alert) {
+			err := notifier.AlertRaised(ctx, &alert)
+			if err != nil {
+				logger.Error("failed notifying contacts of alert", zap.Int("alertId", alert.ID), zap.Error(err))
+			}
+		}(*alert)
+
+		renderJSON(w, http.StatusCreated, OkResponse{
+			Data: alert,
+			Info: "Alert raised successfully",
+		})
+	}
+}
+
+func getUserAlerts(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mustPrincipal(r).UserID
+
+		repo := store.Alerts()
+		alerts, err := repo.GetUserAlerts(r.Context(), userID)
+		if err != nil {
+			logger.Error("failed fetching user alerts from db", zap.Int("userId", userID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{Data: alerts})
+	}
+}
+
+func getAlert(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		repo := store.Alerts()
+		alert, ok := loadUserAlert(w, r, repo, logger)
+		if !ok {
+			return
+		}
+
+		history, err := repo.GetHistory(r.Context(), alert.ID)
+		if err != nil {
+			logger.Error("failed fetching alert history from db", zap.Int("alertId", alert.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{
+			Data: struct {
+				*db.Alert
+				History []*db.AlertEvent `json:"history"`
+			}{
+				Alert:   alert,
+				History: history,
+			},
+		})
+	}
+}
+
+// ownerStatuses are the statuses the user who raised an alert may move it
+// to, and responderStatuses those other users who respond to it may
+var (
+	ownerStatuses = map[string]bool{
+		db.AlertStatusResolved:   true,
+		db.AlertStatusCanceled:   true,
+		db.AlertStatusFalseAlarm: true,
+	}
+	responderStatuses = map[string]bool{
+		db.AlertStatusAcknowledged: true,
+		db.AlertStatusEnRoute:      true,
+		db.AlertStatusResolved:     true,
+		db.AlertStatusFalseAlarm:   true,
+	}
+)
+
+// updateAlertStatus moves an alert to status, e.g. when the user who raised
+// it cancels it or a responder acknowledges it. Transitions the alert's
+// current status does not allow are rejected with Conflict.
+func updateAlertStatus(store db.Store, events stream.Broker, status, info string, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			Note string `json:"note"`
+		}{}
+
+		// the note is optional, so requests may not have a body at all
+		if r.ContentLength != 0 {
+			err := json.NewDecoder(r.Body).Decode(&payload)
+			if err != nil {
+				renderBadRequest(w, NewInvalidPayloadResponse(err))
+				return
+			}
+		}
+
+		if len(payload.Note) > maxAlertMessageLength {
+			errRes := NewErrorResponse("Invalid values for parameters")
+			errRes.AddError(NewInvalidParamError("note", "must not be longer than 1024 characters"))
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		principal := mustPrincipal(r)
+		repo := store.Alerts()
+		alert, ok := loadAlert(w, r, repo, logger)
+		if !ok {
+			return
+		}
+
+		if alert.UserID == principal.UserID {
+			if !ownerStatuses[status] {
+				renderForbidden(w, NewForbiddenResponse("The user who raised an alert cannot move it to "+status))
+				return
+			}
+		} else {
+			allowed := false
+			if responderStatuses[status] {
+				var err error
+				allowed, err = canRespond(r.Context(), store, principal, alert)
+				if err != nil {
+					logger.Error("failed checking alert responder", zap.Int("alertId", alert.ID), zap.Int("userId", principal.UserID), zap.Error(err))
+					renderInternalServerError(w, NewInternalServerErrorResponse(err))
+					return
+				}
+			}
+
+			// alerts users cannot act on are hidden from them, as in loadUserAlert
+			if !allowed {
+				renderNotFound(w, NewNotFoundResponse("Alert does not exist"))
+				return
+			}
+		}
+
+		updated, err := repo.Transition(r.Context(), alert.ID, status, strings.TrimSpace(payload.Note), principal.UserID)
+		if err != nil {
+			logger.Error("failed updating alert status", zap.Int("alertId", alert.ID), zap.String("status", status), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if !updated {
+			renderConflict(w, NewConflictResponse(fmt.Sprintf("Alerts that are %s cannot move to %s", alert.Status, status)))
+			return
+		}
+
+		id := alert.ID
+		alert, err = repo.GetByID(r.Context(), id)
+		if err != nil {
+			logger.Error("failed fetching alert from db", zap.Int("alertId", id), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if alert != nil {
+			events.Publish(stream.EventFor(status), alert)
+		}
+
+		renderData(w, OkResponse{Data: alert, Info: info})
+	}
+}
+
+// canRespond reports whether principal may respond to alert. Responders may
+// respond to any alert, and other users to the alerts of the users who made
+// them an emergency contact, once they accepted to be one.
+func canRespond(ctx context.Context, store db.Store, principal *auth.Principal, alert *db.Alert) (bool, error) {
+	profile, err := store.UserProfiles().GetByUserID(ctx, principal.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	if profile != nil && profile.Responder {
+		return true, nil
+	}
+
+	contacts, err := store.UserContacts().GetUserContacts(ctx, alert.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, contact := range contacts {
+		if contact.Msisdn == principal.Msisdn && contact.Status == db.ContactStatusAccepted {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// loadAlert fetches the alert whose ID is in the path of r. It responds
+// with Not Found when there is no such alert.
+func loadAlert(w http.ResponseWriter, r *http.Request, repo db.Alerts, logger *zap.Logger) (*db.Alert, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "alertID"))
+	if err != nil {
+		renderNotFound(w, NewNotFoundResponse("Alert does not exist"))
+		return nil, false
+	}
+
+	alert, err := repo.GetByID(r.Context(), id)
+	if err != nil {
+		logger.Error("failed fetching alert from db", zap.Int("alertId", id), zap.Error(err))
+		renderInternalServerError(w, NewInternalServerErrorResponse(err))
+		return nil, false
+	}
+
+	if alert == nil {
+		renderNotFound(w, NewNotFoundResponse("Alert does not exist"))
+		return nil, false
+	}
+
+	return alert, true
+}
+
+// loadUserAlert fetches the alert whose ID is in the path of r. It responds
+// with Not Found when there is no such alert or it belongs to another user,
+// so that the IDs of other users' alerts cannot be probed.
+func loadUserAlert(w http.ResponseWriter, r *http.Request, repo db.Alerts, logger *zap.Logger) (*db.Alert, bool) {
+	alert, ok := loadAlert(w, r, repo, logger)
+	if !ok {
+		return nil, false
+	}
+
+	if alert.UserID != mustPrincipal(r).UserID {
+		renderNotFound(w, NewNotFoundResponse("Alert does not exist"))
+		return nil, false
+	}
+
+	return alert, true
+}
+
+func alertsRoutes(
+	ctx context.Context,
+	store db.Store,
+	notifier notify.AlertNotifier,
+	events stream.Broker,
+	streamCfg stream.ConnConfig,
+	tokens *auth.TokenService,
+	logger *zap.Logger,
+) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(Authenticate(store, tokens, logger))
+
+	router.Post("/", raiseAlert(ctx, store, notifier, events, logger))
+	router.Get("/", getUserAlerts(store, logger))
+	router.Get("/stream", streamAlerts(store, events, streamCfg, logger))
+	router.Get("/{alertID}", getAlert(store, logger))
+	router.Post("/{alertID}/acknowledge", updateAlertStatus(store, events, db.AlertStatusAcknowledged, "Alert acknowledged successfully", logger))
+	router.Post("/{alertID}/en-route", updateAlertStatus(store, events, db.AlertStatusEnRoute, "Alert marked as en route successfully", logger))
+	router.Post("/{alertID}/resolve", updateAlertStatus(store, events, db.AlertStatusResolved, "Alert resolved successfully", logger))
+	router.Post("/{alertID}/cancel", updateAlertStatus(store, events, db.AlertStatusCanceled, "Alert canceled successfully", logger))
+	router.Post("/{alertID}/false-alarm", updateAlertStatus(store, events, db.AlertStatusFalseAlarm, "Alert marked as a false alarm successfully", logger))
+
+	return router
+}
@@ -0,0 +1,28 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"go.uber.org/zap"
+)
+
+func TestAcknowledgeAlert_ShouldNotLetPendingContactsRespond(t *testing.T) {
+	store := newTestStore()
+	store.alerts.byID[5] = &db.Alert{ID: 5, UserID: 9, Status: db.AlertStatusRaised}
+	store.contacts.contacts = []*db.UserContact{
+		{ID: 1, UserID: 9, Msisdn: "+233200662782", Status: db.ContactStatusPending},
+	}
+	tokens := newTestTokens(t)
+	logger := zap.NewNop()
+
+	alerts := alertsRoutes(context.Background(), store, nil, stream.NewHub(stream.HubConfig{}), stream.ConnConfig{}, tokens, logger)
+
+	w := serve(t, alerts, tokens, 7, http.MethodPost, "/5/acknowledge", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 acknowledging an alert as a pending contact, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,241 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// SessionResponse is the response payload sent to clients when a user
+// signs in or renews their access token
+type SessionResponse struct {
+	Data         interface{} `json:"data"`
+	AuthToken    string      `json:"authToken"`
+	RefreshToken string      `json:"refreshToken"`
+	ExpiresIn    int64       `json:"expiresIn"`
+	Info         string      `json:"info"`
+}
+
+// startSession issues an access token and a refresh token bound to deviceID
+// for user. An empty familyID starts a new token family.
+func startSession(
+	ctx context.Context,
+	repo db.RefreshTokens,
+	tokens *auth.TokenService,
+	user *db.MobileUser,
+	deviceID string,
+	familyID string,
+) (*SessionResponse, error) {
+	accessToken, err := tokens.IssueAccessToken(user.ID, user.Msisdn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(familyID) == 0 {
+		familyID, err = auth.NewTokenFamilyID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshToken, err := tokens.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = repo.Create(ctx, &db.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		DeviceID:  deviceID,
+		TokenHash: refreshToken.Hash,
+		ExpiresAt: refreshToken.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionResponse{
+		Data:         user,
+		AuthToken:    accessToken,
+		RefreshToken: refreshToken.Token,
+		ExpiresIn:    int64(tokens.TTL().Seconds()),
+	}, nil
+}
+
+func refreshSession(store db.Store, tokens *auth.TokenService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			RefreshToken string `json:"refreshToken"`
+			DeviceID     string `json:"deviceId"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
+			return
+		}
+
+		errRes := NewErrorResponse("Missing values for required parameters")
+		if len(payload.RefreshToken) == 0 {
+			errRes.AddError(NewMissingParamError("refreshToken"))
+		}
+
+		if len(payload.DeviceID) == 0 {
+			errRes.AddError(NewMissingParamError("deviceId"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		repo := store.RefreshTokens()
+		current, err := repo.GetByHash(r.Context(), auth.HashOpaqueToken(payload.RefreshToken))
+		if err != nil {
+			logger.Error("failed fetching refresh token from db", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if current == nil || current.RevokedAt.Valid || current.ExpiresAt.Before(time.Now()) {
+			renderUnauthorized(w, NewUnauthorizedResponse("Refresh token is invalid or has expired"))
+			return
+		}
+
+		// A refresh token that has already been rotated, or that is presented by
+		// another device, has most likely been stolen. Every token descended from
+		// the same sign-in is revoked so that neither party can keep using it.
+		if current.UsedAt.Valid || current.DeviceID != payload.DeviceID {
+			logger.Warn("refresh token reuse detected, revoking token family",
+				zap.Int("userId", current.UserID),
+				zap.String("familyId", current.FamilyID),
+				zap.String("deviceId", payload.DeviceID),
+			)
+
+			if err := repo.RevokeFamily(r.Context(), current.FamilyID); err != nil {
+				logger.Error("failed revoking refresh token family", zap.String("familyId", current.FamilyID), zap.Error(err))
+			}
+
+			renderUnauthorized(w, NewUnauthorizedResponse("Refresh token is invalid or has expired"))
+			return
+		}
+
+		ok, err := repo.MarkUsed(r.Context(), current.ID)
+		if err != nil {
+			logger.Error("failed marking refresh token as used", zap.Int("id", current.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if !ok {
+			if err := repo.RevokeFamily(r.Context(), current.FamilyID); err != nil {
+				logger.Error("failed revoking refresh token family", zap.String("familyId", current.FamilyID), zap.Error(err))
+			}
+
+			renderUnauthorized(w, NewUnauthorizedResponse("Refresh token is invalid or has expired"))
+			return
+		}
+
+		user, err := store.MobileUsers().GetByID(r.Context(), current.UserID)
+		if err != nil {
+			logger.Error("failed fetching user from db", zap.Int("userId", current.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if user == nil {
+			renderUnauthorized(w, NewUnauthorizedResponse("Refresh token is invalid or has expired"))
+			return
+		}
+
+		if user.IsSuspended() {
+			renderAccountSuspended(w)
+			return
+		}
+
+		session, err := startSession(r.Context(), repo, tokens, user, current.DeviceID, current.FamilyID)
+		if err != nil {
+			logger.Error("failed issuing tokens for user", zap.Int("userId", user.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		session.Info = "Session renewed successfully"
+		renderData(w, session)
+	}
+}
+
+func logout(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			RefreshToken string `json:"refreshToken"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
+			return
+		}
+
+		errRes := NewErrorResponse("Missing values for required parameters")
+		if len(payload.RefreshToken) == 0 {
+			errRes.AddError(NewMissingParamError("refreshToken"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		repo := store.RefreshTokens()
+		current, err := repo.GetByHash(r.Context(), auth.HashOpaqueToken(payload.RefreshToken))
+		if err != nil {
+			logger.Error("failed fetching refresh token from db", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		// logging out is idempotent, so unknown tokens are not reported as errors
+		if current != nil {
+			err = repo.RevokeDevice(r.Context(), current.UserID, current.DeviceID)
+			if err != nil {
+				logger.Error("failed revoking device refresh tokens",
+					zap.Int("userId", current.UserID),
+					zap.String("deviceId", current.DeviceID),
+					zap.Error(err),
+				)
+				renderInternalServerError(w, NewInternalServerErrorResponse(err))
+				return
+			}
+
+			// a signed out device must not receive the user's notifications
+			_, err = store.DeviceTokens().Unregister(r.Context(), current.UserID, current.DeviceID)
+			if err != nil {
+				logger.Error("failed deleting device token from db",
+					zap.Int("userId", current.UserID),
+					zap.String("deviceId", current.DeviceID),
+					zap.Error(err),
+				)
+				renderInternalServerError(w, NewInternalServerErrorResponse(err))
+				return
+			}
+		}
+
+		renderData(w, OkResponse{Info: "Signed out successfully"})
+	}
+}
+
+func authRoutes(store db.Store, tokens *auth.TokenService, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Post("/refresh", refreshSession(store, tokens, logger))
+	router.Post("/logout", logout(store, logger))
+
+	return router
+}
@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// registerDevice registers or refreshes the push token of a device of
+// the authenticated user
+func registerDevice(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			Platform string `json:"platform"`
+			Token    string `json:"token"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
+			return
+		}
+
+		payload.Platform = strings.ToLower(strings.TrimSpace(payload.Platform))
+		payload.Token = strings.TrimSpace(payload.Token)
+
+		errRes := NewErrorResponse("Missing values for required parameters")
+		if len(payload.Platform) == 0 {
+			errRes.AddError(NewMissingParamError("platform"))
+		}
+
+		if len(payload.Token) == 0 {
+			errRes.AddError(NewMissingParamError("token"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		errRes = NewErrorResponse("Invalid values for parameters")
+		if !db.IsPlatform(payload.Platform) {
+			errRes.AddError(NewInvalidParamError("platform", "must be one of fcm or apns"))
+		}
+
+		if len(payload.Token) > 255 {
+			errRes.AddError(NewInvalidParamError("token", "must not be longer than 255 characters"))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		principal := mustPrincipal(r)
+		deviceID := chi.URLParam(r, "deviceID")
+
+		repo := store.DeviceTokens()
+		token, err := repo.Register(r.Context(), &db.DeviceToken{
+			UserID:   principal.UserID,
+			DeviceID: deviceID,
+			Platform: payload.Platform,
+			Token:    payload.Token,
+		})
+		if err != nil {
+			logger.Error("failed saving device token into db",
+				zap.Int("userId", principal.UserID),
+				zap.String("deviceId", deviceID),
+				zap.Error(err),
+			)
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{Data: token, Info: "Device registered successfully"})
+	}
+}
+
+func getUserDevices(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mustPrincipal(r).UserID
+
+		repo := store.DeviceTokens()
+		tokens, err := repo.GetUserTokens(r.Context(), userID)
+		if err != nil {
+			logger.Error("failed fetching device tokens from db", zap.Int("userId", userID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{Data: tokens})
+	}
+}
+
+func unregisterDevice(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mustPrincipal(r).UserID
+		deviceID := chi.URLParam(r, "deviceID")
+
+		repo := store.DeviceTokens()
+		ok, err := repo.Unregister(r.Context(), userID, deviceID)
+		if err != nil {
+			logger.Error("failed deleting device token from db",
+				zap.Int("userId", userID),
+				zap.String("deviceId", deviceID),
+				zap.Error(err),
+			)
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if !ok {
+			renderNotFound(w, NewNotFoundResponse("Device is not registered"))
+			return
+		}
+
+		renderData(w, OkResponse{Info: "Device unregistered successfully"})
+	}
+}
+
+func devicesRoutes(store db.Store, tokens *auth.TokenService, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(Authenticate(store, tokens, logger))
+
+	router.Get("/", getUserDevices(store, logger))
+	router.Put("/{deviceID}", registerDevice(store, logger))
+	router.Delete("/{deviceID}", unregisterDevice(store, logger))
+
+	return router
+}
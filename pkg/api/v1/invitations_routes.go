@@ -0,0 +1,163 @@
+package v1
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// invitationPage is the page contacts land on when they follow the link of
+// their invitation. It is plain HTML so that contacts can respond without
+// installing the app.
+var invitationPage = template.Must(template.New("invitation").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Hoodcops emergency contact</title>
+</head>
+<body>
+{{if .Invalid}}
+<p>This invitation link is invalid or has been replaced by a newer one.</p>
+{{else}}
+<p>{{.Name}} added you as an emergency contact on Hoodcops. Emergency contacts get an SMS when the person who added them raises an alert.</p>
+{{if eq .Status "accepted"}}<p>You agreed to be their emergency contact.</p>{{end}}
+{{if eq .Status "declined"}}<p>You declined to be their emergency contact. You will not get their alerts.</p>{{end}}
+{{if ne .Status "accepted"}}<form method="post"><input type="hidden" name="response" value="accepted"><button type="submit">Accept</button></form>{{end}}
+{{if ne .Status "declined"}}<form method="post"><input type="hidden" name="response" value="declined"><button type="submit">Decline</button></form>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// invitationView is the data invitationPage is rendered with
+type invitationView struct {
+	Invalid bool
+	Name    string
+	Status  string
+}
+
+func showInvitation(store db.Store, tokens *auth.TokenService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contact, ok := loadInvitation(w, r, store, tokens, logger)
+		if !ok {
+			return
+		}
+
+		renderInvitation(w, r, store, contact, logger)
+	}
+}
+
+func respondToInvitation(store db.Store, tokens *auth.TokenService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contact, ok := loadInvitation(w, r, store, tokens, logger)
+		if !ok {
+			return
+		}
+
+		response := r.PostFormValue("response")
+		if response != db.ContactStatusAccepted && response != db.ContactStatusDeclined {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		err := store.UserContacts().Respond(r.Context(), contact.ID, response)
+		if err != nil {
+			logger.Error("failed saving response to contact invitation", zap.Int("contactId", contact.ID), zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("contact responded to invitation", zap.Int("contactId", contact.ID), zap.String("response", response))
+
+		contact.Status = response
+		renderInvitation(w, r, store, contact, logger)
+	}
+}
+
+// loadInvitation fetches the contact the invitation token in the path of r
+// was issued for. It responds with an invalid invitation page when the
+// token is not valid, including when the contact was invited again since.
+func loadInvitation(w http.ResponseWriter, r *http.Request, store db.Store, tokens *auth.TokenService, logger *zap.Logger) (*db.UserContact, bool) {
+	token := chi.URLParam(r, "token")
+	id, err := auth.ParseInviteToken(token)
+	if err != nil {
+		renderInvitationPage(w, http.StatusNotFound, invitationView{Invalid: true}, logger)
+		return nil, false
+	}
+
+	contact, err := store.UserContacts().GetByID(r.Context(), id)
+	if err != nil {
+		logger.Error("failed fetching invited contact from db", zap.Int("contactId", id), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if contact == nil || !contact.InvitedAt.Valid || !tokens.VerifyInviteToken(token, contact.ID, contact.InvitedAt.Time) {
+		renderInvitationPage(w, http.StatusNotFound, invitationView{Invalid: true}, logger)
+		return nil, false
+	}
+
+	return contact, true
+}
+
+// renderInvitation responds with the invitation page of contact
+func renderInvitation(w http.ResponseWriter, r *http.Request, store db.Store, contact *db.UserContact, logger *zap.Logger) {
+	name, err := inviterName(r.Context(), store, contact.UserID)
+	if err != nil {
+		logger.Error("failed fetching name of inviting user", zap.Int("userId", contact.UserID), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	renderInvitationPage(w, http.StatusOK, invitationView{Name: name, Status: contact.Status}, logger)
+}
+
+func renderInvitationPage(w http.ResponseWriter, status int, view invitationView, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	err := invitationPage.Execute(w, view)
+	if err != nil {
+		logger.Error("failed rendering invitation page", zap.Error(err))
+	}
+}
+
+// inviterName returns the name invited contacts know the user with the
+// specified ID by, which is the phone number of users without a profile
+func inviterName(ctx context.Context, store db.Store, userID int) (string, error) {
+	profile, err := store.UserProfiles().GetByUserID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if profile != nil && len(profile.Fullname) > 0 {
+		return profile.Fullname, nil
+	}
+
+	user, err := store.MobileUsers().GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if user == nil {
+		return "Someone", nil
+	}
+
+	return user.Msisdn, nil
+}
+
+func invitationsRoutes(store db.Store, tokens *auth.TokenService, logger *zap.Logger) *chi.Mux {
+	router := chi.NewRouter()
+	router.Get("/{token}", showInvitation(store, tokens, logger))
+	router.Post("/{token}", respondToInvitation(store, tokens, logger))
+
+	return router
+}
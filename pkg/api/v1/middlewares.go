@@ -1,37 +1,159 @@
 package v1
 
 import (
-	"fmt"
+	"net"
 	"net/http"
+	"strings"
 
-	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/pkg/errors"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
 )
 
-// ValidateJWT is a middleware that validates JWT tokens passed in request headers
-// If a token is not present, an Unauthorized access response is sent. However, if
-// a token is present but invalid for some reasons, an Unauthorized access response
-// is sent with explanations into how the issue can be fixed.
-func ValidateJWT(handler http.Handler, secret string) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header["Token"] != nil {
-			token, err := jwt.Parse(r.Header["Token"][0], func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.New("invalid JWT")
+// Authenticate is a middleware that validates the JWT access token passed in the
+// Authorization header as a bearer token. Requests without a valid token are
+// answered with an Unauthorized access response explaining what is wrong with the
+// token. For valid tokens, the authenticated caller is added to the request
+// context, from where handlers retrieve it with auth.PrincipalFromContext.
+// Tokens of users who have been suspended or signed out everywhere since
+// the tokens were issued are rejected.
+func Authenticate(store db.Store, tokens *auth.TokenService, logger *zap.Logger) func(http.Handler) http.Handler {
+	check := func(w http.ResponseWriter, r *http.Request, claims *auth.Claims, principal *auth.Principal) bool {
+		user, err := store.MobileUsers().GetByID(r.Context(), principal.UserID)
+		if err != nil {
+			logger.Error("failed fetching user from db", zap.Int("userId", principal.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return false
+		}
+
+		if user == nil {
+			renderUnauthorized(w, NewUnauthorizedResponse("Access token is invalid"))
+			return false
+		}
+
+		if user.IsSuspended() {
+			renderAccountSuspended(w)
+			return false
+		}
+
+		if user.SessionsRevokedAt.Valid && claims.IssuedAt <= user.SessionsRevokedAt.Time.Unix() {
+			renderUnauthorized(w, NewUnauthorizedResponse("Session has ended. Please sign in again"))
+			return false
+		}
+
+		return true
+	}
+
+	return authenticate(tokens.ParseAccessToken, check, "Access token has expired. Please refresh it and try again", logger)
+}
+
+// AuthenticateAdmin is like Authenticate, but only accepts access tokens
+// issued to admin accounts. The caller is granted the roles of their
+// account's current role, so that changes to it take effect at once.
+func AuthenticateAdmin(store db.Store, tokens *auth.TokenService, logger *zap.Logger) func(http.Handler) http.Handler {
+	check := func(w http.ResponseWriter, r *http.Request, claims *auth.Claims, principal *auth.Principal) bool {
+		account, err := store.UserAccounts().GetByID(r.Context(), principal.UserID)
+		if err != nil {
+			logger.Error("failed fetching user account from db", zap.Int("accountId", principal.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return false
+		}
+
+		if account == nil || !account.IsAdmin {
+			renderUnauthorized(w, NewUnauthorizedResponse("Access token is invalid"))
+			return false
+		}
+
+		principal.Roles = auth.GrantedRoles(account.Role)
+		return true
+	}
+
+	return authenticate(tokens.ParseAdminToken, check, "Access token has expired. Please sign in again", logger)
+}
+
+// sessionCheck validates the session of the caller identified by claims
+// against their current records. It answers the request itself and
+// returns false when the session is no longer valid.
+type sessionCheck func(w http.ResponseWriter, r *http.Request, claims *auth.Claims, principal *auth.Principal) bool
+
+func authenticate(parse func(string) (*auth.Claims, error), check sessionCheck, expiredMessage string, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if len(header) == 0 {
+				renderUnauthorized(w, NewUnauthorizedResponse("Authorization header with a bearer token is required"))
+				return
+			}
+
+			parts := strings.SplitN(header, " ", 2)
+			if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || len(parts[1]) == 0 {
+				renderUnauthorized(w, NewUnauthorizedResponse("Authorization header must have the format 'Bearer <token>'"))
+				return
+			}
+
+			claims, err := parse(parts[1])
+			if err != nil {
+				if err == auth.ErrExpiredToken {
+					renderUnauthorized(w, NewUnauthorizedResponse(expiredMessage))
+					return
 				}
 
-				return secret, nil
-			})
+				logger.Debug("rejected invalid access token", zap.Error(err))
+				renderUnauthorized(w, NewUnauthorizedResponse("Access token is invalid"))
+				return
+			}
 
+			principal, err := claims.Principal()
 			if err != nil {
-				fmt.Fprintf(w, err.Error())
+				renderUnauthorized(w, NewUnauthorizedResponse("Access token is invalid"))
+				return
 			}
 
-			if token.Valid {
-				handler.ServeHTTP(w, r)
+			if !check(w, r, claims, principal) {
+				return
 			}
-		} else {
-			fmt.Fprintf(w, "Unauthorized access")
-		}
-	})
+
+			ctx := auth.ContextWithPrincipal(r.Context(), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole is a middleware that answers requests of callers who have not
+// been granted role with a Forbidden response. It must be mounted behind
+// Authenticate or AuthenticateAdmin.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !mustPrincipal(r).HasRole(role) {
+				renderForbidden(w, NewForbiddenResponse("The "+role+" role is required to access this resource"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// mustPrincipal returns the authenticated caller of r. It must only be called
+// by handlers mounted behind the Authenticate middleware.
+func mustPrincipal(r *http.Request) *auth.Principal {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		panic("v1: handler mounted without the Authenticate middleware")
+	}
+
+	return principal
+}
+
+// clientIP returns the IP address of the client that sent r. Behind a proxy,
+// RemoteAddr only holds the client's address when the server is wrapped in a
+// middleware that rewrites it, like chi's middleware.RealIP.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
 }
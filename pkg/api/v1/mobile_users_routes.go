@@ -1,23 +1,29 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
+	"math"
 	"net/http"
-	"time"
+	"strconv"
 
-	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
 	"github.com/hoodcops/xcore/pkg/db"
-	"github.com/hoodcops/xcore/pkg/twilio"
-	"github.com/jmoiron/sqlx"
+	"github.com/hoodcops/xcore/pkg/notify"
+	"github.com/hoodcops/xcore/pkg/phone"
+	"github.com/hoodcops/xcore/pkg/ratelimit"
+	"github.com/hoodcops/xcore/pkg/verification"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-func startSignIn(verifier *twilio.TwilioVerifier, logger *zap.Logger) http.HandlerFunc {
+func startSignIn(verifier verification.Verifier, limiter *ratelimit.SMSLimiter, region string, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
 			CountryCode string `json:"countryCode"`
 			PhoneNumber string `json:"phoneNumber"`
+			DeviceID    string `json:"deviceId"`
 		}{}
 
 		err := json.NewDecoder(r.Body).Decode(&payload)
@@ -28,10 +34,6 @@ func startSignIn(verifier *twilio.TwilioVerifier, logger *zap.Logger) http.Handl
 		}
 
 		errRes := NewErrorResponse("Missing values for required parameters")
-		if len(payload.CountryCode) == 0 {
-			errRes.AddError(NewMissingParamError("countryCode"))
-		}
-
 		if len(payload.PhoneNumber) == 0 {
 			errRes.AddError(NewMissingParamError("phoneNumber"))
 		}
@@ -41,22 +43,51 @@ func startSignIn(verifier *twilio.TwilioVerifier, logger *zap.Logger) http.Handl
 			return
 		}
 
-		err = verifier.SendCode(payload.CountryCode, payload.PhoneNumber)
+		msisdn, err := phone.ParseWithCallingCode(payload.CountryCode, payload.PhoneNumber, region)
+		if err != nil {
+			renderInvalidPhoneNumber(w, "phoneNumber")
+			return
+		}
+
+		err = limiter.Allow(r.Context(), ratelimit.SMSRequest{
+			Msisdn:   msisdn,
+			IP:       clientIP(r),
+			DeviceID: payload.DeviceID,
+		})
+		if err != nil {
+			logger.Warn("verification code request denied",
+				zap.String("msisdn", msisdn.String()),
+				zap.String("ip", clientIP(r)),
+				zap.Error(err),
+			)
+
+			renderRateLimitError(w, err)
+			return
+		}
+
+		err = verifier.SendCode(r.Context(), msisdn.String())
 		if err != nil {
 			logger.Error("failed sending verification code",
-				zap.String("phone_number", payload.CountryCode+payload.PhoneNumber),
+				zap.String("msisdn", msisdn.String()),
 				zap.Error(err),
 			)
 
-			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			renderVerificationError(w, err)
 			return
 		}
 
-		renderData(w, OkResponse{Data: payload, Info: "Verification code sent successfully"})
+		renderData(w, OkResponse{
+			Data: struct {
+				Msisdn string `json:"msisdn"`
+			}{
+				Msisdn: msisdn.String(),
+			},
+			Info: "Verification code sent successfully",
+		})
 	}
 }
 
-func verifyCode(verifier *twilio.TwilioVerifier, logger *zap.Logger) http.HandlerFunc {
+func verifyCode(store db.Store, verifier verification.Verifier, limiter *ratelimit.Limiter, tokens *auth.TokenService, region string, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
 			CountryCode      string `json:"countryCode"`
@@ -71,10 +102,6 @@ func verifyCode(verifier *twilio.TwilioVerifier, logger *zap.Logger) http.Handle
 		}
 
 		errRes := NewErrorResponse("Missing values for required parameters")
-		if len(payload.CountryCode) == 0 {
-			errRes.AddError(NewMissingParamError("countryCode"))
-		}
-
 		if len(payload.PhoneNumber) == 0 {
 			errRes.AddError(NewMissingParamError("phoneNumber"))
 		}
@@ -88,26 +115,152 @@ func verifyCode(verifier *twilio.TwilioVerifier, logger *zap.Logger) http.Handle
 			return
 		}
 
-		err = verifier.VerifyCode(payload.CountryCode, payload.PhoneNumber, payload.VerificationCode)
+		number, err := phone.ParseWithCallingCode(payload.CountryCode, payload.PhoneNumber, region)
+		if err != nil {
+			renderInvalidPhoneNumber(w, "phoneNumber")
+			return
+		}
+
+		msisdn := number.String()
+		err = limiter.Allow(r.Context(), ratelimit.Request{Subject: msisdn, IP: clientIP(r)})
+		if err != nil {
+			logger.Warn("verification code check denied",
+				zap.String("msisdn", msisdn),
+				zap.String("ip", clientIP(r)),
+				zap.Error(err),
+			)
+
+			lerr, ok := err.(*ratelimit.Error)
+			if !ok {
+				renderInternalServerError(w, NewInternalServerErrorResponse(err))
+				return
+			}
+
+			renderTooManyRequests(w, lerr, ErrCodeVerifyRateLimited, "Too many verification codes were entered. Please try again later")
+			return
+		}
+
+		err = verifier.VerifyCode(r.Context(), msisdn, payload.VerificationCode)
 		if err != nil {
 			logger.Error("failed verifying phone number",
-				zap.String("phone_number", payload.CountryCode+payload.PhoneNumber),
+				zap.String("msisdn", msisdn),
 				zap.String("verification_code", payload.VerificationCode),
 				zap.Error(err),
 			)
 
+			renderVerificationError(w, err)
+			return
+		}
+
+		ticket, err := tokens.NewVerificationTicket()
+		if err != nil {
+			logger.Error("failed generating verification ticket", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		repo := store.VerificationTickets()
+		_, err = repo.Create(r.Context(), &db.VerificationTicket{
+			Msisdn:     msisdn,
+			TicketHash: ticket.Hash,
+			ExpiresAt:  ticket.ExpiresAt,
+		})
+		if err != nil {
+			logger.Error("failed saving verification ticket into db", zap.String("msisdn", msisdn), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{
+			Data: struct {
+				Msisdn             string `json:"msisdn"`
+				VerificationTicket string `json:"verificationTicket"`
+				ExpiresIn          int64  `json:"expiresIn"`
+			}{
+				Msisdn:             msisdn,
+				VerificationTicket: ticket.Token,
+				ExpiresIn:          int64(tokens.TicketTTL().Seconds()),
+			},
+			Info: "Phone number verified successfully",
+		})
+	}
+}
+
+// renderInvalidPhoneNumber responds to a request whose paramName
+// param is not a valid phone number
+func renderInvalidPhoneNumber(w http.ResponseWriter, paramName string) {
+	errRes := NewErrorResponse("Invalid values for parameters")
+	errRes.AddError(NewInvalidPhoneNumberError(paramName))
+	renderBadRequest(w, errRes)
+}
+
+// renderVerificationError responds to a failed phone verification with a
+// status and error code that tell the client what the user can do about it
+func renderVerificationError(w http.ResponseWriter, err error) {
+	var (
+		status  int
+		code    int
+		summary string
+	)
+
+	switch verification.KindOf(err) {
+	case verification.KindInvalidCode:
+		status, code, summary = http.StatusBadRequest, ErrCodeInvalidVerificationCode, "The verification code entered is incorrect"
+	case verification.KindInvalidPhoneNumber:
+		status, code, summary = http.StatusBadRequest, ErrCodeInvalidPhoneNumber, "Verification codes cannot be sent to this phone number"
+	case verification.KindExpiredCode:
+		status, code, summary = http.StatusGone, ErrCodeExpiredVerificationCode, "The verification code has expired. Please request a new one"
+	case verification.KindTooManyAttempts:
+		status, code, summary = http.StatusTooManyRequests, ErrCodeTooManyAttempts, "Too many incorrect codes were entered. Please request a new one"
+	case verification.KindRateLimited:
+		status, code, summary = http.StatusTooManyRequests, ErrCodeVerificationRateLimited, "Too many verification codes were requested. Please try again later"
+	case verification.KindUnavailable:
+		status, code, summary = http.StatusServiceUnavailable, ErrCodeVerificationUnavailable, "Phone verification is currently unavailable. Please try again later"
+	default:
+		renderInternalServerError(w, NewInternalServerErrorResponse(err))
+		return
+	}
+
+	errRes := NewErrorResponse(summary)
+	errRes.AddError(Error{Code: code, Message: err.Error()})
+	renderJSON(w, status, errRes)
+}
+
+// renderRateLimitError responds to a request denied by an SMSLimiter
+func renderRateLimitError(w http.ResponseWriter, err error) {
+	switch err := err.(type) {
+	case *ratelimit.Error:
+		renderTooManyRequests(w, err, ErrCodeSMSRateLimited, "Too many verification codes were requested. Please try again later")
+	default:
+		if err != ratelimit.ErrRegionNotAllowed {
 			renderInternalServerError(w, NewInternalServerErrorResponse(err))
 			return
 		}
 
-		renderData(w, OkResponse{Data: payload, Info: "Phone number verified successfully"})
+		errRes := NewErrorResponse("Verification codes cannot be sent to this country")
+		errRes.AddError(Error{Code: ErrCodeRegionNotAllowed, Message: err.Error()})
+		renderJSON(w, http.StatusForbidden, errRes)
 	}
 }
 
-func createUser(dbConn *sqlx.DB, secretKey string, logger *zap.Logger) http.HandlerFunc {
+// renderTooManyRequests responds to a request denied because a rate limit
+// was exceeded, telling the client when to try again
+func renderTooManyRequests(w http.ResponseWriter, err *ratelimit.Error, code int, summary string) {
+	seconds := int64(math.Ceil(err.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+
+	errRes := NewErrorResponse(summary)
+	errRes.AddError(Error{Code: code, Message: err.Error()})
+	renderJSON(w, http.StatusTooManyRequests, errRes)
+}
+
+func createUser(store db.Store, inviter notify.Inviter, tokens *auth.TokenService, contactsCfg ContactsConfig, region string, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
-			PhoneNumber string `json:"phoneNumber"`
+			VerificationTicket string            `json:"verificationTicket"`
+			DeviceID           string            `json:"deviceId"`
+			Profile            *db.UserProfile   `json:"profile"`
+			Contacts           []*db.UserContact `json:"contacts"`
 		}{}
 
 		err := json.NewDecoder(r.Body).Decode(&payload)
@@ -117,8 +270,12 @@ func createUser(dbConn *sqlx.DB, secretKey string, logger *zap.Logger) http.Hand
 		}
 
 		errRes := NewErrorResponse("Missing values for required parameters")
-		if len(payload.PhoneNumber) == 0 {
-			errRes.AddError(NewMissingParamError("phoneNumber"))
+		if len(payload.VerificationTicket) == 0 {
+			errRes.AddError(NewMissingParamError("verificationTicket"))
+		}
+
+		if len(payload.DeviceID) == 0 {
+			errRes.AddError(NewMissingParamError("deviceId"))
 		}
 
 		if errRes.HasErrors() {
@@ -126,103 +283,143 @@ func createUser(dbConn *sqlx.DB, secretKey string, logger *zap.Logger) http.Hand
 			return
 		}
 
-		repo := db.NewMobileUsersRepo(dbConn)
-		user, err := repo.GetByPhoneNumber(payload.PhoneNumber)
-		if err != nil {
-			logger.Error("failed checking if user already exists in db", zap.String("phoneNumber", payload.PhoneNumber), zap.Error(err))
-			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+		errRes = NewErrorResponse("Invalid values for parameters")
+		if payload.Profile != nil && payload.Profile.Coordinate != nil {
+			errRes.AddCoordinateErrors(*payload.Profile.Coordinate)
+		}
+
+		addContactErrors(errRes, payload.Contacts, region)
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
 			return
 		}
 
-		// user already exists in database
-		if user != nil {
-			token, err := generateToken(user.Msisdn)
+		var (
+			invalidTicket bool
+			suspended     bool
+			created       bool
+			added         []*db.UserContact
+			user          *db.MobileUser
+			session       *SessionResponse
+		)
+
+		// the user, their profile and contacts are saved all together or
+		// not at all, so that a failed sign-up can simply be retried
+		err = store.WithTx(r.Context(), func(tx db.Store) error {
+			invalidTicket, suspended, created, added = false, false, false, nil
+
+			msisdn, err := tx.VerificationTickets().Consume(r.Context(), auth.HashOpaqueToken(payload.VerificationTicket))
 			if err != nil {
-				logger.Error("failed generating JWT for user", zap.String("phoneNumber", user.Msisdn), zap.Error(err))
-				renderInternalServerError(w, NewInternalServerErrorResponse(err))
-				return
+				return errors.Wrap(err, "failed redeeming verification ticket")
 			}
 
-			renderData(w, struct {
-				Data      interface{} `json:"data"`
-				AuthToken string      `json:"authToken"`
-				Info      string      `json:"info"`
-			}{
-				Data:      user,
-				AuthToken: token,
-				Info:      "Welcome back!",
-			})
-			return
-		}
+			if len(msisdn) == 0 {
+				invalidTicket = true
+				return nil
+			}
 
-		user = &db.MobileUser{
-			Msisdn: payload.PhoneNumber,
-		}
+			repo := tx.MobileUsers()
+			user, err = repo.GetByPhoneNumber(r.Context(), msisdn)
+			if err != nil {
+				return errors.Wrap(err, "failed checking if user already exists in db")
+			}
 
-		user, err = repo.Create(user)
-		if err != nil {
-			logger.Error("failed saving user into db", zap.String("phoneNumber", payload.PhoneNumber), zap.Error(err))
-			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			if user != nil && user.IsSuspended() {
+				suspended = true
+				return nil
+			}
+
+			// user does not exist in database yet
+			if user == nil {
+				user, err = repo.Create(r.Context(), &db.MobileUser{Msisdn: msisdn})
+				if err != nil {
+					return errors.Wrap(err, "failed saving user into db")
+				}
+
+				created = true
+				added, err = createSignUpDetails(r.Context(), tx, user.ID, payload.Profile, payload.Contacts, contactsCfg.MaxPerUser)
+				if err != nil {
+					return err
+				}
+			}
+
+			// signing in again on a device ends any session previously started on it
+			refreshTokensRepo := tx.RefreshTokens()
+			err = refreshTokensRepo.RevokeDevice(r.Context(), user.ID, payload.DeviceID)
+			if err != nil {
+				return errors.Wrap(err, "failed revoking device refresh tokens")
+			}
+
+			session, err = startSession(r.Context(), refreshTokensRepo, tokens, user, payload.DeviceID, "")
+			return errors.Wrap(err, "failed generating tokens for user")
+		})
+		if errors.Cause(err) == db.ErrContactLimit {
+			renderContactLimitError(w, contactsCfg)
 			return
 		}
 
-		token, err := generateToken(user.Msisdn)
 		if err != nil {
-			logger.Error("failed generating JWT for user", zap.String("phoneNumber", user.Msisdn), zap.Error(err))
+			logger.Error("failed signing in user", zap.Error(err))
 			renderInternalServerError(w, NewInternalServerErrorResponse(err))
 			return
 		}
 
-		renderData(w, struct {
-			Data      interface{} `json:"data"`
-			AuthToken string      `json:"authToken"`
-			Info      string      `json:"info"`
-		}{
-			Data:      user,
-			AuthToken: token,
-			Info:      "Welcome to Hoodcops!",
-		})
-	}
-}
+		if invalidTicket {
+			renderUnauthorized(w, NewUnauthorizedResponse("Verification ticket is invalid, has expired or has already been used"))
+			return
+		}
 
-func getAllMobileUsers(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewMobileUsersRepo(dbConn)
-		users, err := repo.GetAll()
-		if err != nil {
-			logger.Error("failed fetching all mobile users from db", zap.Error(err))
-			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+		if suspended {
+			logger.Info("rejected sign-in of suspended user", zap.Int("userId", user.ID))
+			renderAccountSuspended(w)
 			return
 		}
 
-		renderData(w, OkResponse{Data: users})
+		inviteContacts(inviter, user.ID, added, logger)
+
+		session.Info = "Welcome back!"
+		if created {
+			session.Info = "Welcome to Hoodcops!"
+		}
+
+		renderData(w, session)
 	}
 }
 
-func generateToken(msisdn string) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
+// createSignUpDetails saves the profile and contacts a user
+// signed up with, returning the contacts that were added
+func createSignUpDetails(ctx context.Context, tx db.Store, userID int, profile *db.UserProfile, contacts []*db.UserContact, maxContacts int) ([]*db.UserContact, error) {
+	if profile != nil {
+		profile.UserID = userID
+		_, err := tx.UserProfiles().Create(ctx, profile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed creating user profile")
+		}
+	}
 
-	claims["authorized"] = true
-	claims["user"] = "edward pie"
-	claims["exp"] = time.Now().Add(time.Minute * 30).Unix()
+	if len(contacts) == 0 {
+		return nil, nil
+	}
 
-	tokenString, err := token.SignedString([]byte(`sdfsd`))
+	sync, err := tx.UserContacts().SyncContacts(ctx, userID, contacts, db.SyncMerge, maxContacts)
 	if err != nil {
-		return "", err
+		return nil, errors.Wrap(err, "failed saving user contacts")
 	}
 
-	return tokenString, nil
+	return sync.Added, nil
 }
 
-func mobileUsersRoutes(dbConn *sqlx.DB, verifier *twilio.TwilioVerifier, secretKey string, logger *zap.Logger) *chi.Mux {
+func mobileUsersRoutes(store db.Store, verifier verification.Verifier, limiter *ratelimit.SMSLimiter, verifyLimiter *ratelimit.Limiter, inviter notify.Inviter, tokens *auth.TokenService, contactsCfg ContactsConfig, region string, logger *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
-	// router.Post("/signin/start", ValidateJWT(startSignIn(verifier, logger), secretKey))
-	router.Get("/", getAllMobileUsers(dbConn, logger))
-	router.Post("/", createUser(dbConn, secretKey, logger))
-	router.Post("/{userId}/profile", createUserProfile(dbConn, logger))
-	router.Post("/signin/start", startSignIn(verifier, logger))
-	router.Post("/signin/verify", verifyCode(verifier, logger))
+	router.Post("/", createUser(store, inviter, tokens, contactsCfg, region, logger))
+	router.Post("/signin/start", startSignIn(verifier, limiter, region, logger))
+	router.Post("/signin/verify", verifyCode(store, verifier, verifyLimiter, tokens, region, logger))
+
+	router.Group(func(router chi.Router) {
+		router.Use(Authenticate(store, tokens, logger))
+		router.Post("/me/profile", createUserProfile(store, logger))
+	})
 
 	return router
 }
@@ -5,6 +5,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// Codes of errors reported when verifying phone numbers. They are stable
+// so that clients can rely on them to decide which message to show users.
+const (
+	ErrCodeInvalidVerificationCode = 1001
+	ErrCodeExpiredVerificationCode = 1002
+	ErrCodeTooManyAttempts         = 1003
+	ErrCodeInvalidPhoneNumber      = 1004
+	ErrCodeVerificationRateLimited = 1005
+	ErrCodeVerificationUnavailable = 1006
+	ErrCodeSMSRateLimited          = 1007
+	ErrCodeRegionNotAllowed        = 1008
+	ErrCodeVerifyRateLimited       = 1009
+)
+
+// Codes of errors reported about the accounts of callers
+const (
+	ErrCodeAccountLocked    = 1101
+	ErrCodeAccountSuspended = 1102
+)
+
+// Codes of errors reported about the contacts of users
+const (
+	ErrCodeContactLimitExceeded = 1201
+	ErrCodeUnknownPepper        = 1202
+	ErrCodeDiscoveryRateLimited = 1203
 )
 
 // Error represents an API error code
@@ -22,6 +51,22 @@ func NewMissingParamError(paramName string) Error {
 	}
 }
 
+// NewInvalidPhoneNumberError ...
+func NewInvalidPhoneNumberError(paramName string) Error {
+	return Error{
+		Code:    ErrCodeInvalidPhoneNumber,
+		Message: fmt.Sprintf("Param %s is not a valid phone number", paramName),
+	}
+}
+
+// NewInvalidParamError ...
+func NewInvalidParamError(paramName, reason string) Error {
+	return Error{
+		Code:    400,
+		Message: fmt.Sprintf("Param %s %s", paramName, reason),
+	}
+}
+
 // ErrorResponse is the response payload sent
 // to clients when an error occurs during
 // request handling.
@@ -48,6 +93,18 @@ func (res *ErrorResponse) AddError(e Error) {
 	res.Errors = append(res.Errors, e)
 }
 
+// AddCoordinateErrors appends an Error for each of the
+// latitude and longitude of c that is out of range
+func (res *ErrorResponse) AddCoordinateErrors(c db.Coordinate) {
+	if (db.Coordinate{Lat: c.Lat}).Validate() != nil {
+		res.AddError(NewInvalidParamError("geoLat", "must be between -90 and 90"))
+	}
+
+	if (db.Coordinate{Lng: c.Lng}).Validate() != nil {
+		res.AddError(NewInvalidParamError("geoLng", "must be between -180 and 180"))
+	}
+}
+
 // NewInvalidPayloadResponse ...
 func NewInvalidPayloadResponse(err error) ErrorResponse {
 	return ErrorResponse{
@@ -74,6 +131,58 @@ func NewInternalServerErrorResponse(err error) ErrorResponse {
 	}
 }
 
+// NewUnauthorizedResponse ...
+func NewUnauthorizedResponse(message string) ErrorResponse {
+	return ErrorResponse{
+		Summary: "Unauthorized access",
+		Errors: []Error{
+			{
+				Code:    401,
+				Message: message,
+			},
+		},
+	}
+}
+
+// NewForbiddenResponse ...
+func NewForbiddenResponse(message string) ErrorResponse {
+	return ErrorResponse{
+		Summary: "Access to the resource is not allowed",
+		Errors: []Error{
+			{
+				Code:    403,
+				Message: message,
+			},
+		},
+	}
+}
+
+// NewNotFoundResponse ...
+func NewNotFoundResponse(message string) ErrorResponse {
+	return ErrorResponse{
+		Summary: "Resource not found",
+		Errors: []Error{
+			{
+				Code:    404,
+				Message: message,
+			},
+		},
+	}
+}
+
+// NewConflictResponse ...
+func NewConflictResponse(message string) ErrorResponse {
+	return ErrorResponse{
+		Summary: "Request conflicts with the current state of the resource",
+		Errors: []Error{
+			{
+				Code:    409,
+				Message: message,
+			},
+		},
+	}
+}
+
 // OkResponse represent a response sent to
 // clients when request is successful
 type OkResponse struct {
@@ -81,6 +190,13 @@ type OkResponse struct {
 	Info string      `json:"info"`
 }
 
+// renderAccountSuspended responds to a request of a suspended user
+func renderAccountSuspended(w http.ResponseWriter) {
+	errRes := NewErrorResponse("Access to the resource is not allowed")
+	errRes.AddError(Error{Code: ErrCodeAccountSuspended, Message: "account is suspended"})
+	renderForbidden(w, errRes)
+}
+
 func renderData(w http.ResponseWriter, payload interface{}) {
 	renderJSON(w, http.StatusOK, payload)
 }
@@ -89,6 +205,22 @@ func renderBadRequest(w http.ResponseWriter, payload interface{}) {
 	renderJSON(w, http.StatusBadRequest, payload)
 }
 
+func renderUnauthorized(w http.ResponseWriter, payload interface{}) {
+	renderJSON(w, http.StatusUnauthorized, payload)
+}
+
+func renderForbidden(w http.ResponseWriter, payload interface{}) {
+	renderJSON(w, http.StatusForbidden, payload)
+}
+
+func renderNotFound(w http.ResponseWriter, payload interface{}) {
+	renderJSON(w, http.StatusNotFound, payload)
+}
+
+func renderConflict(w http.ResponseWriter, payload interface{}) {
+	renderJSON(w, http.StatusConflict, payload)
+}
+
 func renderInternalServerError(w http.ResponseWriter, payload interface{}) {
 	renderJSON(w, http.StatusInternalServerError, payload)
 }
@@ -1,24 +1,58 @@
 package v1
 
 import (
+	"context"
+
 	"github.com/go-chi/chi"
-	"github.com/hoodcops/xcore/pkg/twilio"
-	"github.com/jmoiron/sqlx"
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/discovery"
+	"github.com/hoodcops/xcore/pkg/notify"
+	"github.com/hoodcops/xcore/pkg/ratelimit"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"github.com/hoodcops/xcore/pkg/verification"
 	"go.uber.org/zap"
 )
 
 // InitRoutes sets up all the endpoints exposed under this
-// version of the API
+// version of the API. Phone numbers given without an international
+// prefix are taken to be numbers of region. Requests for verification
+// codes are limited by limiter, and attempts at entering them by
+// verifyLimiter. Emergency contacts are asked by inviter to accept to
+// be alerted, and respond to their invitations on pages under /i. Users
+// find out which of their contacts use the app through discoverer, as
+// often as discoveryLimiter allows. Changes to alerts are published to
+// events and streamed to clients with streamCfg. Staff sign in to the
+// admin API as configured by adminCfg and users upload contacts as
+// configured by contactsCfg. Notifications about alerts carry on after
+// their requests end, until ctx is done.
 func InitRoutes(
-	db *sqlx.DB,
-	verifier *twilio.TwilioVerifier,
-	secret string,
+	ctx context.Context,
+	store db.Store,
+	verifier verification.Verifier,
+	limiter *ratelimit.SMSLimiter,
+	verifyLimiter *ratelimit.Limiter,
+	notifier notify.AlertNotifier,
+	inviter notify.Inviter,
+	discoverer *discovery.Service,
+	discoveryLimiter *ratelimit.Limiter,
+	events stream.Broker,
+	streamCfg stream.ConnConfig,
+	tokens *auth.TokenService,
+	adminCfg AdminAuthConfig,
+	contactsCfg ContactsConfig,
+	region string,
 	logger *zap.Logger,
 ) *chi.Mux {
 	router := chi.NewRouter()
-	router.Mount("/v1/users", mobileUsersRoutes(db, verifier, secret, logger))
-	router.Mount("/v1/profiles", userProfilesRoutes(db, logger))
-	router.Mount("/v1/contacts", userContactsRoutes(db, logger))
+	router.Mount("/v1/auth", authRoutes(store, tokens, logger))
+	router.Mount("/v1/users", mobileUsersRoutes(store, verifier, limiter, verifyLimiter, inviter, tokens, contactsCfg, region, logger))
+	router.Mount("/v1/profiles", userProfilesRoutes(store, tokens, logger))
+	router.Mount("/v1/contacts", userContactsRoutes(store, inviter, discoverer, discoveryLimiter, tokens, contactsCfg, region, logger))
+	router.Mount("/v1/devices", devicesRoutes(store, tokens, logger))
+	router.Mount("/v1/alerts", alertsRoutes(ctx, store, notifier, events, streamCfg, tokens, logger))
+	router.Mount("/v1/admin", adminRoutes(store, tokens, adminCfg, logger))
+	router.Mount("/i", invitationsRoutes(store, tokens, logger))
 
 	return router
 }
@@ -0,0 +1,131 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"go.uber.org/zap"
+)
+
+// streamAlerts streams the events of the alerts of the authenticated user as
+// they happen, over a WebSocket or as server-sent events. Responders may also
+// follow the alerts of other users raised in the bounding box given as
+// bbox=south,west,north,east, or in the zone given as zone=lat,lng,radius
+// with the radius in meters. Clients resume after the event whose ID they
+// pass in the Last-Event-ID header or the lastEventId query param.
+func streamAlerts(store db.Store, broker stream.Broker, cfg stream.ConnConfig, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := mustPrincipal(r)
+		filter := stream.Filter{UserID: principal.UserID}
+		query := r.URL.Query()
+
+		errRes := NewErrorResponse("Invalid values for parameters")
+		if bbox := query.Get("bbox"); len(bbox) > 0 {
+			var box db.BoundingBox
+			v, ok := parseFloatList(bbox, 4)
+			if ok {
+				box = db.BoundingBox{South: v[0], West: v[1], North: v[2], East: v[3]}
+				ok = box.Validate() == nil
+			}
+
+			if !ok {
+				errRes.AddError(NewInvalidParamError("bbox", "must be the south,west,north,east of a bounding box not crossing the antimeridian"))
+			} else {
+				filter.Box = &box
+			}
+		}
+
+		if zone := query.Get("zone"); len(zone) > 0 {
+			v, ok := parseFloatList(zone, 3)
+			if !ok || v[2] <= 0 || (db.Coordinate{Lat: v[0], Lng: v[1]}).Validate() != nil {
+				errRes.AddError(NewInvalidParamError("zone", "must be the lat,lng,radius of a zone with a positive radius in meters"))
+			} else {
+				filter.Zone = &stream.Zone{Center: db.Coordinate{Lat: v[0], Lng: v[1]}, Radius: v[2]}
+			}
+		}
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if len(lastEventID) == 0 {
+			lastEventID = query.Get("lastEventId")
+		}
+
+		var after uint64
+		if len(lastEventID) > 0 {
+			var err error
+			after, err = strconv.ParseUint(lastEventID, 10, 64)
+			if err != nil {
+				errRes.AddError(NewInvalidParamError("lastEventId", "must be the ID of an event"))
+			}
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		if filter.Box != nil || filter.Zone != nil {
+			profile, err := store.UserProfiles().GetByUserID(r.Context(), principal.UserID)
+			if err != nil {
+				logger.Error("failed fetching user profile from db", zap.Int("userId", principal.UserID), zap.Error(err))
+				renderInternalServerError(w, NewInternalServerErrorResponse(err))
+				return
+			}
+
+			if profile == nil || !profile.Responder {
+				renderForbidden(w, NewForbiddenResponse("Only responders can follow alerts raised by other users"))
+				return
+			}
+		}
+
+		sub, err := broker.Subscribe(filter, after)
+		if err != nil {
+			logger.Error("failed subscribing to alert events", zap.Int("userId", principal.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+		defer sub.Close()
+
+		conn, err := stream.Accept(w, r, cfg)
+		if err != nil {
+			if err == stream.ErrBadHandshake {
+				errRes := NewErrorResponse("Invalid WebSocket handshake")
+				errRes.AddError(Error{Code: 400, Message: err.Error()})
+				renderBadRequest(w, errRes)
+				return
+			}
+
+			logger.Error("failed accepting alert stream", zap.Int("userId", principal.UserID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		err = conn.Stream(sub)
+		if err == stream.ErrSlowConsumer {
+			logger.Info("dropped slow alert stream subscriber", zap.Int("userId", principal.UserID))
+		} else if err != nil {
+			logger.Debug("alert stream ended", zap.Int("userId", principal.UserID), zap.Error(err))
+		}
+	}
+}
+
+// parseFloatList parses s as n comma separated numbers
+func parseFloatList(s string, n int) ([]float64, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = v
+	}
+
+	return values, true
+}
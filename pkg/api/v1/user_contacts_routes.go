@@ -1,20 +1,33 @@
 package v1
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
 	"github.com/hoodcops/xcore/pkg/db"
-	"github.com/jmoiron/sqlx"
+	"github.com/hoodcops/xcore/pkg/discovery"
+	"github.com/hoodcops/xcore/pkg/notify"
+	"github.com/hoodcops/xcore/pkg/phone"
+	"github.com/hoodcops/xcore/pkg/ratelimit"
 	"go.uber.org/zap"
 )
 
-func createContacts(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+// ContactsConfig configures the contacts API
+type ContactsConfig struct {
+	// MaxPerUser is the number of contacts a user may have. Zero
+	// leaves the number of contacts unlimited.
+	MaxPerUser int
+}
+
+func syncContacts(store db.Store, inviter notify.Inviter, cfg ContactsConfig, region string, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var payload = struct {
-			UserID   int               `json:"userId"`
+			Mode     string            `json:"mode"`
 			Contacts []*db.UserContact `json:"contacts"`
 		}{}
 
@@ -25,29 +38,88 @@ func createContacts(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 			return
 		}
 
-		for _, contact := range payload.Contacts {
-			contact.UserID = payload.UserID
+		if len(payload.Mode) == 0 {
+			payload.Mode = db.SyncMerge
+		}
+
+		errRes := NewErrorResponse("Invalid values for parameters")
+		if payload.Mode != db.SyncMerge && payload.Mode != db.SyncReplace {
+			errRes.AddError(NewInvalidParamError("mode", "must be either merge or replace"))
+		}
+
+		addContactErrors(errRes, payload.Contacts, region)
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		userID := mustPrincipal(r).UserID
+		repo := store.UserContacts()
+		sync, err := repo.SyncContacts(r.Context(), userID, payload.Contacts, payload.Mode, cfg.MaxPerUser)
+		if err == db.ErrContactLimit {
+			renderContactLimitError(w, cfg)
+			return
 		}
 
-		repo := db.NewUserContactsRepo(dbConn)
-		savedContacts, err := repo.CreateContacts(payload.Contacts)
 		if err != nil {
-			logger.Debug("failed saving user contacts", zap.Error(err))
+			logger.Error("failed saving user contacts", zap.Int("userId", userID), zap.Error(err))
 			renderInternalServerError(w, NewInternalServerErrorResponse(err))
 			return
 		}
 
-		renderData(w, OkResponse{Data: savedContacts})
+		inviteContacts(inviter, userID, sync.Added, logger)
+		renderData(w, OkResponse{Data: sync})
+	}
+}
+
+// addContactErrors normalizes the msisdns of contacts, adding an error to
+// errRes for each one that is not a valid phone number of region
+func addContactErrors(errRes *ErrorResponse, contacts []*db.UserContact, region string) {
+	for i, contact := range contacts {
+		msisdn, err := phone.Parse(contact.Msisdn, region)
+		if err != nil {
+			errRes.AddError(NewInvalidPhoneNumberError(fmt.Sprintf("contacts[%d].msisdn", i)))
+			continue
+		}
+
+		contact.Msisdn = msisdn.String()
 	}
 }
 
-func getAllContacts(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+// inviteContacts invites contacts in the background so that users do not
+// wait for every invitation to be sent, which must not be cut short when
+// the request ends
+func inviteContacts(inviter notify.Inviter, userID int, contacts []*db.UserContact, logger *zap.Logger) {
+	if len(contacts) == 0 {
+		return
+	}
+
+	go func() {
+		err := inviter.Invite(context.Background(), userID, contacts)
+		if err != nil {
+			logger.Error("failed inviting contacts", zap.Int("userId", userID), zap.Error(err))
+		}
+	}()
+}
+
+// renderContactLimitError responds to a request that would leave
+// a user with more contacts than cfg allows
+func renderContactLimitError(w http.ResponseWriter, cfg ContactsConfig) {
+	errRes := NewErrorResponse("Too many contacts")
+	errRes.AddError(Error{
+		Code:    ErrCodeContactLimitExceeded,
+		Message: fmt.Sprintf("users may have at most %d contacts", cfg.MaxPerUser),
+	})
+	renderJSON(w, http.StatusUnprocessableEntity, errRes)
+}
+
+func getAllContacts(store db.Store, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewUserContactsRepo(dbConn)
-		contacts, err := repo.GetAll()
+		repo := store.UserContacts()
+		contacts, err := repo.GetAll(r.Context())
 		if err != nil {
-			logger.Debug("failed fetching all contacts from database", zap.Error(err))
-			renderBadRequest(w, NewInternalServerErrorResponse(err))
+			logger.Error("failed fetching all contacts from database", zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
 			return
 		}
 
@@ -55,34 +127,258 @@ func getAllContacts(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 	}
 }
 
-func getUserContacts(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func getUserContacts(store db.Store, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewUserContactsRepo(dbConn)
+		repo := store.UserContacts()
+		userID := mustPrincipal(r).UserID
 
-		userID, err := strconv.Atoi(chi.URLParam(r, "userId"))
+		contacts, err := repo.GetUserContacts(r.Context(), userID)
 		if err != nil {
-			logger.Debug("failed parsing user id from url", zap.Error(err))
-			renderBadRequest(w, NewInternalServerErrorResponse(err))
+			logger.Error("failed fetching user contacts from database", zap.Int("userId", userID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
 			return
 		}
 
-		contacts, err := repo.GetUserContacts(userID)
+		renderData(w, OkResponse{Data: contacts})
+	}
+}
+
+func getContact(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		contact, ok := loadContact(w, r, store.UserContacts(), logger)
+		if !ok {
+			return
+		}
+
+		renderData(w, OkResponse{Data: contact})
+	}
+}
+
+func updateContact(store db.Store, inviter notify.Inviter, region string, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			Msisdn       *string `json:"msisdn"`
+			Fullname     *string `json:"fullname"`
+			Priority     *int    `json:"priority"`
+			Relationship *string `json:"relationship"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
 		if err != nil {
-			logger.Debug("failed fetching user contacts from database", zap.Int("userId", userID))
-			renderBadRequest(w, NewInternalServerErrorResponse(err))
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
 			return
 		}
 
-		renderData(w, OkResponse{Data: contacts})
+		repo := store.UserContacts()
+		contact, ok := loadContact(w, r, repo, logger)
+		if !ok {
+			return
+		}
+		previous := contact.Msisdn
+
+		errRes := NewErrorResponse("Invalid values for parameters")
+		if payload.Msisdn != nil {
+			msisdn, err := phone.Parse(*payload.Msisdn, region)
+			if err != nil {
+				errRes.AddError(NewInvalidPhoneNumberError("msisdn"))
+			} else {
+				contact.Msisdn = msisdn.String()
+			}
+		}
+
+		if payload.Fullname != nil {
+			if len(*payload.Fullname) == 0 || len(*payload.Fullname) > 255 {
+				errRes.AddError(NewInvalidParamError("fullname", "must be between 1 and 255 characters long"))
+			}
+			contact.Fullname = *payload.Fullname
+		}
+
+		if payload.Priority != nil {
+			if *payload.Priority < 0 {
+				errRes.AddError(NewInvalidParamError("priority", "must not be negative"))
+			}
+			contact.Priority = *payload.Priority
+		}
+
+		if payload.Relationship != nil {
+			if len(*payload.Relationship) > 0 && !db.IsContactRelationship(*payload.Relationship) {
+				errRes.AddError(NewInvalidParamError("relationship", "is not a known relationship"))
+			}
+			contact.Relationship = *payload.Relationship
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		ok, err = repo.UpdateContact(r.Context(), contact)
+		if err == db.ErrDuplicateContact {
+			renderConflict(w, NewConflictResponse("Another contact has the same phone number"))
+			return
+		}
+
+		if err != nil {
+			logger.Error("failed updating user contact", zap.Int("contactId", contact.ID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if !ok {
+			renderNotFound(w, NewNotFoundResponse("Contact does not exist"))
+			return
+		}
+
+		// a contact whose number changed is asked again, unless the
+		// new number declined before
+		if contact.Msisdn != previous && contact.Status == db.ContactStatusPending {
+			inviteContacts(inviter, contact.UserID, []*db.UserContact{contact}, logger)
+		}
+
+		renderData(w, OkResponse{Data: contact, Info: "Contact updated successfully"})
+	}
+}
+
+func deleteContact(store db.Store, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "contactID"))
+		if err != nil {
+			renderNotFound(w, NewNotFoundResponse("Contact does not exist"))
+			return
+		}
+
+		userID := mustPrincipal(r).UserID
+		ok, err := store.UserContacts().DeleteContact(r.Context(), userID, id)
+		if err != nil {
+			logger.Error("failed deleting user contact", zap.Int("contactId", id), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		if !ok {
+			renderNotFound(w, NewNotFoundResponse("Contact does not exist"))
+			return
+		}
+
+		renderData(w, OkResponse{Info: "Contact deleted successfully"})
+	}
+}
+
+// loadContact fetches the contact whose ID is in the path of r. It
+// responds with Not Found when the caller has no such contact.
+func loadContact(w http.ResponseWriter, r *http.Request, repo db.UserContacts, logger *zap.Logger) (*db.UserContact, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "contactID"))
+	if err != nil {
+		renderNotFound(w, NewNotFoundResponse("Contact does not exist"))
+		return nil, false
+	}
+
+	contact, err := repo.GetUserContact(r.Context(), mustPrincipal(r).UserID, id)
+	if err != nil {
+		logger.Error("failed fetching user contact from db", zap.Int("contactId", id), zap.Error(err))
+		renderInternalServerError(w, NewInternalServerErrorResponse(err))
+		return nil, false
+	}
+
+	if contact == nil {
+		renderNotFound(w, NewNotFoundResponse("Contact does not exist"))
+		return nil, false
+	}
+
+	return contact, true
+}
+
+func getDiscoveryPepper(discoverer *discovery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderData(w, OkResponse{Data: discoverer.Pepper()})
+	}
+}
+
+// discoverContacts tells which of the hashed phone numbers of the contacts
+// of the caller belong to users. Hashes are neither kept nor logged, so that
+// the numbers of people who are not users never reach the server in a form
+// it keeps.
+func discoverContacts(discoverer *discovery.Service, limiter *ratelimit.Limiter, cfg ContactsConfig, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var payload = struct {
+			Version int64    `json:"version"`
+			Hashes  []string `json:"hashes"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			renderBadRequest(w, NewInvalidPayloadResponse(err))
+			return
+		}
+
+		errRes := NewErrorResponse("Invalid values for parameters")
+		if cfg.MaxPerUser > 0 && len(payload.Hashes) > cfg.MaxPerUser {
+			errRes.AddError(NewInvalidParamError("hashes", fmt.Sprintf("must not hold more than %d hashes", cfg.MaxPerUser)))
+		}
+
+		if errRes.HasErrors() {
+			renderBadRequest(w, errRes)
+			return
+		}
+
+		// every hash checked counts against the daily quota, so that
+		// users cannot find out who uses the app by trying every number
+		userID := mustPrincipal(r).UserID
+		err = limiter.AllowN(r.Context(), ratelimit.Request{Subject: strconv.Itoa(userID), IP: clientIP(r)}, len(payload.Hashes))
+		if err != nil {
+			logger.Warn("contact discovery denied", zap.Int("userId", userID), zap.String("ip", clientIP(r)), zap.Error(err))
+
+			lerr, ok := err.(*ratelimit.Error)
+			if !ok {
+				renderInternalServerError(w, NewInternalServerErrorResponse(err))
+				return
+			}
+
+			renderTooManyRequests(w, lerr, ErrCodeDiscoveryRateLimited, "Too many contacts were looked up. Please try again later")
+			return
+		}
+
+		matched, err := discoverer.Match(r.Context(), payload.Version, payload.Hashes)
+		switch err {
+		case nil:
+		case discovery.ErrInvalidHash:
+			errRes.AddError(NewInvalidParamError("hashes", "must only hold hex encoded SHA-256 HMACs"))
+			renderBadRequest(w, errRes)
+			return
+		case discovery.ErrUnknownPepper:
+			errRes = NewErrorResponse("The pepper has rotated. Please fetch the current one and hash again")
+			errRes.AddError(Error{Code: ErrCodeUnknownPepper, Message: err.Error()})
+			renderConflict(w, errRes)
+			return
+		default:
+			logger.Error("failed discovering contacts", zap.Int("userId", userID), zap.Error(err))
+			renderInternalServerError(w, NewInternalServerErrorResponse(err))
+			return
+		}
+
+		renderData(w, OkResponse{
+			Data: struct {
+				Version    int64    `json:"version"`
+				Registered []string `json:"registered"`
+			}{
+				Version:    payload.Version,
+				Registered: matched,
+			},
+		})
 	}
 }
 
-func userContactsRoutes(dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+func userContactsRoutes(store db.Store, inviter notify.Inviter, discoverer *discovery.Service, discoveryLimiter *ratelimit.Limiter, tokens *auth.TokenService, cfg ContactsConfig, region string, logger *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
+	router.Use(Authenticate(store, tokens, logger))
 
-	router.Post("/", createContacts(dbConn, logger))
-	router.Get("/", getAllContacts(dbConn, logger))
-	router.Get("/{userId}", getUserContacts(dbConn, logger))
+	router.Post("/", syncContacts(store, inviter, cfg, region, logger))
+	router.Get("/me", getUserContacts(store, logger))
+	router.Get("/discovery", getDiscoveryPepper(discoverer))
+	router.Post("/discovery", discoverContacts(discoverer, discoveryLimiter, cfg, logger))
+	router.Get("/{contactID}", getContact(store, logger))
+	router.Patch("/{contactID}", updateContact(store, inviter, region, logger))
+	router.Delete("/{contactID}", deleteContact(store, logger))
 
 	return router
 }
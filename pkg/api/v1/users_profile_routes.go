@@ -5,12 +5,12 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi"
+	"github.com/hoodcops/xcore/pkg/auth"
 	"github.com/hoodcops/xcore/pkg/db"
-	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
-func createUserProfile(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func createUserProfile(store db.Store, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		profile := new(db.UserProfile)
 
@@ -20,8 +20,20 @@ func createUserProfile(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 			return
 		}
 
-		repo := db.NewUserProfilesRepo(dbConn)
-		profile, err = repo.Create(profile)
+		if profile.Coordinate != nil {
+			errRes := NewErrorResponse("Invalid values for parameters")
+			errRes.AddCoordinateErrors(*profile.Coordinate)
+
+			if errRes.HasErrors() {
+				renderBadRequest(w, errRes)
+				return
+			}
+		}
+
+		profile.UserID = mustPrincipal(r).UserID
+
+		repo := store.UserProfiles()
+		profile, err = repo.Create(r.Context(), profile)
 		if err != nil {
 			logger.Error("failed creating user profile", zap.Error(err))
 			renderInternalServerError(w, NewInternalServerErrorResponse(err))
@@ -32,10 +44,10 @@ func createUserProfile(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 	}
 }
 
-func getAllUserProfiles(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
+func getAllUserProfiles(store db.Store, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		repo := db.NewUserProfilesRepo(dbConn)
-		users, err := repo.GetAll()
+		repo := store.UserProfiles()
+		users, err := repo.GetAll(r.Context())
 		if err != nil {
 			logger.Error("failed fetching all user profiles from db", zap.Error(err))
 			renderInternalServerError(w, NewInternalServerErrorResponse(err))
@@ -46,11 +58,11 @@ func getAllUserProfiles(dbConn *sqlx.DB, logger *zap.Logger) http.HandlerFunc {
 	}
 }
 
-func userProfilesRoutes(dbConn *sqlx.DB, logger *zap.Logger) *chi.Mux {
+func userProfilesRoutes(store db.Store, tokens *auth.TokenService, logger *zap.Logger) *chi.Mux {
 	router := chi.NewRouter()
+	router.Use(Authenticate(store, tokens, logger))
 
-	router.Post("/", createUserProfile(dbConn, logger))
-	router.Get("/", getAllUserProfiles(dbConn, logger))
+	router.Post("/", createUserProfile(store, logger))
 
 	return router
 }
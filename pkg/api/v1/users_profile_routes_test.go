@@ -0,0 +1,150 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/auth"
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"go.uber.org/zap"
+)
+
+// testStore is a db.Store backed by in-memory repos. Calling repos or
+// methods it does not implement panics.
+type testStore struct {
+	db.Store
+	users    *testMobileUsers
+	profiles *testUserProfiles
+	alerts   *testAlerts
+	contacts *testUserContacts
+}
+
+func newTestStore() *testStore {
+	return &testStore{
+		users:    &testMobileUsers{},
+		profiles: &testUserProfiles{byUser: map[int]*db.UserProfile{}},
+		alerts:   &testAlerts{byID: map[int]*db.Alert{}},
+		contacts: &testUserContacts{},
+	}
+}
+
+func (s *testStore) MobileUsers() db.MobileUsers   { return s.users }
+func (s *testStore) UserProfiles() db.UserProfiles { return s.profiles }
+func (s *testStore) Alerts() db.Alerts             { return s.alerts }
+func (s *testStore) UserContacts() db.UserContacts { return s.contacts }
+
+type testMobileUsers struct {
+	db.MobileUsers
+}
+
+func (repo *testMobileUsers) GetByID(ctx context.Context, id int) (*db.MobileUser, error) {
+	return &db.MobileUser{ID: id}, nil
+}
+
+type testUserProfiles struct {
+	db.UserProfiles
+	byUser map[int]*db.UserProfile
+}
+
+func (repo *testUserProfiles) Create(ctx context.Context, profile *db.UserProfile) (*db.UserProfile, error) {
+	stored := *profile
+	stored.ID = len(repo.byUser) + 1
+	repo.byUser[profile.UserID] = &stored
+
+	profile.ID = stored.ID
+	return profile, nil
+}
+
+func (repo *testUserProfiles) GetByUserID(ctx context.Context, userID int) (*db.UserProfile, error) {
+	return repo.byUser[userID], nil
+}
+
+type testAlerts struct {
+	db.Alerts
+	byID map[int]*db.Alert
+}
+
+func (repo *testAlerts) GetByID(ctx context.Context, id int) (*db.Alert, error) {
+	return repo.byID[id], nil
+}
+
+type testUserContacts struct {
+	db.UserContacts
+	contacts []*db.UserContact
+}
+
+func (repo *testUserContacts) GetUserContacts(ctx context.Context, userID int) ([]*db.UserContact, error) {
+	var contacts []*db.UserContact
+	for _, contact := range repo.contacts {
+		if contact.UserID == userID {
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts, nil
+}
+
+func newTestTokens(t *testing.T) *auth.TokenService {
+	tokens, err := auth.NewTokenService(auth.TokenConfig{
+		SigningKeyID: "k1",
+		SigningKey:   "50m3h@rd2gu355t3xt",
+		Issuer:       "hoodcops",
+		Audience:     "hoodcops-mobile",
+		TTL:          30 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return tokens
+}
+
+func serve(t *testing.T, handler http.Handler, tokens *auth.TokenService, userID int, method, target, body string) *httptest.ResponseRecorder {
+	token, err := tokens.IssueAccessToken(userID, "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	if len(body) > 0 {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCreateUserProfile_ShouldNotLetUsersMakeThemselvesResponders(t *testing.T) {
+	store := newTestStore()
+	store.alerts.byID[5] = &db.Alert{ID: 5, UserID: 9, Status: db.AlertStatusRaised}
+	tokens := newTestTokens(t)
+	logger := zap.NewNop()
+
+	profiles := userProfilesRoutes(store, tokens, logger)
+	alerts := alertsRoutes(context.Background(), store, nil, stream.NewHub(stream.HubConfig{}), stream.ConnConfig{}, tokens, logger)
+
+	w := serve(t, profiles, tokens, 7, http.MethodPost, "/", `{"fullname":"Kofi Mensah","responder":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 creating profile, got %d: %s", w.Code, w.Body)
+	}
+
+	if store.profiles.byUser[7].Responder {
+		t.Fatal("expected profile not to be a responder")
+	}
+
+	w = serve(t, alerts, tokens, 7, http.MethodGet, "/stream?bbox=5.5,-0.3,5.7,-0.1", "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 following other users' alerts, got %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(t, alerts, tokens, 7, http.MethodPost, "/5/acknowledge", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 acknowledging another user's alert, got %d: %s", w.Code, w.Body)
+	}
+}
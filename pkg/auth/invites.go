@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inviteMACSize is the number of bytes of the HMAC kept in invite tokens.
+// It keeps links sent by SMS short while leaving them unguessable.
+const inviteMACSize = 12
+
+// InviteToken returns the token of the link an emergency contact invited
+// at invitedAt follows to respond to the invitation. Inviting the contact
+// again, at a later time, invalidates the token.
+func (ts *TokenService) InviteToken(contactID int, invitedAt time.Time) string {
+	return inviteToken(ts.keys[ts.signingKeyID], contactID, invitedAt)
+}
+
+// VerifyInviteToken reports whether token was issued, with any of the
+// keys of the service, for the contact with the specified ID invited at
+// invitedAt
+func (ts *TokenService) VerifyInviteToken(token string, contactID int, invitedAt time.Time) bool {
+	for _, key := range ts.keys {
+		if hmac.Equal([]byte(token), []byte(inviteToken(key, contactID, invitedAt))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseInviteToken returns the ID of the contact an invite token was issued
+// for. It does not verify the token, which takes VerifyInviteToken.
+func ParseInviteToken(token string) (int, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 1 {
+		return 0, ErrInvalidToken
+	}
+
+	id, err := strconv.ParseInt(token[:i], 36, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidToken
+	}
+
+	return int(id), nil
+}
+
+func inviteToken(key []byte, contactID int, invitedAt time.Time) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("invite:" + strconv.Itoa(contactID) + ":" + strconv.FormatInt(invitedAt.Unix(), 10)))
+
+	return strconv.FormatInt(int64(contactID), 36) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:inviteMACSize])
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenService_InviteToken_ShouldPass(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+	invitedAt := time.Unix(1500000000, 0)
+
+	token := ts.InviteToken(4242, invitedAt)
+	if len(token) > 24 {
+		t.Fatalf("expected a short token, got %q", token)
+	}
+
+	id, err := ParseInviteToken(token)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if id != 4242 {
+		t.Fatalf("expected contact id %d, got %d", 4242, id)
+	}
+
+	if !ts.VerifyInviteToken(token, id, invitedAt) {
+		t.Fatal("expected the token to be valid")
+	}
+}
+
+func TestTokenService_VerifyInviteToken_ShouldRejectStaleTokens(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+	invitedAt := time.Unix(1500000000, 0)
+
+	token := ts.InviteToken(4242, invitedAt)
+	if ts.VerifyInviteToken(token, 4242, invitedAt.Add(time.Hour)) {
+		t.Fatal("expected the token of a previous invitation to be rejected")
+	}
+
+	if ts.VerifyInviteToken(token, 4243, invitedAt) {
+		t.Fatal("expected the token of another contact to be rejected")
+	}
+}
+
+func TestTokenService_VerifyInviteToken_ShouldAcceptRotatedKeys(t *testing.T) {
+	old := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+	rotated := newTestTokenService(t, "k2", "4n0th3rh@rd2gu355t3xt", map[string]string{"k1": "50m3h@rd2gu355t3xt"})
+	invitedAt := time.Unix(1500000000, 0)
+
+	token := old.InviteToken(7, invitedAt)
+	if !rotated.VerifyInviteToken(token, 7, invitedAt) {
+		t.Fatal("expected tokens signed with a previous key to be valid")
+	}
+}
+
+func TestParseInviteToken_ShouldFailForMalformedTokens(t *testing.T) {
+	for _, token := range []string{"", ".abc", "abc", "-1.abc", "!!.abc"} {
+		_, err := ParseInviteToken(token)
+		if err != ErrInvalidToken {
+			t.Errorf("expected ErrInvalidToken for %q, got %v", token, err)
+		}
+	}
+}
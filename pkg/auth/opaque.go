@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// OpaqueToken is a random, unstructured token handed to a client, along with
+// the hash it is stored and looked up by and the time it expires. Only the
+// hash is ever persisted.
+type OpaqueToken struct {
+	Token     string
+	Hash      string
+	ExpiresAt time.Time
+}
+
+// NewRefreshToken generates a refresh token that expires after the
+// configured refresh TTL
+func (ts *TokenService) NewRefreshToken() (*OpaqueToken, error) {
+	return newOpaqueToken(ts.now().Add(ts.refreshTTL))
+}
+
+// NewVerificationTicket generates a single-use ticket proving that the holder
+// has just verified ownership of a phone number. It expires after the
+// configured ticket TTL.
+func (ts *TokenService) NewVerificationTicket() (*OpaqueToken, error) {
+	return newOpaqueToken(ts.now().Add(ts.ticketTTL))
+}
+
+// HashOpaqueToken returns the hash an opaque token is stored and looked up by
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenFamilyID returns a random ID shared by all the refresh tokens that
+// descend from a single sign-in
+func NewTokenFamilyID() (string, error) {
+	return newTokenID()
+}
+
+func newOpaqueToken(expiresAt time.Time) (*OpaqueToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return &OpaqueToken{
+		Token:     token,
+		Hash:      HashOpaqueToken(token),
+		ExpiresAt: expiresAt,
+	}, nil
+}
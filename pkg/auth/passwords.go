@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are hashed with bcrypt. Hashes carry their own cost, so it can
+// be raised without invalidating the passwords hashed before.
+const (
+	// MinPasswordLength is the fewest characters a password may have
+	MinPasswordLength = 12
+
+	// MaxPasswordLength is the most bytes a password may have, as bcrypt
+	// ignores the bytes after them
+	MaxPasswordLength = 72
+
+	passwordCost = 12
+)
+
+var (
+	// ErrPasswordTooShort is returned when hashing a password
+	// shorter than MinPasswordLength
+	ErrPasswordTooShort = errors.Errorf("password must have at least %d characters", MinPasswordLength)
+
+	// ErrPasswordTooLong is returned when hashing a password
+	// longer than MaxPasswordLength
+	ErrPasswordTooLong = errors.Errorf("password must have at most %d bytes", MaxPasswordLength)
+)
+
+// dummyHash is checked against instead of malformed hashes,
+// so that checking them takes as long as checking valid ones
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// HashPassword returns the hash of password with a random salt
+func HashPassword(password string) (string, error) {
+	if len([]rune(password)) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash. Malformed hashes,
+// including the empty hash, never match, but take as long to check as
+// valid ones so that callers can check passwords of unknown accounts
+// without revealing that the accounts do not exist.
+func CheckPassword(hash, password string) bool {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-password"), passwordCost)
+		})
+
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// PasswordNeedsRehash reports whether hash was made with a lower cost than
+// the passwords hashed now, and should be replaced when the password is
+// next checked
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < passwordCost
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword_ShouldPass(t *testing.T) {
+	hash, err := HashPassword("c0rrect-h0rse-battery")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$2a$12$") {
+		t.Fatalf("unexpected hash format %q", hash)
+	}
+
+	if !CheckPassword(hash, "c0rrect-h0rse-battery") {
+		t.Fatal("expected password to match its hash")
+	}
+
+	if CheckPassword(hash, "c0rrect-h0rse-battery!") {
+		t.Fatal("expected a different password not to match")
+	}
+
+	if PasswordNeedsRehash(hash) {
+		t.Fatal("expected a fresh hash not to need rehashing")
+	}
+
+	other, _ := HashPassword("c0rrect-h0rse-battery")
+	if other == hash {
+		t.Fatal("expected hashes of the same password to be salted differently")
+	}
+}
+
+func TestHashPassword_ShouldFailForShortPasswords(t *testing.T) {
+	_, err := HashPassword("too-short")
+	if err != ErrPasswordTooShort {
+		t.Fatalf("expected ErrPasswordTooShort, got %v", err)
+	}
+}
+
+func TestHashPassword_ShouldFailForLongPasswords(t *testing.T) {
+	_, err := HashPassword(strings.Repeat("a", MaxPasswordLength+1))
+	if err != ErrPasswordTooLong {
+		t.Fatalf("expected ErrPasswordTooLong, got %v", err)
+	}
+}
+
+func TestCheckPassword_ShouldRejectMalformedHashes(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "pbkdf2-sha256$310000$c2FsdA$a2V5", "$2a$12$c2FsdA"} {
+		if CheckPassword(hash, "plaintext") {
+			t.Fatalf("expected malformed hash %q not to match", hash)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash_ShouldPassForCheaperHashes(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("c0rrect-h0rse-battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !PasswordNeedsRehash(string(hash)) {
+		t.Fatal("expected a hash with a lower cost to need rehashing")
+	}
+
+	if !CheckPassword(string(hash), "c0rrect-h0rse-battery") {
+		t.Fatal("expected password to match its cheaper hash")
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+)
+
+const (
+	// RoleUser is the role held by every signed-in mobile user
+	RoleUser = "user"
+
+	// RoleViewer, RoleDispatcher and RoleSuperadmin are the roles of
+	// operations staff signed in to the admin API. Each role is granted
+	// the permissions of the roles before it.
+	RoleViewer     = "viewer"
+	RoleDispatcher = "dispatcher"
+	RoleSuperadmin = "superadmin"
+)
+
+// adminRoles are the roles of admin accounts, least privileged first
+var adminRoles = []string{RoleViewer, RoleDispatcher, RoleSuperadmin}
+
+// IsAdminRole reports whether role is a role of admin accounts
+func IsAdminRole(role string) bool {
+	for _, r := range adminRoles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GrantedRoles returns the roles granted to admin accounts with role,
+// which are role and every less privileged admin role
+func GrantedRoles(role string) []string {
+	for i, r := range adminRoles {
+		if r == role {
+			return append([]string(nil), adminRoles[:i+1]...)
+		}
+	}
+
+	return nil
+}
+
+type principalKey struct{}
+
+// Principal is the authenticated caller of a request. For staff signed in
+// to the admin API, UserID is the ID of their admin account and Username
+// is set instead of Msisdn.
+type Principal struct {
+	UserID   int
+	Msisdn   string
+	Username string
+	Roles    []string
+}
+
+// HasRole reports whether the principal has been granted role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal carried by ctx, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
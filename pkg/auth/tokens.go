@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidToken is returned when a token cannot be parsed, is signed
+	// with an unknown key or algorithm, or carries unexpected claims
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrExpiredToken is returned when a token is well formed but has expired
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims are the JWT claims carried by access tokens issued to mobile users
+// and admin accounts. The ID of the user or account is carried in the
+// standard subject claim.
+type Claims struct {
+	Msisdn   string   `json:"msisdn,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	jwt.StandardClaims
+}
+
+// UserID returns the ID of the user the token was issued to
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// TokenConfig holds the settings used to sign and verify access tokens
+type TokenConfig struct {
+	// SigningKeyID is the kid of the key new tokens are signed with
+	SigningKeyID string
+
+	// SigningKey is the HMAC secret new tokens are signed with
+	SigningKey string
+
+	// VerificationKeys are additional keys, indexed by kid, that are still
+	// accepted when verifying tokens. This allows keys to be rotated without
+	// signing out users holding tokens issued with a previous key.
+	VerificationKeys map[string]string
+
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+
+	// AdminAudience and AdminTTL are the audience and lifetime of access
+	// tokens issued to admin accounts. Tokens are only accepted by the API
+	// they were issued for.
+	AdminAudience string
+	AdminTTL      time.Duration
+
+	// RefreshTTL is how long refresh tokens are valid for
+	RefreshTTL time.Duration
+
+	// TicketTTL is how long phone verification tickets are valid for
+	TicketTTL time.Duration
+}
+
+// TokenService issues and verifies signed JWT access tokens
+type TokenService struct {
+	signingKeyID string
+	keys         map[string][]byte
+	issuer       string
+	audience     string
+	ttl          time.Duration
+	adminAud     string
+	adminTTL     time.Duration
+	refreshTTL   time.Duration
+	ticketTTL    time.Duration
+	now          func() time.Time
+}
+
+// NewTokenService returns a TokenService configured with cfg, or an error
+// if cfg does not contain a usable signing key
+func NewTokenService(cfg TokenConfig) (*TokenService, error) {
+	if len(cfg.SigningKeyID) == 0 {
+		return nil, errors.New("signing key id is required")
+	}
+
+	if len(cfg.SigningKey) == 0 {
+		return nil, errors.New("signing key is required")
+	}
+
+	if len(cfg.AdminAudience) > 0 && cfg.AdminAudience == cfg.Audience {
+		return nil, errors.New("admin audience must differ from the audience of mobile tokens")
+	}
+
+	keys := map[string][]byte{}
+	for kid, key := range cfg.VerificationKeys {
+		if len(key) == 0 {
+			return nil, errors.Errorf("verification key %s is empty", kid)
+		}
+		keys[kid] = []byte(key)
+	}
+	keys[cfg.SigningKeyID] = []byte(cfg.SigningKey)
+
+	return &TokenService{
+		signingKeyID: cfg.SigningKeyID,
+		keys:         keys,
+		issuer:       cfg.Issuer,
+		audience:     cfg.Audience,
+		ttl:          cfg.TTL,
+		adminAud:     cfg.AdminAudience,
+		adminTTL:     cfg.AdminTTL,
+		refreshTTL:   cfg.RefreshTTL,
+		ticketTTL:    cfg.TicketTTL,
+		now:          time.Now,
+	}, nil
+}
+
+// TTL returns how long access tokens issued by the service are valid for
+func (ts *TokenService) TTL() time.Duration {
+	return ts.ttl
+}
+
+// AdminTTL returns how long access tokens issued
+// to admin accounts are valid for
+func (ts *TokenService) AdminTTL() time.Duration {
+	return ts.adminTTL
+}
+
+// TicketTTL returns how long phone verification tickets are valid for
+func (ts *TokenService) TicketTTL() time.Duration {
+	return ts.ticketTTL
+}
+
+// Principal returns the authenticated caller identified by the claims
+func (c *Claims) Principal() (*Principal, error) {
+	userID, err := c.UserID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:   userID,
+		Msisdn:   c.Msisdn,
+		Username: c.Username,
+		Roles:    c.Roles,
+	}, nil
+}
+
+// IssueAccessToken returns a signed access token for the mobile user with the
+// specified ID and msisdn
+func (ts *TokenService) IssueAccessToken(userID int, msisdn string) (string, error) {
+	claims := &Claims{
+		Msisdn: msisdn,
+		Roles:  []string{RoleUser},
+	}
+
+	return ts.issue(userID, claims, ts.audience, ts.ttl)
+}
+
+// IssueAdminToken returns a signed access token for the admin account with
+// the specified ID and username, granting role and the roles below it
+func (ts *TokenService) IssueAdminToken(accountID int, username, role string) (string, error) {
+	if len(ts.adminAud) == 0 {
+		return "", errors.New("admin audience is not configured")
+	}
+
+	if !IsAdminRole(role) {
+		return "", errors.Errorf("unknown admin role %q", role)
+	}
+
+	claims := &Claims{
+		Username: username,
+		Roles:    GrantedRoles(role),
+	}
+
+	return ts.issue(accountID, claims, ts.adminAud, ts.adminTTL)
+}
+
+func (ts *TokenService) issue(subject int, claims *Claims, audience string, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := ts.now()
+	claims.StandardClaims = jwt.StandardClaims{
+		Id:        jti,
+		Subject:   strconv.Itoa(subject),
+		Issuer:    ts.issuer,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ts.signingKeyID
+
+	return token.SignedString(ts.keys[ts.signingKeyID])
+}
+
+// ParseAccessToken verifies the signature and claims of tokenString and
+// returns its claims. ErrExpiredToken is returned for expired tokens and
+// ErrInvalidToken for any other verification failure, including tokens
+// issued to admin accounts.
+func (ts *TokenService) ParseAccessToken(tokenString string) (*Claims, error) {
+	return ts.parse(tokenString, ts.audience)
+}
+
+// ParseAdminToken is like ParseAccessToken, but only accepts
+// tokens issued to admin accounts
+func (ts *TokenService) ParseAdminToken(tokenString string) (*Claims, error) {
+	if len(ts.adminAud) == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	return ts.parse(tokenString, ts.adminAud)
+}
+
+func (ts *TokenService) parse(tokenString, audience string) (*Claims, error) {
+	claims := &Claims{}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+
+	_, err := parser.ParseWithClaims(tokenString, claims, ts.keyFunc)
+	if err != nil {
+		if verr, ok := err.(*jwt.ValidationError); ok && verr.Errors == jwt.ValidationErrorExpired {
+			return nil, ErrExpiredToken
+		}
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+
+	if !claims.VerifyIssuer(ts.issuer, true) || !claims.VerifyAudience(audience, true) {
+		return nil, ErrInvalidToken
+	}
+
+	if _, err := claims.UserID(); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (ts *TokenService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, errors.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ts.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+func newTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
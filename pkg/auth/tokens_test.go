@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTestTokenService(t *testing.T, kid, key string, verificationKeys map[string]string) *TokenService {
+	ts, err := NewTokenService(TokenConfig{
+		SigningKeyID:     kid,
+		SigningKey:       key,
+		VerificationKeys: verificationKeys,
+		Issuer:           "hoodcops",
+		Audience:         "hoodcops-mobile",
+		TTL:              30 * time.Minute,
+		AdminAudience:    "hoodcops-admin",
+		AdminTTL:         time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return ts
+}
+
+func TestTokenService_IssueAccessToken_ShouldPass(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+
+	token, err := ts.IssueAccessToken(42, "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claims, err := ts.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	userID, _ := claims.UserID()
+	if userID != 42 {
+		t.Fatalf("expected user id %d, got %d", 42, userID)
+	}
+
+	if claims.Msisdn != "+233200662782" {
+		t.Fatalf("expected msisdn %s, got %s", "+233200662782", claims.Msisdn)
+	}
+
+	if claims.Issuer != "hoodcops" || claims.Audience != "hoodcops-mobile" {
+		t.Fatalf("unexpected issuer or audience %s, %s", claims.Issuer, claims.Audience)
+	}
+
+	if claims.IssuedAt == 0 || len(claims.Id) == 0 {
+		t.Fatalf("expected iat and jti to be set, got %d, %q", claims.IssuedAt, claims.Id)
+	}
+
+	principal, err := claims.Principal()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if principal.UserID != 42 || !principal.HasRole(RoleUser) {
+		t.Fatalf("expected principal for user %d with role %s, got %+v", 42, RoleUser, principal)
+	}
+}
+
+func TestTokenService_ParseAccessToken_ShouldAcceptRotatedKey(t *testing.T) {
+	old := newTestTokenService(t, "k1", "0ld53cr3t", nil)
+	token, err := old.IssueAccessToken(1, "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rotated := newTestTokenService(t, "k2", "n3w53cr3t", map[string]string{"k1": "0ld53cr3t"})
+	if _, err := rotated.ParseAccessToken(token); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	retired := newTestTokenService(t, "k2", "n3w53cr3t", nil)
+	if _, err := retired.ParseAccessToken(token); errors.Cause(err) != ErrInvalidToken {
+		t.Fatalf("expected %v, got %v", ErrInvalidToken, err)
+	}
+}
+
+func TestTokenService_ParseAccessToken_ShouldFailForExpiredToken(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+	ts.now = func() time.Time { return time.Now().Add(-time.Hour) }
+
+	token, err := ts.IssueAccessToken(1, "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := ts.ParseAccessToken(token); err != ErrExpiredToken {
+		t.Fatalf("expected %v, got %v", ErrExpiredToken, err)
+	}
+}
+
+func TestTokenService_ParseAccessToken_ShouldFailForWrongAudience(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+	token, err := ts.IssueAccessToken(1, "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ts.audience = "hoodcops-admin"
+	if _, err := ts.ParseAccessToken(token); err != ErrInvalidToken {
+		t.Fatalf("expected %v, got %v", ErrInvalidToken, err)
+	}
+}
+
+func TestTokenService_IssueAdminToken_ShouldGrantLowerRoles(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+
+	token, err := ts.IssueAdminToken(3, "ama", RoleDispatcher)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	claims, err := ts.ParseAdminToken(token)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	principal, err := claims.Principal()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if principal.UserID != 3 || principal.Username != "ama" || len(principal.Msisdn) != 0 {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+
+	if !principal.HasRole(RoleViewer) || !principal.HasRole(RoleDispatcher) || principal.HasRole(RoleSuperadmin) {
+		t.Fatalf("expected viewer and dispatcher roles, got %v", principal.Roles)
+	}
+}
+
+func TestTokenService_IssueAdminToken_ShouldFailForUnknownRole(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+
+	if _, err := ts.IssueAdminToken(3, "ama", RoleUser); err == nil {
+		t.Fatal("expected an error for a role that is not an admin role")
+	}
+}
+
+func TestTokenService_ShouldNotMixMobileAndAdminTokens(t *testing.T) {
+	ts := newTestTokenService(t, "k1", "50m3h@rd2gu355t3xt", nil)
+
+	adminToken, err := ts.IssueAdminToken(3, "ama", RoleSuperadmin)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := ts.ParseAccessToken(adminToken); err != ErrInvalidToken {
+		t.Fatalf("expected %v for an admin token, got %v", ErrInvalidToken, err)
+	}
+
+	mobileToken, err := ts.IssueAccessToken(3, "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := ts.ParseAdminToken(mobileToken); err != ErrInvalidToken {
+		t.Fatalf("expected %v for a mobile token, got %v", ErrInvalidToken, err)
+	}
+}
@@ -0,0 +1,348 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Statuses an alert can be in. Alerts are raised, acknowledged by someone
+// who responds to them, who may then be en route to the alert. Resolved,
+// canceled and false alarm alerts are closed and stay so.
+const (
+	AlertStatusRaised       = "raised"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusEnRoute      = "en_route"
+	AlertStatusResolved     = "resolved"
+	AlertStatusCanceled     = "canceled"
+	AlertStatusFalseAlarm   = "false_alarm"
+)
+
+// alertTransitions holds the statuses alerts in a status can move to
+var alertTransitions = map[string][]string{
+	AlertStatusRaised: {
+		AlertStatusAcknowledged,
+		AlertStatusEnRoute,
+		AlertStatusResolved,
+		AlertStatusCanceled,
+		AlertStatusFalseAlarm,
+	},
+	AlertStatusAcknowledged: {
+		AlertStatusEnRoute,
+		AlertStatusResolved,
+		AlertStatusCanceled,
+		AlertStatusFalseAlarm,
+	},
+	AlertStatusEnRoute: {
+		AlertStatusResolved,
+		AlertStatusCanceled,
+		AlertStatusFalseAlarm,
+	},
+}
+
+// CanTransitionAlert reports whether alerts in status
+// from can move to status to
+func CanTransitionAlert(from, to string) bool {
+	for _, status := range alertTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// alertStatusesBefore returns the statuses alerts can move to status to from
+func alertStatusesBefore(to string) []string {
+	var statuses []string
+	for from := range alertTransitions {
+		if CanTransitionAlert(from, to) {
+			statuses = append(statuses, from)
+		}
+	}
+
+	sort.Strings(statuses)
+	return statuses
+}
+
+// Categories of alerts. Alerts raised without a category are
+// general alerts.
+const (
+	AlertCategoryGeneral  = "general"
+	AlertCategoryMedical  = "medical"
+	AlertCategoryFire     = "fire"
+	AlertCategoryCrime    = "crime"
+	AlertCategoryAccident = "accident"
+)
+
+// IsAlertCategory reports whether category is a known alert category
+func IsAlertCategory(category string) bool {
+	switch category {
+	case AlertCategoryGeneral, AlertCategoryMedical, AlertCategoryFire, AlertCategoryCrime, AlertCategoryAccident:
+		return true
+	default:
+		return false
+	}
+}
+
+// alertColumns selects the columns of an alert aliased a, with its
+// location split into latitude and longitude
+const alertColumns = "a.id, a.user_id, ST_Latitude(a.location) AS geo_lat, ST_Longitude(a.location) AS geo_lng, " +
+	"a.accuracy, a.category, a.message, a.status, a.escalation_level, a.escalate_at, a.created_at, a.updated_at"
+
+// Alert models a panic alert raised by a mobile user at a location.
+// Accuracy is the radius in meters the location is accurate to, or 0
+// when it is unknown. EscalationLevel is the number of circles of people
+// notified about the alert so far, and EscalateAt the time the next
+// circle is notified unless the alert is acknowledged before.
+type Alert struct {
+	ID     int `db:"id" json:"id"`
+	UserID int `db:"user_id" json:"userId"`
+	Coordinate
+	Accuracy        float64      `db:"accuracy" json:"accuracy"`
+	Category        string       `db:"category" json:"category"`
+	Message         string       `db:"message" json:"message"`
+	Status          string       `db:"status" json:"status"`
+	EscalationLevel int          `db:"escalation_level" json:"escalationLevel"`
+	EscalateAt      NullableTime `db:"escalate_at" json:"escalateAt"`
+	CreatedAt       time.Time    `db:"created_at" json:"createdAt"`
+	UpdatedAt       NullableTime `db:"updated_at" json:"updatedAt"`
+}
+
+// AlertEvent records a change of the status of an alert. UserID is
+// the user who made the change.
+type AlertEvent struct {
+	ID        int         `db:"id" json:"id"`
+	AlertID   int         `db:"alert_id" json:"alertId"`
+	Status    string      `db:"status" json:"status"`
+	Note      string      `db:"note" json:"note"`
+	UserID    NullableInt `db:"user_id" json:"userId"`
+	CreatedAt time.Time   `db:"created_at" json:"createdAt"`
+}
+
+// AlertsRepo defines methods for interacting with alert
+// records in the database
+type AlertsRepo struct {
+	db queryer
+}
+
+// NewAlertsRepo returns a new alerts repo
+func NewAlertsRepo(db *sqlx.DB) *AlertsRepo {
+	return &AlertsRepo{
+		db: db,
+	}
+}
+
+// Create saves a new raised alert and the first event of its history into
+// the database, updates the value of ID with the auto-generated value from
+// the database, and returns the alert or error if the operation fails
+func (repo *AlertsRepo) Create(ctx context.Context, alert *Alert) (*Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	alert.Status = AlertStatusRaised
+
+	var id int64
+	err := inTx(ctx, repo.db, func(tx queryer) error {
+		query := "INSERT INTO mobile_user_alerts (user_id, location, accuracy, category, message, status) VALUES(?, " + geomFromText + ", ?, ?, ?, ?)"
+		res, err := tx.ExecContext(
+			ctx,
+			query,
+			alert.UserID,
+			alert.WKT(),
+			alert.Accuracy,
+			alert.Category,
+			alert.Message,
+			alert.Status,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		return insertAlertEvent(ctx, tx, int(id), alert.Status, "", alert.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	alert.ID = int(id)
+	alert.CreatedAt = time.Now()
+	return alert, nil
+}
+
+// GetByID returns the alert with the specified ID, or nil if there
+// is no such alert
+func (repo *AlertsRepo) GetByID(ctx context.Context, id int) (*Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	alert := Alert{}
+
+	query := "SELECT " + alertColumns + " FROM mobile_user_alerts AS a WHERE a.id = ?"
+	err := repo.db.QueryRowxContext(ctx, query, id).StructScan(&alert)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+// GetUserAlerts returns the alerts raised by a mobile user, latest first
+func (repo *AlertsRepo) GetUserAlerts(ctx context.Context, userID int) ([]*Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + alertColumns + " FROM mobile_user_alerts AS a WHERE a.user_id = ? ORDER BY a.created_at DESC, a.id DESC"
+	alerts := []*Alert{}
+
+	err := repo.db.SelectContext(ctx, &alerts, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// GetInBoundingBox returns the alerts raised within box, latest first. When
+// statuses are given, only alerts in one of them are returned.
+func (repo *AlertsRepo) GetInBoundingBox(ctx context.Context, box BoundingBox, statuses ...string) ([]*Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + alertColumns + " FROM mobile_user_alerts AS a WHERE MBRContains(" + geomFromText + ", a.location)"
+	args := []interface{}{box.WKT()}
+
+	if len(statuses) > 0 {
+		q, statusArgs, err := sqlx.In(" AND a.status IN (?)", statuses)
+		if err != nil {
+			return nil, err
+		}
+		query += q
+		args = append(args, statusArgs...)
+	}
+
+	query += " ORDER BY a.created_at DESC, a.id DESC"
+	alerts := []*Alert{}
+
+	err := repo.db.SelectContext(ctx, &alerts, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// Transition moves the alert with the specified ID to status to and records
+// the change in its history. It reports false when the alert is in a status
+// it cannot move to status to from, leaving it unchanged.
+func (repo *AlertsRepo) Transition(ctx context.Context, id int, to, note string, userID int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	from := alertStatusesBefore(to)
+	if len(from) == 0 {
+		return false, nil
+	}
+
+	query, args, err := sqlx.In("UPDATE mobile_user_alerts SET status = ?, updated_at = NOW() WHERE id = ? AND status IN (?)", to, id, from)
+	if err != nil {
+		return false, err
+	}
+
+	updated := false
+	err = inTx(ctx, repo.db, func(tx queryer) error {
+		res, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		updated = rows > 0
+		if err != nil || !updated {
+			return err
+		}
+
+		return insertAlertEvent(ctx, tx, id, to, note, userID)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+// GetDueEscalations returns up to limit raised alerts notified to fewer than
+// maxLevel circles whose next circle is due to be notified at now, oldest
+// first. Alerts that have not been escalated at all are always due.
+func (repo *AlertsRepo) GetDueEscalations(ctx context.Context, now time.Time, maxLevel, limit int) ([]*Alert, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + alertColumns + " FROM mobile_user_alerts AS a " +
+		"WHERE a.status = ? AND a.escalation_level < ? AND (a.escalate_at IS NULL OR a.escalate_at <= ?) " +
+		"ORDER BY a.id LIMIT ?"
+	alerts := []*Alert{}
+
+	err := repo.db.SelectContext(ctx, &alerts, query, AlertStatusRaised, maxLevel, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// ClaimEscalation moves the raised alert with the specified ID from
+// escalation level to the next, to be escalated again at escalateAt. It
+// reports false when the alert is no longer raised or at level, e.g. when
+// another instance of the service escalated it first.
+func (repo *AlertsRepo) ClaimEscalation(ctx context.Context, id, level int, escalateAt NullableTime) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_user_alerts SET escalation_level = ?, escalate_at = ? WHERE id = ? AND escalation_level = ? AND status = ?"
+	res, err := repo.db.ExecContext(ctx, query, level+1, escalateAt, id, level, AlertStatusRaised)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// GetHistory returns the status changes of the alert with the
+// specified ID, oldest first
+func (repo *AlertsRepo) GetHistory(ctx context.Context, alertID int) ([]*AlertEvent, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT * FROM mobile_user_alert_events WHERE alert_id = ? ORDER BY id"
+	events := []*AlertEvent{}
+
+	err := repo.db.SelectContext(ctx, &events, query, alertID)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func insertAlertEvent(ctx context.Context, tx queryer, alertID int, status, note string, userID int) error {
+	query := "INSERT INTO mobile_user_alert_events (alert_id, status, note, user_id) VALUES(?, ?, ?, ?)"
+	_, err := tx.ExecContext(ctx, query, alertID, status, note, userID)
+	return err
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestAlertsRepo_Create_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO mobile_user_alerts \(user_id, location, accuracy, category, message, status\) VALUES\(\?, ST_GeomFromText\(\?, 4326, 'axis-order=long-lat'\), \?, \?, \?, \?\)$`).
+		WithArgs(7, "POINT(-0.187 5.6037)", 12.5, AlertCategoryMedical, "help", AlertStatusRaised).
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectExec(`^INSERT INTO mobile_user_alert_events \(alert_id, status, note, user_id\) VALUES\(\?, \?, \?, \?\)$`).
+		WithArgs(42, AlertStatusRaised, "", 7).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repo := NewAlertsRepo(sqlx.NewDb(db, "sqlmock"))
+	alert, err := repo.Create(context.Background(), &Alert{
+		UserID:     7,
+		Coordinate: Coordinate{Lat: 5.6037, Lng: -0.187},
+		Accuracy:   12.5,
+		Category:   AlertCategoryMedical,
+		Message:    "help",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if alert.ID != 42 || alert.Status != AlertStatusRaised {
+		t.Fatalf("expected raised alert 42, got %+v", alert)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAlertsRepo_Transition_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE mobile_user_alerts SET status = \?, updated_at = NOW\(\) WHERE id = \? AND status IN \(\?, \?, \?\)$`).
+		WithArgs(AlertStatusResolved, 42, AlertStatusAcknowledged, AlertStatusEnRoute, AlertStatusRaised).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO mobile_user_alert_events`).
+		WithArgs(42, AlertStatusResolved, "safe now", 7).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	repo := NewAlertsRepo(sqlx.NewDb(db, "sqlmock"))
+	updated, err := repo.Transition(context.Background(), 42, AlertStatusResolved, "safe now", 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !updated {
+		t.Fatal("expected alert to be updated")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAlertsRepo_Transition_ShouldRejectMovingToRaised(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewAlertsRepo(sqlx.NewDb(db, "sqlmock"))
+	updated, err := repo.Transition(context.Background(), 42, AlertStatusRaised, "", 7)
+	if err != nil || updated {
+		t.Fatalf("expected alert not to be updated, got %v, %v", updated, err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCanTransitionAlert(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{AlertStatusRaised, AlertStatusAcknowledged, true},
+		{AlertStatusAcknowledged, AlertStatusEnRoute, true},
+		{AlertStatusEnRoute, AlertStatusAcknowledged, false},
+		{AlertStatusEnRoute, AlertStatusFalseAlarm, true},
+		{AlertStatusResolved, AlertStatusCanceled, false},
+		{AlertStatusCanceled, AlertStatusRaised, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransitionAlert(tt.from, tt.to); got != tt.want {
+			t.Errorf("%s -> %s: expected %v, got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
+
+func TestAlertsRepo_ClaimEscalation_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	next := time.Date(2018, 10, 1, 12, 5, 0, 0, time.UTC)
+	mock.ExpectExec(`^UPDATE mobile_user_alerts SET escalation_level = \?, escalate_at = \? WHERE id = \? AND escalation_level = \? AND status = \?$`).
+		WithArgs(2, next, 42, 1, AlertStatusRaised).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewAlertsRepo(sqlx.NewDb(db, "sqlmock"))
+	claimed, err := repo.ClaimEscalation(context.Background(), 42, 1, NewNullableTime(next))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if claimed {
+		t.Fatal("expected escalation not to be claimed")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAlertsRepo_GetInBoundingBox_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "geo_lat", "geo_lng", "accuracy", "category", "message", "status", "escalation_level", "escalate_at", "created_at", "updated_at"}).
+		AddRow(42, 7, 5.6037, -0.187, 0.0, AlertCategoryGeneral, "", AlertStatusRaised, 1, nil, time.Now(), nil)
+
+	mock.ExpectQuery(`MBRContains\(ST_GeomFromText\(\?, 4326, 'axis-order=long-lat'\), a.location\) AND a.status IN \(\?\) ORDER BY`).
+		WithArgs("POLYGON((-0.5 5.5, 0 5.5, 0 6, -0.5 6, -0.5 5.5))", AlertStatusRaised).
+		WillReturnRows(rows)
+
+	repo := NewAlertsRepo(sqlx.NewDb(db, "sqlmock"))
+	alerts, err := repo.GetInBoundingBox(context.Background(), BoundingBox{South: 5.5, West: -0.5, North: 6, East: 0}, AlertStatusRaised)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(alerts) != 1 || alerts[0].Lat != 5.6037 || alerts[0].Lng != -0.187 {
+		t.Fatalf("expected alert 42 at 5.6037,-0.187, got %+v", alerts)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
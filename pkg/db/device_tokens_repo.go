@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Platforms of push notification tokens, named after the service
+// that delivers notifications to them
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+)
+
+// IsPlatform reports whether platform is a known push platform
+func IsPlatform(platform string) bool {
+	return platform == PlatformFCM || platform == PlatformAPNs
+}
+
+// DeviceToken is the token a push notification service issued to the
+// app on a mobile user's device. A device has at most one token, and a
+// token belongs to the user who last registered it.
+type DeviceToken struct {
+	ID        int          `db:"id" json:"id"`
+	UserID    int          `db:"user_id" json:"userId"`
+	DeviceID  string       `db:"device_id" json:"deviceId"`
+	Platform  string       `db:"platform" json:"platform"`
+	Token     string       `db:"token" json:"token"`
+	CreatedAt time.Time    `db:"created_at" json:"createdAt"`
+	UpdatedAt NullableTime `db:"updated_at" json:"updatedAt"`
+}
+
+// DeviceTokensRepo defines methods for interacting with device
+// token records in the database
+type DeviceTokensRepo struct {
+	db queryer
+}
+
+// NewDeviceTokensRepo returns a new device tokens repo
+func NewDeviceTokensRepo(db *sqlx.DB) *DeviceTokensRepo {
+	return &DeviceTokensRepo{
+		db: db,
+	}
+}
+
+// Register saves the token of a user's device, replacing the token the
+// device had before. A token already registered by another user or device
+// is moved over to this user and device, since push services only issue
+// a token to a single app install.
+func (repo *DeviceTokensRepo) Register(ctx context.Context, token *DeviceToken) (*DeviceToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	err := inTx(ctx, repo.db, func(tx queryer) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM mobile_user_tokens WHERE user_id = ? AND device_id = ? AND token <> ?", token.UserID, token.DeviceID, token.Token)
+		if err != nil {
+			return err
+		}
+
+		query := `INSERT INTO mobile_user_tokens (user_id, device_id, platform, token) VALUES(?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), user_id = VALUES(user_id), device_id = VALUES(device_id),
+			platform = VALUES(platform), updated_at = NOW()`
+		res, err := tx.ExecContext(ctx, query, token.UserID, token.DeviceID, token.Platform, token.Token)
+		if err != nil {
+			return err
+		}
+
+		id, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetUserTokens returns the tokens of all devices of a mobile user
+func (repo *DeviceTokensRepo) GetUserTokens(ctx context.Context, userID int) ([]*DeviceToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT * FROM mobile_user_tokens WHERE user_id = ? ORDER BY id"
+	tokens := []*DeviceToken{}
+
+	err := repo.db.SelectContext(ctx, &tokens, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Unregister deletes the token of a user's device. It reports false
+// if the device had no token.
+func (repo *DeviceTokensRepo) Unregister(ctx context.Context, userID int, deviceID string) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM mobile_user_tokens WHERE user_id = ? AND device_id = ?", userID, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// DeleteTokens deletes the specified tokens, whichever users they belong
+// to. It is used to clean up tokens push services reported as no longer
+// valid, e.g. because the app was uninstalled.
+func (repo *DeviceTokensRepo) DeleteTokens(ctx context.Context, tokens []string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In("DELETE FROM mobile_user_tokens WHERE token IN (?)", tokens)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.db.ExecContext(ctx, repo.db.Rebind(query), args...)
+	return err
+}
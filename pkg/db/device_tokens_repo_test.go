@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestDeviceTokensRepo_Register_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE FROM mobile_user_tokens WHERE user_id = \? AND device_id = \? AND token <> \?$`).
+		WithArgs(7, "d3v1c3", "t0k3n").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO mobile_user_tokens \(user_id, device_id, platform, token\) VALUES\(\?, \?, \?, \?\)\s+ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID\(id\)`).
+		WithArgs(7, "d3v1c3", PlatformFCM, "t0k3n").
+		WillReturnResult(sqlmock.NewResult(3, 2))
+	mock.ExpectCommit()
+
+	repo := NewDeviceTokensRepo(sqlx.NewDb(db, "sqlmock"))
+	token, err := repo.Register(context.Background(), &DeviceToken{UserID: 7, DeviceID: "d3v1c3", Platform: PlatformFCM, Token: "t0k3n"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if token.ID != 3 {
+		t.Fatalf("expected token ID 3, got %d", token.ID)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeviceTokensRepo_DeleteTokens_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^DELETE FROM mobile_user_tokens WHERE token IN \(\?, \?\)$`).
+		WithArgs("t1", "t2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	repo := NewDeviceTokensRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.DeleteTokens(context.Background(), []string{"t1", "t2"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
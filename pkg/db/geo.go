@@ -0,0 +1,141 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// SRID of the spatial reference system locations are stored in, WGS 84
+const SRID = 4326
+
+// metersPerDegree is the length of a degree of latitude in meters
+const metersPerDegree = 111320.0
+
+// earthRadius is the mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+// geomFromText is the SQL expression of a geometry passed as WKT with
+// longitude before latitude, which is the order Coordinate.WKT and
+// BoundingBox.WKT write them in
+const geomFromText = "ST_GeomFromText(?, 4326, 'axis-order=long-lat')"
+
+// unknownLocation is stored in place of a location that is not known,
+// because columns with a spatial index cannot be null
+const unknownLocation = "POINT(0 0)"
+
+// Errors returned when validating coordinates and bounding boxes
+var (
+	ErrInvalidLatitude    = errors.New("latitude must be between -90 and 90")
+	ErrInvalidLongitude   = errors.New("longitude must be between -180 and 180")
+	ErrInvalidBoundingBox = errors.New("bounding box must not be empty or cross the antimeridian")
+)
+
+// Coordinate is a point on the earth given by its WGS 84 latitude
+// and longitude in degrees
+type Coordinate struct {
+	Lat float64 `db:"geo_lat" json:"geoLat"`
+	Lng float64 `db:"geo_lng" json:"geoLng"`
+}
+
+// NewCoordinate returns the coordinate at lat and lng, or an error
+// if either is out of range
+func NewCoordinate(lat, lng float64) (Coordinate, error) {
+	c := Coordinate{Lat: lat, Lng: lng}
+	return c, c.Validate()
+}
+
+// Validate returns an error if the latitude or longitude
+// of c is out of range
+func (c Coordinate) Validate() error {
+	if math.IsNaN(c.Lat) || c.Lat < -90 || c.Lat > 90 {
+		return ErrInvalidLatitude
+	}
+
+	if math.IsNaN(c.Lng) || c.Lng < -180 || c.Lng > 180 {
+		return ErrInvalidLongitude
+	}
+
+	return nil
+}
+
+// WKT returns c as a well-known text point, longitude first
+func (c Coordinate) WKT() string {
+	return fmt.Sprintf("POINT(%s %s)", formatDegrees(c.Lng), formatDegrees(c.Lat))
+}
+
+// Distance returns the great-circle distance in meters between a and b
+func Distance(a, b Coordinate) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// BoundingBox is the area between two parallels and two meridians
+type BoundingBox struct {
+	South float64 `json:"south"`
+	West  float64 `json:"west"`
+	North float64 `json:"north"`
+	East  float64 `json:"east"`
+}
+
+// Around returns the smallest bounding box containing every point
+// within meters of c. It is clamped to the valid range of coordinates,
+// so it never crosses a pole or the antimeridian.
+func Around(c Coordinate, meters float64) BoundingBox {
+	dLat := meters / metersPerDegree
+	box := BoundingBox{
+		South: math.Max(c.Lat-dLat, -90),
+		North: math.Min(c.Lat+dLat, 90),
+		West:  -180,
+		East:  180,
+	}
+
+	// near the poles the box spans every meridian
+	cos := math.Cos(math.Max(math.Abs(box.South), math.Abs(box.North)) * math.Pi / 180)
+	if cos > 1e-9 {
+		dLng := meters / (metersPerDegree * cos)
+		if dLng < 180 {
+			box.West = math.Max(c.Lng-dLng, -180)
+			box.East = math.Min(c.Lng+dLng, 180)
+		}
+	}
+
+	return box
+}
+
+// Validate returns an error if a corner of box is out of range,
+// or box is empty or crosses the antimeridian
+func (box BoundingBox) Validate() error {
+	for _, c := range []Coordinate{{box.South, box.West}, {box.North, box.East}} {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if box.South >= box.North || box.West >= box.East {
+		return ErrInvalidBoundingBox
+	}
+
+	return nil
+}
+
+// Contains reports whether c lies within box
+func (box BoundingBox) Contains(c Coordinate) bool {
+	return c.Lat >= box.South && c.Lat <= box.North && c.Lng >= box.West && c.Lng <= box.East
+}
+
+// WKT returns box as a well-known text polygon, longitude first
+func (box BoundingBox) WKT() string {
+	s, w := formatDegrees(box.South), formatDegrees(box.West)
+	n, e := formatDegrees(box.North), formatDegrees(box.East)
+	return fmt.Sprintf("POLYGON((%s %s, %s %s, %s %s, %s %s, %s %s))", w, s, e, s, e, n, w, n, w, s)
+}
+
+func formatDegrees(deg float64) string {
+	return strconv.FormatFloat(deg, 'f', -1, 64)
+}
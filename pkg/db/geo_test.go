@@ -0,0 +1,68 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoordinate_Validate(t *testing.T) {
+	tests := []struct {
+		c    Coordinate
+		want error
+	}{
+		{Coordinate{Lat: 5.6037, Lng: -0.187}, nil},
+		{Coordinate{Lat: -90, Lng: 180}, nil},
+		{Coordinate{Lat: 90.5, Lng: 0}, ErrInvalidLatitude},
+		{Coordinate{Lat: math.NaN(), Lng: 0}, ErrInvalidLatitude},
+		{Coordinate{Lat: 0, Lng: -180.1}, ErrInvalidLongitude},
+	}
+
+	for _, tt := range tests {
+		if got := tt.c.Validate(); got != tt.want {
+			t.Errorf("%+v: expected %v, got %v", tt.c, tt.want, got)
+		}
+	}
+}
+
+func TestCoordinate_WKT(t *testing.T) {
+	got := Coordinate{Lat: 5.6037, Lng: -0.187}.WKT()
+	if got != "POINT(-0.187 5.6037)" {
+		t.Fatalf("expected longitude first, got %s", got)
+	}
+}
+
+func TestAround(t *testing.T) {
+	box := Around(Coordinate{Lat: 0, Lng: 0}, metersPerDegree)
+	if box.South != -1 || box.North != 1 || box.West > -1 || box.East < 1 {
+		t.Fatalf("expected a box of at least one degree around the origin, got %+v", box)
+	}
+
+	box = Around(Coordinate{Lat: 89.9, Lng: 179.9}, 50000)
+	if box.North != 90 || box.West != -180 || box.East != 180 {
+		t.Fatalf("expected a box clamped at the pole spanning every meridian, got %+v", box)
+	}
+
+	if err := box.Validate(); err != nil {
+		t.Fatalf("expected a valid box, got %v", err)
+	}
+}
+
+func TestBoundingBox_Validate(t *testing.T) {
+	err := BoundingBox{South: 5, West: 179, North: 6, East: -179}.Validate()
+	if err != ErrInvalidBoundingBox {
+		t.Fatalf("expected a box crossing the antimeridian to be invalid, got %v", err)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	accra := Coordinate{Lat: 5.6037, Lng: -0.187}
+	kumasi := Coordinate{Lat: 6.6885, Lng: -1.6244}
+
+	if d := Distance(accra, accra); d != 0 {
+		t.Fatalf("expected no distance to the same point, got %v", d)
+	}
+
+	if d := Distance(accra, kumasi); d < 199000 || d > 201000 {
+		t.Fatalf("expected about 200km from Accra to Kumasi, got %vm", d)
+	}
+}
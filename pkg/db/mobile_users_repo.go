@@ -1,25 +1,54 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"strings"
 	"time"
 
+	"github.com/hoodcops/xcore/pkg/phone"
 	"github.com/jmoiron/sqlx"
 )
 
-// MobileUser is any user who signs up onto the platform
-// via the mobile app with a verified phone number
+// MobileUser is any user who signs up onto the platform via the mobile app
+// with a verified phone number. Suspended users cannot sign in, and access
+// tokens issued before SessionsRevokedAt are no longer accepted.
 type MobileUser struct {
-	ID          int          `db:"id" json:"id"`
-	Msisdn      string       `db:"msisdn" json:"msisdn"`
-	CreatedAt   time.Time    `db:"created_at" json:"createdAt"`
-	LastLoginAt NullableTime `db:"last_login_at" json:"lastLoginAt"`
+	ID                int          `db:"id" json:"id"`
+	Msisdn            string       `db:"msisdn" json:"msisdn"`
+	CreatedAt         time.Time    `db:"created_at" json:"createdAt"`
+	LastLoginAt       NullableTime `db:"last_login_at" json:"lastLoginAt"`
+	SuspendedAt       NullableTime `db:"suspended_at" json:"suspendedAt"`
+	SessionsRevokedAt NullableTime `db:"sessions_revoked_at" json:"-"`
+}
+
+// IsSuspended reports whether the user has been suspended
+func (user *MobileUser) IsSuspended() bool {
+	return user.SuspendedAt.Valid
+}
+
+// MobileUserListing is a mobile user as listed in search results,
+// with the name on their profile if they have one
+type MobileUserListing struct {
+	MobileUser
+	Fullname string `db:"fullname" json:"fullname"`
+}
+
+// userTables are the tables, apart from mobile_users, with records that
+// belong to a mobile user, in the order they are deleted with the user
+var userTables = []string{
+	"mobile_user_tokens",
+	"mobile_user_refresh_tokens",
+	"mobile_user_contact_declines",
+	"mobile_user_contacts",
+	"mobile_user_profiles",
+	"mobile_user_alerts",
 }
 
 // MobileUsersRepo defines methods for interacting with mobile user
 // records in the database
 type MobileUsersRepo struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewMobileUsersRepo returns a new mobile users repo
@@ -32,10 +61,18 @@ func NewMobileUsersRepo(db *sqlx.DB) *MobileUsersRepo {
 
 // Create saves a new mobile user value into the database, updates
 // the value with the ID auto-generated by the database, and returns
-// the mobile user value or error if the operation fails
-func (repo *MobileUsersRepo) Create(user *MobileUser) (*MobileUser, error) {
+// the mobile user value or error if the operation fails. The user's
+// msisdn must be in E.164 format.
+func (repo *MobileUsersRepo) Create(ctx context.Context, user *MobileUser) (*MobileUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if !phone.IsE164(user.Msisdn) {
+		return nil, phone.ErrInvalidNumber
+	}
+
 	query := "INSERT INTO mobile_users (msisdn) VALUES(?)"
-	res, err := repo.db.Exec(query, user.Msisdn)
+	res, err := repo.db.ExecContext(ctx, query, user.Msisdn)
 	if err != nil {
 		return nil, err
 	}
@@ -51,11 +88,14 @@ func (repo *MobileUsersRepo) Create(user *MobileUser) (*MobileUser, error) {
 
 // GetAll returns records of all mobile users in the database,
 // or an error if the operation fails
-func (repo *MobileUsersRepo) GetAll() ([]*MobileUser, error) {
+func (repo *MobileUsersRepo) GetAll(ctx context.Context) ([]*MobileUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := "SELECT * FROM mobile_users"
 	var users []*MobileUser
 
-	err := repo.db.Select(&users, query)
+	err := repo.db.SelectContext(ctx, &users, query)
 	if err != nil {
 		return nil, err
 	}
@@ -63,14 +103,54 @@ func (repo *MobileUsersRepo) GetAll() ([]*MobileUser, error) {
 	return users, nil
 }
 
+// GetActiveMsisdns returns the msisdns of all the mobile users
+// who are not suspended
+func (repo *MobileUsersRepo) GetActiveMsisdns(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT msisdn FROM mobile_users WHERE suspended_at IS NULL"
+	var msisdns []string
+
+	err := repo.db.SelectContext(ctx, &msisdns, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return msisdns, nil
+}
+
+// GetByID returns the record of the mobile user with the specified ID,
+// or nil if there is no such user
+func (repo *MobileUsersRepo) GetByID(ctx context.Context, id int) (*MobileUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	user := MobileUser{}
+
+	query := "SELECT u.* FROM mobile_users AS u WHERE u.id = ?"
+	err := repo.db.QueryRowxContext(ctx, query, id).StructScan(&user)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 // GetByPhoneNumber queries the database to return the record of the mobile
-// user with the specified msisdn. It also returns an error if the
-// operation fails
-func (repo *MobileUsersRepo) GetByPhoneNumber(phoneNumber string) (*MobileUser, error) {
+// user with the specified msisdn, given in E.164 format. It also returns an
+// error if the operation fails
+func (repo *MobileUsersRepo) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*MobileUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	user := MobileUser{}
 
 	query := "SELECT u.* FROM mobile_users AS u WHERE u.msisdn = ?"
-	err := repo.db.QueryRowx(query, phoneNumber).StructScan(&user)
+	err := repo.db.QueryRowxContext(ctx, query, phoneNumber).StructScan(&user)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -80,3 +160,119 @@ func (repo *MobileUsersRepo) GetByPhoneNumber(phoneNumber string) (*MobileUser,
 
 	return &user, nil
 }
+
+// Search returns up to limit mobile users, after skipping offset, whose
+// msisdn or profile name contains query, newest first, and the number of
+// users matching query. An empty query matches every user.
+func (repo *MobileUsersRepo) Search(ctx context.Context, query string, limit, offset int) ([]*MobileUserListing, int, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	from := "FROM mobile_users AS u LEFT JOIN mobile_user_profiles AS p ON p.user_id = u.id"
+	var args []interface{}
+
+	if len(query) > 0 {
+		pattern := "%" + escapeLike(query) + "%"
+		from += " WHERE u.msisdn LIKE ? OR p.fullname LIKE ?"
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	err := repo.db.GetContext(ctx, &total, "SELECT COUNT(*) "+from, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []*MobileUserListing{}
+	if total == 0 {
+		return users, 0, nil
+	}
+
+	selectQuery := "SELECT u.*, COALESCE(p.fullname, '') AS fullname " + from + " ORDER BY u.id DESC LIMIT ? OFFSET ?"
+	err = repo.db.SelectContext(ctx, &users, selectQuery, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// Suspend suspends the mobile user with the specified ID. Suspending
+// a user who is already suspended keeps the time of the first suspension.
+func (repo *MobileUsersRepo) Suspend(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_users SET suspended_at = NOW() WHERE id = ? AND suspended_at IS NULL"
+	_, err := repo.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Unsuspend lifts the suspension of the mobile user with the specified ID
+func (repo *MobileUsersRepo) Unsuspend(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_users SET suspended_at = NULL WHERE id = ?"
+	_, err := repo.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// RevokeSessions ends every session of the mobile user with the specified
+// ID, so that access tokens issued to the user before at are rejected
+func (repo *MobileUsersRepo) RevokeSessions(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_users SET sessions_revoked_at = ? WHERE id = ?"
+	_, err := repo.db.ExecContext(ctx, query, at, id)
+	return err
+}
+
+// Delete deletes the mobile user with the specified ID along with their
+// records: devices, sessions, contacts, profile, and alerts with their
+// history and notifications. Events the user recorded on alerts of other
+// users are kept, without the user. It reports false if there is no such
+// user.
+func (repo *MobileUsersRepo) Delete(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	queries := []string{
+		"DELETE e FROM mobile_user_alert_events AS e JOIN mobile_user_alerts AS a ON a.id = e.alert_id WHERE a.user_id = ?",
+		"DELETE n FROM alert_notification_attempts AS n JOIN mobile_user_alerts AS a ON a.id = n.alert_id WHERE a.user_id = ?",
+		"UPDATE mobile_user_alert_events SET user_id = NULL WHERE user_id = ?",
+	}
+	for _, table := range userTables {
+		queries = append(queries, "DELETE FROM "+table+" WHERE user_id = ?")
+	}
+
+	deleted := false
+	err := inTx(ctx, repo.db, func(tx queryer) error {
+		for _, query := range queries {
+			_, err := tx.ExecContext(ctx, query, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, "DELETE FROM mobile_users WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		deleted = n == 1
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// escapeLike escapes the characters of s that are wildcards in LIKE patterns
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -29,7 +31,7 @@ func TestMobileUsersRepo_Create_ShouldPass(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 
 	repo := NewMobileUsersRepo(dbMock)
-	savedUser, err := repo.Create(&user)
+	savedUser, err := repo.Create(context.Background(), &user)
 	if err != nil {
 		t.Errorf("expected no error, got %v", err)
 	}
@@ -69,7 +71,7 @@ func TestMobileUsersRepo_Create_ShouldFail(t *testing.T) {
 	dbMock := sqlx.NewDb(db, "sqlmock")
 
 	repo := NewMobileUsersRepo(dbMock)
-	savedUser, err := repo.Create(&user)
+	savedUser, err := repo.Create(context.Background(), &user)
 
 	if err == nil {
 		t.Fatalf("expected error, got nil")
@@ -84,3 +86,125 @@ func TestMobileUsersRepo_Create_ShouldFail(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestMobileUsersRepo_Search_ShouldPass(t *testing.T) {
+	countSQL := `^SELECT COUNT\(\*\) FROM mobile_users AS u LEFT JOIN mobile_user_profiles AS p ON p.user_id = u.id WHERE u.msisdn LIKE \? OR p.fullname LIKE \?$`
+	selectSQL := `^SELECT u.\*, COALESCE\(p.fullname, ''\) AS fullname FROM mobile_users AS u LEFT JOIN mobile_user_profiles AS p ON p.user_id = u.id WHERE u.msisdn LIKE \? OR p.fullname LIKE \? ORDER BY u.id DESC LIMIT \? OFFSET \?$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(countSQL).
+		WithArgs(`%100\%%`, `%100\%%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(21))
+
+	mock.ExpectQuery(selectSQL).
+		WithArgs(`%100\%%`, `%100\%%`, 20, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "msisdn", "created_at", "last_login_at", "suspended_at", "sessions_revoked_at", "fullname"}).
+			AddRow(1, "+233200662782", time.Now(), nil, nil, nil, "Kofi 100% Mensah"))
+
+	repo := NewMobileUsersRepo(sqlx.NewDb(db, "sqlmock"))
+	users, total, err := repo.Search(context.Background(), "100%", 20, 20)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if total != 21 || len(users) != 1 || users[0].Fullname != "Kofi 100% Mensah" || users[0].IsSuspended() {
+		t.Fatalf("unexpected search results %d %+v", total, users)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMobileUsersRepo_Delete_ShouldCascade(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE e FROM mobile_user_alert_events AS e JOIN mobile_user_alerts AS a ON a.id = e.alert_id WHERE a.user_id = \?$`).
+		WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`^DELETE n FROM alert_notification_attempts AS n JOIN mobile_user_alerts AS a ON a.id = n.alert_id WHERE a.user_id = \?$`).
+		WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^UPDATE mobile_user_alert_events SET user_id = NULL WHERE user_id = \?$`).
+		WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range userTables {
+		mock.ExpectExec(`^DELETE FROM ` + table + ` WHERE user_id = \?$`).
+			WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`^DELETE FROM mobile_users WHERE id = \?$`).
+		WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := NewMobileUsersRepo(sqlx.NewDb(db, "sqlmock"))
+	deleted, err := repo.Delete(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !deleted {
+		t.Fatal("expected user to be deleted")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMobileUsersRepo_Delete_ShouldRollBackOnError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^DELETE e FROM mobile_user_alert_events`).
+		WithArgs(7).WillReturnError(errors.New("lock wait timeout exceeded"))
+	mock.ExpectRollback()
+
+	repo := NewMobileUsersRepo(sqlx.NewDb(db, "sqlmock"))
+	_, err = repo.Delete(context.Background(), 7)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMobileUsersRepo_GetActiveMsisdns_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`^SELECT msisdn FROM mobile_users WHERE suspended_at IS NULL$`).
+		WillReturnRows(sqlmock.NewRows([]string{"msisdn"}).AddRow("+233200662782").AddRow("+233244111111"))
+
+	repo := NewMobileUsersRepo(sqlx.NewDb(db, "sqlmock"))
+	msisdns, err := repo.GetActiveMsisdns(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(msisdns) != 2 || msisdns[0] != "+233200662782" {
+		t.Fatalf("unexpected msisdns %v", msisdns)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
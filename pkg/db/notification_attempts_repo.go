@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Statuses of notification attempts
+const (
+	NotificationStatusSent   = "sent"
+	NotificationStatusFailed = "failed"
+)
+
+// NotificationAttempt records an attempt to notify someone of an alert,
+// e.g. sending an SMS to an emergency contact of the user who raised it.
+// Attempt numbers the attempts made to reach the same recipient, starting
+// at 1, and Error holds the reason a failed attempt failed.
+type NotificationAttempt struct {
+	ID        int         `db:"id" json:"id"`
+	AlertID   int         `db:"alert_id" json:"alertId"`
+	ContactID NullableInt `db:"contact_id" json:"contactId"`
+	Channel   string      `db:"channel" json:"channel"`
+	Recipient string      `db:"recipient" json:"recipient"`
+	Attempt   int         `db:"attempt" json:"attempt"`
+	Status    string      `db:"status" json:"status"`
+	Error     string      `db:"error" json:"error"`
+	CreatedAt time.Time   `db:"created_at" json:"createdAt"`
+}
+
+// NotificationAttemptsRepo defines methods for interacting with
+// notification attempt records in the database
+type NotificationAttemptsRepo struct {
+	db queryer
+}
+
+// NewNotificationAttemptsRepo returns a new notification attempts repo
+func NewNotificationAttemptsRepo(db *sqlx.DB) *NotificationAttemptsRepo {
+	return &NotificationAttemptsRepo{
+		db: db,
+	}
+}
+
+// Create saves a new notification attempt into the database, updates the
+// value of ID with the auto-generated value from the database, and returns
+// the attempt or error if the operation fails
+func (repo *NotificationAttemptsRepo) Create(ctx context.Context, attempt *NotificationAttempt) (*NotificationAttempt, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO alert_notification_attempts (alert_id, contact_id, channel, recipient, attempt, status, error) VALUES(?, ?, ?, ?, ?, ?, ?)"
+	res, err := repo.db.ExecContext(
+		ctx,
+		query,
+		attempt.AlertID,
+		attempt.ContactID,
+		attempt.Channel,
+		attempt.Recipient,
+		attempt.Attempt,
+		attempt.Status,
+		attempt.Error,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.ID = int(id)
+	return attempt, nil
+}
+
+// GetByAlert returns the notification attempts made for the alert with
+// the specified ID, oldest first
+func (repo *NotificationAttemptsRepo) GetByAlert(ctx context.Context, alertID int) ([]*NotificationAttempt, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT * FROM alert_notification_attempts WHERE alert_id = ? ORDER BY id"
+	attempts := []*NotificationAttempt{}
+
+	err := repo.db.SelectContext(ctx, &attempts, query, alertID)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -13,6 +14,11 @@ type NullableTime struct {
 	mysql.NullTime
 }
 
+// NewNullableTime returns a valid NullableTime holding t
+func NewNullableTime(t time.Time) NullableTime {
+	return NullableTime{mysql.NullTime{Time: t, Valid: true}}
+}
+
 // MarshalJSON determines how a NullableTime is
 // marshalled into JSON
 func (nt *NullableTime) MarshalJSON() ([]byte, error) {
@@ -22,3 +28,18 @@ func (nt *NullableTime) MarshalJSON() ([]byte, error) {
 	val := fmt.Sprintf("\"%s\"", nt.Time.Format(time.RFC3339))
 	return []byte(val), nil
 }
+
+// NullableInt represent an integer column
+// that can be null
+type NullableInt struct {
+	sql.NullInt64
+}
+
+// MarshalJSON determines how a NullableInt is
+// marshalled into JSON
+func (ni *NullableInt) MarshalJSON() ([]byte, error) {
+	if !ni.Valid {
+		return []byte("null"), nil
+	}
+	return []byte(fmt.Sprintf("%d", ni.Int64)), nil
+}
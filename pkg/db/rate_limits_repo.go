@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RateLimit is the state of a rate limited key, e.g. the number of SMS
+// messages sent to a phone number. Tokens and UpdatedAt hold the state of
+// a token bucket, Count and WindowEndsAt the number of events in the current
+// window, and NextAllowedAt the end of the current cooldown.
+type RateLimit struct {
+	Key           string       `db:"rate_key"`
+	Tokens        float64      `db:"tokens"`
+	Count         int          `db:"count"`
+	WindowEndsAt  NullableTime `db:"window_ends_at"`
+	NextAllowedAt NullableTime `db:"next_allowed_at"`
+	UpdatedAt     NullableTime `db:"updated_at"`
+}
+
+// RateLimitsRepo defines methods for interacting with rate limit
+// records in the database
+type RateLimitsRepo struct {
+	db queryer
+}
+
+// NewRateLimitsRepo returns a new rate limits repo
+func NewRateLimitsRepo(db *sqlx.DB) *RateLimitsRepo {
+	return &RateLimitsRepo{
+		db: db,
+	}
+}
+
+// Update loads the rate limit state of key, passes it to fn and saves the
+// state fn leaves behind, unless fn returns an error. The record of key is
+// locked for the duration of the update, so concurrent updates of the same
+// key, even from different processes, are applied one after the other.
+// fn is run again if the transaction is retried after a deadlock.
+func (repo *RateLimitsRepo) Update(ctx context.Context, key string, fn func(limit *RateLimit) error) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return inTx(ctx, repo.db, func(tx queryer) error {
+		_, err := tx.ExecContext(ctx, "INSERT IGNORE INTO rate_limits (rate_key) VALUES(?)", key)
+		if err != nil {
+			return err
+		}
+
+		limit := RateLimit{}
+		err = tx.QueryRowxContext(ctx, "SELECT l.* FROM rate_limits AS l WHERE l.rate_key = ? FOR UPDATE", key).StructScan(&limit)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&limit)
+		if err != nil {
+			return err
+		}
+
+		query := "UPDATE rate_limits SET tokens = ?, count = ?, window_ends_at = ?, next_allowed_at = ?, updated_at = ? WHERE rate_key = ?"
+		_, err = tx.ExecContext(
+			ctx,
+			query,
+			limit.Tokens,
+			limit.Count,
+			limit.WindowEndsAt,
+			limit.NextAllowedAt,
+			limit.UpdatedAt,
+			key,
+		)
+		return err
+	})
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRateLimitsRepo_Update_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT IGNORE INTO rate_limits \(rate_key\) VALUES\(\?\)$`).
+		WithArgs("sms:ip:10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT l.\* FROM rate_limits AS l WHERE l.rate_key = \? FOR UPDATE$`).
+		WithArgs("sms:ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"rate_key", "tokens", "count", "window_ends_at", "next_allowed_at", "updated_at"}).
+			AddRow("sms:ip:10.0.0.1", 2.5, 1, nil, nil, nil))
+	mock.ExpectExec(`^UPDATE rate_limits SET tokens = \?, count = \?, window_ends_at = \?, next_allowed_at = \?, updated_at = \? WHERE rate_key = \?$`).
+		WithArgs(1.5, 2, nil, nil, nil, "sms:ip:10.0.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := NewRateLimitsRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.Update(context.Background(), "sms:ip:10.0.0.1", func(limit *RateLimit) error {
+		limit.Tokens--
+		limit.Count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRateLimitsRepo_Update_ShouldRollbackWhenDenied(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT IGNORE INTO rate_limits`).
+		WithArgs("sms:global").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`^SELECT l.\* FROM rate_limits AS l`).
+		WithArgs("sms:global").
+		WillReturnRows(sqlmock.NewRows([]string{"rate_key", "tokens", "count", "window_ends_at", "next_allowed_at", "updated_at"}).
+			AddRow("sms:global", 0, 0, nil, nil, nil))
+	mock.ExpectRollback()
+
+	denied := errors.New("denied")
+
+	repo := NewRateLimitsRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.Update(context.Background(), "sms:global", func(limit *RateLimit) error {
+		return denied
+	})
+	if err != denied {
+		t.Fatalf("expected %v, got %v", denied, err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RefreshToken is a long-lived token a mobile user's device exchanges for new
+// access tokens. Only the hash of the token is stored. Every refresh token
+// issued from the same sign-in shares a family ID so that the whole chain can
+// be revoked when reuse of a rotated token is detected.
+type RefreshToken struct {
+	ID        int          `db:"id" json:"id"`
+	UserID    int          `db:"user_id" json:"userId"`
+	FamilyID  string       `db:"family_id" json:"familyId"`
+	DeviceID  string       `db:"device_id" json:"deviceId"`
+	TokenHash string       `db:"token_hash" json:"-"`
+	ExpiresAt time.Time    `db:"expires_at" json:"expiresAt"`
+	UsedAt    NullableTime `db:"used_at" json:"usedAt"`
+	RevokedAt NullableTime `db:"revoked_at" json:"revokedAt"`
+	CreatedAt time.Time    `db:"created_at" json:"createdAt"`
+}
+
+// RefreshTokensRepo defines methods for interacting with refresh
+// token records in the database
+type RefreshTokensRepo struct {
+	db queryer
+}
+
+// NewRefreshTokensRepo returns a new refresh tokens repo
+func NewRefreshTokensRepo(db *sqlx.DB) *RefreshTokensRepo {
+	return &RefreshTokensRepo{
+		db: db,
+	}
+}
+
+// Create saves a new refresh token into the database, updates the value
+// with the ID auto-generated by the database, and returns the refresh
+// token or error if the operation fails
+func (repo *RefreshTokensRepo) Create(ctx context.Context, token *RefreshToken) (*RefreshToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO mobile_user_refresh_tokens (user_id, family_id, device_id, token_hash, expires_at) VALUES(?, ?, ?, ?, ?)"
+	res, err := repo.db.ExecContext(
+		ctx,
+		query,
+		token.UserID,
+		token.FamilyID,
+		token.DeviceID,
+		token.TokenHash,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetByHash returns the refresh token with the specified hash, or nil
+// if there is no such token
+func (repo *RefreshTokensRepo) GetByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	token := RefreshToken{}
+
+	query := "SELECT t.* FROM mobile_user_refresh_tokens AS t WHERE t.token_hash = ?"
+	err := repo.db.QueryRowxContext(ctx, query, hash).StructScan(&token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkUsed records that the refresh token with the specified ID has been
+// exchanged. It returns false if the token had already been used or revoked,
+// which happens when two requests race to rotate the same token.
+func (repo *RefreshTokensRepo) MarkUsed(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_user_refresh_tokens SET used_at = NOW() WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL"
+	res, err := repo.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// RevokeFamily revokes every refresh token descended from the same sign-in
+func (repo *RefreshTokensRepo) RevokeFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_user_refresh_tokens SET revoked_at = NOW() WHERE family_id = ? AND revoked_at IS NULL"
+	_, err := repo.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// RevokeDevice revokes every refresh token issued to a user's device
+func (repo *RefreshTokensRepo) RevokeDevice(ctx context.Context, userID int, deviceID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_user_refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND device_id = ? AND revoked_at IS NULL"
+	_, err := repo.db.ExecContext(ctx, query, userID, deviceID)
+	return err
+}
+
+// RevokeUser revokes every refresh token issued to a user
+func (repo *RefreshTokensRepo) RevokeUser(ctx context.Context, userID int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_user_refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL"
+	_, err := repo.db.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestRefreshTokensRepo_MarkUsed_ShouldPass(t *testing.T) {
+	sql := `^UPDATE mobile_user_refresh_tokens SET used_at = NOW\(\) WHERE id = \? AND used_at IS NULL AND revoked_at IS NULL$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(sql).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewRefreshTokensRepo(sqlx.NewDb(db, "sqlmock"))
+	ok, err := repo.MarkUsed(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !ok {
+		t.Fatal("expected token to be marked as used")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRefreshTokensRepo_MarkUsed_ShouldFailForUsedToken(t *testing.T) {
+	sql := `^UPDATE mobile_user_refresh_tokens SET used_at = NOW\(\) WHERE id = \? AND used_at IS NULL AND revoked_at IS NULL$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(sql).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewRefreshTokensRepo(sqlx.NewDb(db, "sqlmock"))
+	ok, err := repo.MarkUsed(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ok {
+		t.Fatal("expected already used token not to be marked again")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
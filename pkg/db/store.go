@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// MobileUsers is implemented by *MobileUsersRepo
+type MobileUsers interface {
+	Create(ctx context.Context, user *MobileUser) (*MobileUser, error)
+	GetAll(ctx context.Context) ([]*MobileUser, error)
+	GetActiveMsisdns(ctx context.Context) ([]string, error)
+	GetByID(ctx context.Context, id int) (*MobileUser, error)
+	GetByPhoneNumber(ctx context.Context, phoneNumber string) (*MobileUser, error)
+	Search(ctx context.Context, query string, limit, offset int) ([]*MobileUserListing, int, error)
+	Suspend(ctx context.Context, id int) error
+	Unsuspend(ctx context.Context, id int) error
+	RevokeSessions(ctx context.Context, id int, at time.Time) error
+	Delete(ctx context.Context, id int) (bool, error)
+}
+
+// UserProfiles is implemented by *UserProfilesRepo
+type UserProfiles interface {
+	Create(ctx context.Context, profile *UserProfile) (*UserProfile, error)
+	GetAll(ctx context.Context) ([]*UserProfile, error)
+	GetByUserID(ctx context.Context, userID int) (*UserProfile, error)
+	GetNear(ctx context.Context, point Coordinate, meters float64, respondersOnly bool) ([]*NearbyUser, error)
+	SetResponder(ctx context.Context, userID int, responder bool) error
+}
+
+// UserContacts is implemented by *UserContactsRepo
+type UserContacts interface {
+	SyncContacts(ctx context.Context, userID int, contacts []*UserContact, mode string, limit int) (*ContactsSync, error)
+	GetAll(ctx context.Context) ([]*UserContact, error)
+	GetUserContacts(ctx context.Context, userID int) ([]*UserContact, error)
+	GetUserContact(ctx context.Context, userID, id int) (*UserContact, error)
+	UpdateContact(ctx context.Context, contact *UserContact) (bool, error)
+	DeleteContact(ctx context.Context, userID, id int) (bool, error)
+	GetByID(ctx context.Context, id int) (*UserContact, error)
+	MarkInvited(ctx context.Context, id int, at time.Time) error
+	Respond(ctx context.Context, id int, status string) error
+}
+
+// Alerts is implemented by *AlertsRepo
+type Alerts interface {
+	Create(ctx context.Context, alert *Alert) (*Alert, error)
+	GetByID(ctx context.Context, id int) (*Alert, error)
+	GetUserAlerts(ctx context.Context, userID int) ([]*Alert, error)
+	GetInBoundingBox(ctx context.Context, box BoundingBox, statuses ...string) ([]*Alert, error)
+	Transition(ctx context.Context, id int, to, note string, userID int) (bool, error)
+	GetDueEscalations(ctx context.Context, now time.Time, maxLevel, limit int) ([]*Alert, error)
+	ClaimEscalation(ctx context.Context, id, level int, escalateAt NullableTime) (bool, error)
+	GetHistory(ctx context.Context, alertID int) ([]*AlertEvent, error)
+}
+
+// DeviceTokens is implemented by *DeviceTokensRepo
+type DeviceTokens interface {
+	Register(ctx context.Context, token *DeviceToken) (*DeviceToken, error)
+	GetUserTokens(ctx context.Context, userID int) ([]*DeviceToken, error)
+	Unregister(ctx context.Context, userID int, deviceID string) (bool, error)
+	DeleteTokens(ctx context.Context, tokens []string) error
+}
+
+// RefreshTokens is implemented by *RefreshTokensRepo
+type RefreshTokens interface {
+	Create(ctx context.Context, token *RefreshToken) (*RefreshToken, error)
+	GetByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	MarkUsed(ctx context.Context, id int) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeDevice(ctx context.Context, userID int, deviceID string) error
+	RevokeUser(ctx context.Context, userID int) error
+}
+
+// UserAccounts is implemented by *UserAccountsRepo
+type UserAccounts interface {
+	Create(ctx context.Context, account *UserAccount) (*UserAccount, error)
+	Update(ctx context.Context, account *UserAccount) error
+	GetByID(ctx context.Context, id int) (*UserAccount, error)
+	GetByUsername(ctx context.Context, username string) (*UserAccount, error)
+	RecordLogin(ctx context.Context, id int) error
+	RecordFailedLogin(ctx context.Context, id, maxFailures int, lockUntil time.Time) error
+	SetPassword(ctx context.Context, id int, hash string) error
+}
+
+// NotificationAttempts is implemented by *NotificationAttemptsRepo
+type NotificationAttempts interface {
+	Create(ctx context.Context, attempt *NotificationAttempt) (*NotificationAttempt, error)
+	GetByAlert(ctx context.Context, alertID int) ([]*NotificationAttempt, error)
+}
+
+// VerificationCodes is implemented by *VerificationCodesRepo
+type VerificationCodes interface {
+	Create(ctx context.Context, code *VerificationCode) (*VerificationCode, error)
+	GetLatest(ctx context.Context, msisdn string) (*VerificationCode, error)
+	UseAttempt(ctx context.Context, id, maxAttempts int) (bool, error)
+	MarkVerified(ctx context.Context, id int) (bool, error)
+	CancelPending(ctx context.Context, msisdn string) error
+}
+
+// VerificationTickets is implemented by *VerificationTicketsRepo
+type VerificationTickets interface {
+	Create(ctx context.Context, ticket *VerificationTicket) (*VerificationTicket, error)
+	Consume(ctx context.Context, hash string) (string, error)
+}
+
+// RateLimits is implemented by *RateLimitsRepo
+type RateLimits interface {
+	Update(ctx context.Context, key string, fn func(limit *RateLimit) error) error
+}
+
+// Store hands out the repos of a database. The repos of the store passed
+// to the fn of WithTx all work within the same transaction.
+type Store interface {
+	MobileUsers() MobileUsers
+	UserProfiles() UserProfiles
+	UserContacts() UserContacts
+	Alerts() Alerts
+	DeviceTokens() DeviceTokens
+	RefreshTokens() RefreshTokens
+	UserAccounts() UserAccounts
+	NotificationAttempts() NotificationAttempts
+	VerificationCodes() VerificationCodes
+	VerificationTickets() VerificationTickets
+	RateLimits() RateLimits
+
+	// WithTx runs fn in a transaction that is committed if fn returns nil
+	// and rolled back otherwise. The transaction is retried from the start
+	// when MySQL aborts it to break a deadlock, so fn may run more than
+	// once and must not have side effects outside of tx. Calling WithTx
+	// on the store of a transaction runs fn within that transaction.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// txAttempts is the number of times a transaction aborted by
+// a deadlock is run before giving up
+const txAttempts = 3
+
+// txRetryBackoff is the time waited before running a transaction aborted by
+// a deadlock again. It grows with every attempt.
+const txRetryBackoff = 20 * time.Millisecond
+
+// errDuplicateEntry is the number of the error MySQL fails
+// statements that violate a unique key with
+const errDuplicateEntry = 1062
+
+// errDeadlock is the number of the error MySQL aborts transactions with
+// to break deadlocks
+const errDeadlock = 1213
+
+// queryer is implemented by both *sqlx.DB and *sqlx.Tx, so that repos
+// work the same within a transaction and without
+type queryer interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// SQLStore is a Store of a MySQL database
+type SQLStore struct {
+	db *sqlx.DB
+	q  queryer
+}
+
+// NewStore returns a store of the repos of db
+func NewStore(db *sqlx.DB) *SQLStore {
+	return &SQLStore{
+		db: db,
+		q:  db,
+	}
+}
+
+// MobileUsers returns the mobile users repo of the store
+func (s *SQLStore) MobileUsers() MobileUsers {
+	return &MobileUsersRepo{db: s.q}
+}
+
+// UserProfiles returns the user profiles repo of the store
+func (s *SQLStore) UserProfiles() UserProfiles {
+	return &UserProfilesRepo{db: s.q}
+}
+
+// UserContacts returns the user contacts repo of the store
+func (s *SQLStore) UserContacts() UserContacts {
+	return &UserContactsRepo{db: s.q}
+}
+
+// Alerts returns the alerts repo of the store
+func (s *SQLStore) Alerts() Alerts {
+	return &AlertsRepo{db: s.q}
+}
+
+// DeviceTokens returns the device tokens repo of the store
+func (s *SQLStore) DeviceTokens() DeviceTokens {
+	return &DeviceTokensRepo{db: s.q}
+}
+
+// RefreshTokens returns the refresh tokens repo of the store
+func (s *SQLStore) RefreshTokens() RefreshTokens {
+	return &RefreshTokensRepo{db: s.q}
+}
+
+// UserAccounts returns the user accounts repo of the store
+func (s *SQLStore) UserAccounts() UserAccounts {
+	return &UserAccountsRepo{db: s.q}
+}
+
+// NotificationAttempts returns the notification attempts repo of the store
+func (s *SQLStore) NotificationAttempts() NotificationAttempts {
+	return &NotificationAttemptsRepo{db: s.q}
+}
+
+// VerificationCodes returns the verification codes repo of the store
+func (s *SQLStore) VerificationCodes() VerificationCodes {
+	return &VerificationCodesRepo{db: s.q}
+}
+
+// VerificationTickets returns the verification tickets repo of the store
+func (s *SQLStore) VerificationTickets() VerificationTickets {
+	return &VerificationTicketsRepo{db: s.q}
+}
+
+// RateLimits returns the rate limits repo of the store
+func (s *SQLStore) RateLimits() RateLimits {
+	return &RateLimitsRepo{db: s.q}
+}
+
+// WithTx runs fn in a transaction, as described by Store. The whole
+// transaction, retries included, is bound by QueryTimeout.
+func (s *SQLStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if _, ok := s.q.(*sqlx.Tx); ok {
+		return fn(s)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, fn)
+		if err == nil || !isDeadlock(err) || attempt == txAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryBackoff):
+		}
+	}
+}
+
+func (s *SQLStore) runTx(ctx context.Context, fn func(tx Store) error) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&SQLStore{db: s.db, q: tx})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// inTx runs fn in the transaction q is part of or, when q is not part of
+// one, in a transaction of its own, which is retried like those of WithTx.
+// fn must thus leave nothing behind that a second run would not replace.
+func inTx(ctx context.Context, q queryer, fn func(tx queryer) error) error {
+	db, ok := q.(*sqlx.DB)
+	if !ok {
+		return fn(q)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runInTx(ctx, db, fn)
+		if err == nil || !isDeadlock(err) || attempt == txAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryBackoff):
+		}
+	}
+}
+
+func runInTx(ctx context.Context, db *sqlx.DB, fn func(tx queryer) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isDuplicateEntry reports whether err tells that
+// a statement violated a unique key
+func isDuplicateEntry(err error) bool {
+	merr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && merr.Number == errDuplicateEntry
+}
+
+// isDeadlock reports whether err tells that MySQL
+// aborted a transaction to break a deadlock
+func isDeadlock(err error) bool {
+	merr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && merr.Number == errDeadlock
+}
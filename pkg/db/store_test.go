@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestStore_WithTx_ShouldCommitWhenFnSucceeds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE mobile_users SET suspended_at = NULL WHERE id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	store := NewStore(sqlx.NewDb(db, "sqlmock"))
+	err = store.WithTx(context.Background(), func(tx Store) error {
+		return tx.MobileUsers().Unsuspend(context.Background(), 1)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStore_WithTx_ShouldRollBackWhenFnFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	failure := errors.New("failure")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	store := NewStore(sqlx.NewDb(db, "sqlmock"))
+	err = store.WithTx(context.Background(), func(tx Store) error {
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStore_WithTx_ShouldRetryDeadlocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE mobile_users SET suspended_at = NULL WHERE id = \?$`).
+		WithArgs(1).
+		WillReturnError(&mysql.MySQLError{Number: errDeadlock, Message: "Deadlock found"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE mobile_users SET suspended_at = NULL WHERE id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	runs := 0
+	store := NewStore(sqlx.NewDb(db, "sqlmock"))
+	err = store.WithTx(context.Background(), func(tx Store) error {
+		runs++
+		return tx.MobileUsers().Unsuspend(context.Background(), 1)
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if runs != 2 {
+		t.Fatalf("expected fn to run 2 times, got %d", runs)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInTx_ShouldRetryDeadlocks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < txAttempts; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(`^UPDATE mobile_users SET suspended_at = NULL WHERE id = \?$`).
+			WithArgs(1).
+			WillReturnError(&mysql.MySQLError{Number: errDeadlock, Message: "Deadlock found"})
+		mock.ExpectRollback()
+	}
+
+	runs := 0
+	err = inTx(context.Background(), sqlx.NewDb(db, "sqlmock"), func(tx queryer) error {
+		runs++
+		_, err := tx.ExecContext(context.Background(), "UPDATE mobile_users SET suspended_at = NULL WHERE id = ?", 1)
+		return err
+	})
+	if !isDeadlock(err) {
+		t.Fatalf("expected deadlock error, got %v", err)
+	}
+
+	if runs != txAttempts {
+		t.Fatalf("expected fn to run %d times, got %d", txAttempts, runs)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStore_WithTx_ShouldJoinOuterTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE mobile_users SET suspended_at = NULL WHERE id = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	store := NewStore(sqlx.NewDb(db, "sqlmock"))
+	err = store.WithTx(context.Background(), func(tx Store) error {
+		return tx.WithTx(context.Background(), func(tx Store) error {
+			return tx.MobileUsers().Unsuspend(context.Background(), 1)
+		})
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// QueryTimeout bounds how long a repo method may spend querying the
+// database, on top of any deadline of the context it is given. Zero
+// leaves repo methods bound by their context alone. It is meant to be
+// set once at startup.
+var QueryTimeout = 10 * time.Second
+
+// withTimeout returns a copy of ctx that is done once QueryTimeout elapses
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, QueryTimeout)
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestQueryTimeout_ShouldCancelSlowQueries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	defer func(timeout time.Duration) { QueryTimeout = timeout }(QueryTimeout)
+	QueryTimeout = 10 * time.Millisecond
+
+	mock.ExpectQuery(`^SELECT u.\* FROM mobile_users AS u WHERE u.id = \?$`).
+		WithArgs(1).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	repo := NewMobileUsersRepo(sqlx.NewDb(db, "sqlmock"))
+	_, err = repo.GetByID(context.Background(), 1)
+	if err == nil {
+		t.Fatal("expected the query to time out")
+	}
+}
+
+func TestQueryTimeout_ShouldHonorCanceledContexts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE mobile_users SET suspended_at = NULL WHERE id = \?$`).
+		WithArgs(1).
+		WillDelayFor(time.Second).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	repo := NewMobileUsersRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.Unsuspend(ctx, 1)
+	if err == nil {
+		t.Fatal("expected the query to be canceled")
+	}
+}
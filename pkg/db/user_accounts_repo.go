@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UserAccount is an account of operations staff signing in to the admin API
+// with a username and password. Only accounts that are admins can sign in,
+// with the permissions of their role. Password holds the hash of the
+// password, never the password itself.
+type UserAccount struct {
+	ID           int          `db:"id" json:"id"`
+	Username     string       `db:"username" json:"username"`
+	Password     string       `db:"password" json:"-"`
+	IsAdmin      bool         `db:"is_admin" json:"isAdmin"`
+	Role         string       `db:"role" json:"role"`
+	FailedLogins int          `db:"failed_logins" json:"-"`
+	LockedUntil  NullableTime `db:"locked_until" json:"lockedUntil"`
+	CreatedAt    time.Time    `db:"created_at" json:"createdAt"`
+	LastLoginAt  NullableTime `db:"last_login_at" json:"lastLoginAt"`
+	UpdatedAt    NullableTime `db:"updated_at" json:"updatedAt"`
+}
+
+// IsLocked reports whether the account is locked out at now
+// after too many failed sign-in attempts
+func (account *UserAccount) IsLocked(now time.Time) bool {
+	return account.LockedUntil.Valid && account.LockedUntil.Time.After(now)
+}
+
+// UserAccountsRepo defines methods for interacting with
+// user account records in the database
+type UserAccountsRepo struct {
+	db queryer
+}
+
+// NewUserAccountsRepo returns a new user accounts repo
+func NewUserAccountsRepo(db *sqlx.DB) *UserAccountsRepo {
+	return &UserAccountsRepo{
+		db: db,
+	}
+}
+
+// Create saves a new user account into the database, updates the value
+// with the ID auto-generated by the database, and returns the account
+// or error if the operation fails
+func (repo *UserAccountsRepo) Create(ctx context.Context, account *UserAccount) (*UserAccount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO user_accounts (username, password, is_admin, role) VALUES(?, ?, ?, ?)"
+	res, err := repo.db.ExecContext(ctx, query, account.Username, account.Password, account.IsAdmin, account.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	account.ID = int(id)
+	return account, nil
+}
+
+// Update saves the password, admin flag and role of account. Updating an
+// account lifts its lockout, so that it can be used to reset the password
+// of a locked out account.
+func (repo *UserAccountsRepo) Update(ctx context.Context, account *UserAccount) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE user_accounts
+		SET password = ?, is_admin = ?, role = ?, failed_logins = 0, locked_until = NULL, updated_at = NOW()
+		WHERE id = ?`
+	_, err := repo.db.ExecContext(ctx, query, account.Password, account.IsAdmin, account.Role, account.ID)
+	return err
+}
+
+// GetByID returns the user account with the specified ID,
+// or nil if there is no such account
+func (repo *UserAccountsRepo) GetByID(ctx context.Context, id int) (*UserAccount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return repo.get(ctx, "SELECT a.* FROM user_accounts AS a WHERE a.id = ?", id)
+}
+
+// GetByUsername returns the user account with the specified
+// username, or nil if there is no such account
+func (repo *UserAccountsRepo) GetByUsername(ctx context.Context, username string) (*UserAccount, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return repo.get(ctx, "SELECT a.* FROM user_accounts AS a WHERE a.username = ?", username)
+}
+
+func (repo *UserAccountsRepo) get(ctx context.Context, query string, args ...interface{}) (*UserAccount, error) {
+	account := UserAccount{}
+
+	err := repo.db.QueryRowxContext(ctx, query, args...).StructScan(&account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// RecordLogin records a successful sign-in to the account with the
+// specified ID, clearing its failed sign-in attempts
+func (repo *UserAccountsRepo) RecordLogin(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE user_accounts SET last_login_at = NOW(), failed_logins = 0, locked_until = NULL WHERE id = ?"
+	_, err := repo.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// RecordFailedLogin records a failed sign-in to the account with the
+// specified ID. The account is locked until lockUntil once it has failed
+// maxFailures times in a row, and its count of failures starts over.
+func (repo *UserAccountsRepo) RecordFailedLogin(ctx context.Context, id, maxFailures int, lockUntil time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// assignments are evaluated left to right, so locked_until
+	// must be set before failed_logins is changed
+	query := `UPDATE user_accounts
+		SET locked_until = IF(failed_logins + 1 >= ?, ?, locked_until),
+			failed_logins = IF(failed_logins + 1 >= ?, 0, failed_logins + 1)
+		WHERE id = ?`
+	_, err := repo.db.ExecContext(ctx, query, maxFailures, lockUntil, maxFailures, id)
+	return err
+}
+
+// SetPassword replaces the password hash of the account with the
+// specified ID, e.g. when it is rehashed with a higher cost
+func (repo *UserAccountsRepo) SetPassword(ctx context.Context, id int, hash string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE user_accounts SET password = ?, updated_at = NOW() WHERE id = ?"
+	_, err := repo.db.ExecContext(ctx, query, hash, id)
+	return err
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestUserAccountsRepo_GetByUsername_ShouldPass(t *testing.T) {
+	sql := `^SELECT a.\* FROM user_accounts AS a WHERE a.username = \?$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	lockedUntil := time.Now().Add(time.Minute)
+	rows := sqlmock.NewRows([]string{"id", "username", "password", "is_admin", "role", "failed_logins", "locked_until", "created_at", "last_login_at", "updated_at"}).
+		AddRow(3, "ama", "pbkdf2-sha256$310000$c2FsdA$a2V5", true, "dispatcher", 2, lockedUntil, time.Now(), nil, nil)
+
+	mock.ExpectQuery(sql).
+		WithArgs("ama").
+		WillReturnRows(rows)
+
+	repo := NewUserAccountsRepo(sqlx.NewDb(db, "sqlmock"))
+	account, err := repo.GetByUsername(context.Background(), "ama")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if account == nil || account.ID != 3 || account.Role != "dispatcher" || !account.IsAdmin {
+		t.Fatalf("unexpected account %+v", account)
+	}
+
+	if !account.IsLocked(time.Now()) || account.IsLocked(lockedUntil) {
+		t.Fatalf("expected account to be locked until %v", lockedUntil)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserAccountsRepo_GetByUsername_ShouldReturnNilForUnknownAccount(t *testing.T) {
+	sql := `^SELECT a.\* FROM user_accounts AS a WHERE a.username = \?$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(sql).
+		WithArgs("kofi").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	repo := NewUserAccountsRepo(sqlx.NewDb(db, "sqlmock"))
+	account, err := repo.GetByUsername(context.Background(), "kofi")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if account != nil {
+		t.Fatalf("expected no account, got %+v", account)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserAccountsRepo_RecordFailedLogin_ShouldPass(t *testing.T) {
+	sql := `^UPDATE user_accounts\s+SET locked_until = IF\(failed_logins \+ 1 >= \?, \?, locked_until\),\s+failed_logins = IF\(failed_logins \+ 1 >= \?, 0, failed_logins \+ 1\)\s+WHERE id = \?$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	lockUntil := time.Now().Add(15 * time.Minute)
+	mock.ExpectExec(sql).
+		WithArgs(5, lockUntil, 5, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewUserAccountsRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.RecordFailedLogin(context.Background(), 3, 5, lockUntil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserAccountsRepo_RecordLogin_ShouldPass(t *testing.T) {
+	sql := `^UPDATE user_accounts SET last_login_at = NOW\(\), failed_logins = 0, locked_until = NULL WHERE id = \?$`
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(sql).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewUserAccountsRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.RecordLogin(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,25 +1,110 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/hoodcops/xcore/pkg/phone"
 	"github.com/jmoiron/sqlx"
 )
 
 // UserContact models phone contacts that are uploaded by
-// users to be contacted in case of emergency
+// users to be contacted in case of emergency. Contacts with a lower
+// priority are notified first; contacts with a priority of zero have
+// none and are notified last.
 type UserContact struct {
-	ID        int       `db:"id" json:"id"`
-	UserID    int       `db:"user_id" json:"userId"`
-	Msisdn    string    `db:"msisdn" json:"msisdn"`
-	Fullname  string    `db:"fullname" json:"fullname"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	ID           int          `db:"id" json:"id"`
+	UserID       int          `db:"user_id" json:"userId"`
+	Msisdn       string       `db:"msisdn" json:"msisdn"`
+	Fullname     string       `db:"fullname" json:"fullname"`
+	Priority     int          `db:"priority" json:"priority"`
+	Relationship string       `db:"relationship" json:"relationship"`
+	Status       string       `db:"status" json:"status"`
+	InvitedAt    NullableTime `db:"invited_at" json:"invitedAt"`
+	RespondedAt  NullableTime `db:"responded_at" json:"respondedAt"`
+	CreatedAt    time.Time    `db:"created_at" json:"createdAt"`
+	UpdatedAt    NullableTime `db:"updated_at" json:"updatedAt"`
+}
+
+// Statuses of the invitations sent to contacts. Contacts are pending until
+// they accept or decline to be the emergency contact of the user who added
+// them, and may change their mind later.
+const (
+	ContactStatusPending  = "pending"
+	ContactStatusAccepted = "accepted"
+	ContactStatusDeclined = "declined"
+)
+
+// Relationships a contact can have to the user who added them
+const (
+	ContactRelationshipParent    = "parent"
+	ContactRelationshipSpouse    = "spouse"
+	ContactRelationshipChild     = "child"
+	ContactRelationshipSibling   = "sibling"
+	ContactRelationshipRelative  = "relative"
+	ContactRelationshipFriend    = "friend"
+	ContactRelationshipNeighbour = "neighbour"
+	ContactRelationshipColleague = "colleague"
+	ContactRelationshipOther     = "other"
+)
+
+// contactRelationships holds the relationships contacts can have
+var contactRelationships = []string{
+	ContactRelationshipParent,
+	ContactRelationshipSpouse,
+	ContactRelationshipChild,
+	ContactRelationshipSibling,
+	ContactRelationshipRelative,
+	ContactRelationshipFriend,
+	ContactRelationshipNeighbour,
+	ContactRelationshipColleague,
+	ContactRelationshipOther,
+}
+
+// IsContactRelationship reports whether relationship is
+// a relationship contacts can have
+func IsContactRelationship(relationship string) bool {
+	for _, r := range contactRelationships {
+		if r == relationship {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Modes of syncing the contacts of a user
+const (
+	SyncMerge   = "merge"
+	SyncReplace = "replace"
+)
+
+// contactsBatchSize is the number of contacts saved per statement
+const contactsBatchSize = 1000
+
+// ErrDuplicateContact is returned when a user already
+// has a contact with the msisdn a contact is saved with
+var ErrDuplicateContact = errors.New("contact already exists")
+
+// ErrContactLimit is returned when saving contacts would leave a
+// user with more contacts than they are allowed to have
+var ErrContactLimit = errors.New("contact limit exceeded")
+
+// ContactsSync tells how a sync changed the contacts of a user
+type ContactsSync struct {
+	Added   []*UserContact `json:"added"`
+	Updated []*UserContact `json:"updated"`
+	Removed []*UserContact `json:"removed"`
 }
 
 // UserContactsRepo provides methods for interacting with user
 // contacts in the database
 type UserContactsRepo struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewUserContactsRepo returns an instance of UserContactsRepo
@@ -29,28 +114,140 @@ func NewUserContactsRepo(db *sqlx.DB) *UserContactsRepo {
 	}
 }
 
-// CreateContacts inserts contacts into the database
-func (repo *UserContactsRepo) CreateContacts(contacts []*UserContact) ([]*UserContact, error) {
-	savedContacts := make([]*UserContact, 0)
+// SyncContacts saves the contacts uploaded by a user in a single
+// transaction. Contacts are told apart by msisdn, which must be in E.164
+// format; when a msisdn is uploaded more than once, its last fullname is
+// kept. Merging adds new contacts and renames existing ones, replacing
+// also removes the contacts that were not uploaded. Contacts added again
+// after declining to be one of the user's contacts are saved as declined.
+// It fails with ErrContactLimit when the user would be left with more than
+// limit contacts, unless limit is zero.
+func (repo *UserContactsRepo) SyncContacts(ctx context.Context, userID int, contacts []*UserContact, mode string, limit int) (*ContactsSync, error) {
+	if mode != SyncMerge && mode != SyncReplace {
+		return nil, fmt.Errorf("unknown contacts sync mode %q", mode)
+	}
 
+	uploaded := make(map[string]*UserContact)
+	var unique []*UserContact
 	for _, contact := range contacts {
-		savedContact, err := repo.insert(contact)
+		if !phone.IsE164(contact.Msisdn) {
+			return nil, phone.ErrInvalidNumber
+		}
+
+		if seen, ok := uploaded[contact.Msisdn]; ok {
+			seen.Fullname = contact.Fullname
+			continue
+		}
+
+		contact.UserID = userID
+		uploaded[contact.Msisdn] = contact
+		unique = append(unique, contact)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var sync *ContactsSync
+	err := inTx(ctx, repo.db, func(tx queryer) error {
+		sync = &ContactsSync{
+			Added:   make([]*UserContact, 0),
+			Updated: make([]*UserContact, 0),
+			Removed: make([]*UserContact, 0),
+		}
+
+		// locking the user makes syncs of their contacts run one after the
+		// other, so that concurrent uploads cannot get past the limit
+		var id int
+		err := tx.GetContext(ctx, &id, "SELECT id FROM mobile_users WHERE id = ? FOR UPDATE", userID)
+		if err != nil {
+			return err
+		}
+
+		existing, err := repo.getUserContacts(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		current := make(map[string]*UserContact, len(existing))
+		for _, contact := range existing {
+			current[contact.Msisdn] = contact
+		}
+
+		for _, contact := range unique {
+			saved, ok := current[contact.Msisdn]
+			switch {
+			case !ok:
+				sync.Added = append(sync.Added, contact)
+			case saved.Fullname != contact.Fullname:
+				sync.Updated = append(sync.Updated, contact)
+			}
+		}
+
+		count := len(existing) + len(sync.Added)
+		if mode == SyncReplace {
+			for _, contact := range existing {
+				if _, ok := uploaded[contact.Msisdn]; !ok {
+					sync.Removed = append(sync.Removed, contact)
+				}
+			}
+
+			count = len(unique)
+		}
+
+		if limit > 0 && count > limit {
+			return ErrContactLimit
+		}
+
+		err = repo.delete(ctx, tx, userID, sync.Removed)
+		if err != nil {
+			return err
+		}
+
+		changed := append(append([]*UserContact{}, sync.Added...), sync.Updated...)
+		if len(changed) == 0 {
+			return nil
+		}
+
+		err = repo.upsert(ctx, tx, changed)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		savedContacts = append(savedContacts, savedContact)
+		err = repo.applyDeclines(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// the ids of added contacts are only known once they are read back
+		saved, err := repo.getUserContacts(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		for _, contact := range saved {
+			if uploadedContact, ok := uploaded[contact.Msisdn]; ok {
+				*uploadedContact = *contact
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return savedContacts, nil
+	return sync, nil
 }
 
 // GetAll returns all mobile user contacts in the database
-func (repo *UserContactsRepo) GetAll() ([]*UserContact, error) {
+func (repo *UserContactsRepo) GetAll(ctx context.Context) ([]*UserContact, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	query := "SELECT * FROM mobile_user_contacts"
 	var contacts []*UserContact
 
-	err := repo.db.Select(&contacts, query)
+	err := repo.db.SelectContext(ctx, &contacts, query)
 	if err != nil {
 		return nil, err
 	}
@@ -58,31 +255,245 @@ func (repo *UserContactsRepo) GetAll() ([]*UserContact, error) {
 	return contacts, nil
 }
 
-func (repo *UserContactsRepo) insert(contact *UserContact) (*UserContact, error) {
-	sql := "INSERT INTO mobile_user_contacts (user_id, msisdn, fullname) VALUES (?, ?, ?)"
-	res, err := repo.db.Exec(sql, contact.UserID, contact.Msisdn, contact.Fullname)
+// upsert saves contacts with as few multi-row statements as the
+// placeholder limit of MySQL allows
+func (repo *UserContactsRepo) upsert(ctx context.Context, tx queryer, contacts []*UserContact) error {
+	for start := 0; start < len(contacts); start += contactsBatchSize {
+		end := start + contactsBatchSize
+		if end > len(contacts) {
+			end = len(contacts)
+		}
+
+		batch := contacts[start:end]
+		args := make([]interface{}, 0, len(batch)*3)
+		for _, contact := range batch {
+			args = append(args, contact.UserID, contact.Msisdn, contact.Fullname)
+		}
+
+		query := "INSERT INTO mobile_user_contacts (user_id, msisdn, fullname) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", len(batch)), ", ") +
+			" ON DUPLICATE KEY UPDATE fullname = VALUES(fullname), updated_at = NOW()"
+
+		_, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyDeclines marks the pending contacts of a user who declined to be
+// one of the user's contacts before as declined, so that removing and
+// adding a contact again does not invite them again
+func (repo *UserContactsRepo) applyDeclines(ctx context.Context, tx queryer, userID int) error {
+	query := "UPDATE mobile_user_contacts AS c " +
+		"JOIN mobile_user_contact_declines AS d ON d.user_id = c.user_id AND d.msisdn = c.msisdn " +
+		"SET c.status = ?, c.responded_at = d.declined_at WHERE c.user_id = ? AND c.status = ?"
+	_, err := tx.ExecContext(ctx, query, ContactStatusDeclined, userID, ContactStatusPending)
+	return err
+}
+
+func (repo *UserContactsRepo) delete(ctx context.Context, tx queryer, userID int, contacts []*UserContact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(contacts))
+	for i, contact := range contacts {
+		ids[i] = contact.ID
+	}
+
+	query, args, err := sqlx.In("DELETE FROM mobile_user_contacts WHERE user_id = ? AND id IN (?)", userID, ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, tx.Rebind(query), args...)
+	return err
+}
+
+func (repo *UserContactsRepo) getUserContacts(ctx context.Context, q queryer, userID int) ([]*UserContact, error) {
+	query := "SELECT * FROM mobile_user_contacts WHERE user_id = ? ORDER BY priority = 0, priority, id"
+	var contacts []*UserContact
+
+	err := q.SelectContext(ctx, &contacts, query, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := res.LastInsertId()
+	return contacts, nil
+}
+
+// GetUserContacts returns a mobile user's uploaded phone
+// contacts, in the order they are to be notified
+func (repo *UserContactsRepo) GetUserContacts(ctx context.Context, userID int) ([]*UserContact, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return repo.getUserContacts(ctx, repo.db, userID)
+}
+
+// GetUserContact returns the contact of a user with the specified id. It
+// returns nil when the user has no such contact, including when the
+// contact belongs to another user.
+func (repo *UserContactsRepo) GetUserContact(ctx context.Context, userID, id int) (*UserContact, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	contact := UserContact{}
+
+	query := "SELECT c.* FROM mobile_user_contacts AS c WHERE c.id = ? AND c.user_id = ?"
+	err := repo.db.QueryRowxContext(ctx, query, id, userID).StructScan(&contact)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
 
-	contact.ID = int(id)
-	return contact, nil
+	return &contact, nil
 }
 
-// GetUserContacts returns a mobile user's uploaded phone contacts
-func (repo *UserContactsRepo) GetUserContacts(userID int) ([]*UserContact, error) {
-	query := "SELECT * FROM mobile_user_contacts WHERE user_id = ?"
-	var contacts []*UserContact
+// UpdateContact saves the msisdn, fullname, priority and relationship of
+// contact, which must belong to contact.UserID, and reports whether there
+// was such a contact. It fails with ErrDuplicateContact when the user has
+// another contact with the same msisdn, which must be in E.164 format.
+// Changing the msisdn of a contact makes their invitation pending again,
+// unless whoever owns the new number declined to be a contact before.
+func (repo *UserContactsRepo) UpdateContact(ctx context.Context, contact *UserContact) (bool, error) {
+	if !phone.IsE164(contact.Msisdn) {
+		return false, phone.ErrInvalidNumber
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	var found bool
+	err := inTx(ctx, repo.db, func(tx queryer) error {
+		// the row is locked first because MySQL counts only
+		// changed rows as affected by an update
+		var msisdn string
+		err := tx.GetContext(ctx, &msisdn, "SELECT msisdn FROM mobile_user_contacts WHERE id = ? AND user_id = ? FOR UPDATE", contact.ID, contact.UserID)
+		found = err != sql.ErrNoRows
+		if !found {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// whoever owns the new number has yet to agree to be a contact
+		if msisdn != contact.Msisdn {
+			query := "UPDATE mobile_user_contacts SET status = ?, invited_at = NULL, responded_at = NULL WHERE id = ?"
+			_, err = tx.ExecContext(ctx, query, ContactStatusPending, contact.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		query := "UPDATE mobile_user_contacts SET msisdn = ?, fullname = ?, priority = ?, relationship = ?, updated_at = NOW() WHERE id = ?"
+		_, err = tx.ExecContext(ctx, query, contact.Msisdn, contact.Fullname, contact.Priority, contact.Relationship, contact.ID)
+		if isDuplicateEntry(err) {
+			return ErrDuplicateContact
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if msisdn != contact.Msisdn {
+			err = repo.applyDeclines(ctx, tx, contact.UserID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRowxContext(ctx, "SELECT c.* FROM mobile_user_contacts AS c WHERE c.id = ?", contact.ID).StructScan(contact)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
 
-	err := repo.db.Select(&contacts, query, userID)
+// DeleteContact deletes the contact of a user with the specified id
+// and reports whether the user had such a contact
+func (repo *UserContactsRepo) DeleteContact(ctx context.Context, userID, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	res, err := repo.db.ExecContext(ctx, "DELETE FROM mobile_user_contacts WHERE id = ? AND user_id = ?", id, userID)
 	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// GetByID returns the contact with the specified id,
+// whichever user it belongs to, or nil if there is none
+func (repo *UserContactsRepo) GetByID(ctx context.Context, id int) (*UserContact, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	contact := UserContact{}
+
+	query := "SELECT c.* FROM mobile_user_contacts AS c WHERE c.id = ?"
+	err := repo.db.QueryRowxContext(ctx, query, id).StructScan(&contact)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
 
-	return contacts, nil
+	return &contact, nil
+}
+
+// MarkInvited records that the contact with the specified id was sent
+// an invitation at the given time
+func (repo *UserContactsRepo) MarkInvited(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	_, err := repo.db.ExecContext(ctx, "UPDATE mobile_user_contacts SET invited_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// Respond records the response of the contact with the specified id to
+// their invitation, accepted or declined. Declines are also kept apart
+// from the contact, so that they outlast it being removed.
+func (repo *UserContactsRepo) Respond(ctx context.Context, id int, status string) error {
+	if status != ContactStatusAccepted && status != ContactStatusDeclined {
+		return fmt.Errorf("invalid contact response %q", status)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return inTx(ctx, repo.db, func(tx queryer) error {
+		_, err := tx.ExecContext(ctx, "UPDATE mobile_user_contacts SET status = ?, responded_at = NOW() WHERE id = ?", status, id)
+		if err != nil {
+			return err
+		}
+
+		query := "DELETE d FROM mobile_user_contact_declines AS d " +
+			"JOIN mobile_user_contacts AS c ON c.user_id = d.user_id AND c.msisdn = d.msisdn WHERE c.id = ?"
+		if status == ContactStatusDeclined {
+			query = "INSERT INTO mobile_user_contact_declines (user_id, msisdn) " +
+				"SELECT user_id, msisdn FROM mobile_user_contacts WHERE id = ? " +
+				"ON DUPLICATE KEY UPDATE declined_at = NOW()"
+		}
+
+		_, err = tx.ExecContext(ctx, query, id)
+		return err
+	})
 }
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+var contactColumns = []string{"id", "user_id", "msisdn", "fullname", "created_at", "updated_at"}
+
+func expectContactsLock(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectQuery(`^SELECT id FROM mobile_users WHERE id = \? FOR UPDATE$`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+}
+
+func expectApplyDeclines(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectExec(`^UPDATE mobile_user_contacts AS c JOIN mobile_user_contact_declines AS d ON d.user_id = c.user_id AND d.msisdn = c.msisdn SET c.status = \?, c.responded_at = d.declined_at WHERE c.user_id = \? AND c.status = \?$`).
+		WithArgs(ContactStatusDeclined, userID, ContactStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestUserContactsRepo_SyncContacts_ShouldMergeContacts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	expectContactsLock(mock, 7)
+	mock.ExpectQuery(`^SELECT \* FROM mobile_user_contacts WHERE user_id = \? ORDER BY priority = 0, priority, id$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(contactColumns).
+			AddRow(1, 7, "+233241000001", "Ama", now, nil).
+			AddRow(2, 7, "+233241000002", "Kofi", now, nil))
+	mock.ExpectExec(`^INSERT INTO mobile_user_contacts \(user_id, msisdn, fullname\) VALUES \(\?, \?, \?\), \(\?, \?, \?\) ON DUPLICATE KEY UPDATE fullname = VALUES\(fullname\), updated_at = NOW\(\)$`).
+		WithArgs(7, "+233241000003", "Esi", 7, "+233241000002", "Kofi Mensah").
+		WillReturnResult(sqlmock.NewResult(3, 3))
+	expectApplyDeclines(mock, 7)
+	mock.ExpectQuery(`^SELECT \* FROM mobile_user_contacts WHERE user_id = \? ORDER BY priority = 0, priority, id$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(contactColumns).
+			AddRow(1, 7, "+233241000001", "Ama", now, nil).
+			AddRow(2, 7, "+233241000002", "Kofi Mensah", now, now).
+			AddRow(3, 7, "+233241000003", "Esi", now, nil))
+	mock.ExpectCommit()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	sync, err := repo.SyncContacts(context.Background(), 7, []*UserContact{
+		{Msisdn: "+233241000001", Fullname: "Ama"},
+		{Msisdn: "+233241000003", Fullname: "Esi"},
+		{Msisdn: "+233241000002", Fullname: "Kofi Mensah"},
+		{Msisdn: "+233241000003", Fullname: "Esi"},
+	}, SyncMerge, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(sync.Added) != 1 || sync.Added[0].ID != 3 {
+		t.Fatalf("expected contact 3 to be added, got %+v", sync.Added)
+	}
+
+	if len(sync.Updated) != 1 || sync.Updated[0].ID != 2 {
+		t.Fatalf("expected contact 2 to be updated, got %+v", sync.Updated)
+	}
+
+	if len(sync.Removed) != 0 {
+		t.Fatalf("expected no contacts to be removed, got %+v", sync.Removed)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_SyncContacts_ShouldReplaceContacts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectBegin()
+	expectContactsLock(mock, 7)
+	mock.ExpectQuery(`^SELECT \* FROM mobile_user_contacts WHERE user_id = \? ORDER BY priority = 0, priority, id$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(contactColumns).
+			AddRow(1, 7, "+233241000001", "Ama", now, nil).
+			AddRow(2, 7, "+233241000002", "Kofi", now, nil))
+	mock.ExpectExec(`^DELETE FROM mobile_user_contacts WHERE user_id = \? AND id IN \(\?\)$`).
+		WithArgs(7, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	sync, err := repo.SyncContacts(context.Background(), 7, []*UserContact{
+		{Msisdn: "+233241000001", Fullname: "Ama"},
+	}, SyncReplace, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(sync.Added) != 0 || len(sync.Updated) != 0 {
+		t.Fatalf("expected no contacts to be saved, got %+v and %+v", sync.Added, sync.Updated)
+	}
+
+	if len(sync.Removed) != 1 || sync.Removed[0].ID != 2 {
+		t.Fatalf("expected contact 2 to be removed, got %+v", sync.Removed)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_SyncContacts_ShouldEnforceLimit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectContactsLock(mock, 7)
+	mock.ExpectQuery(`^SELECT \* FROM mobile_user_contacts WHERE user_id = \? ORDER BY priority = 0, priority, id$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(contactColumns).
+			AddRow(1, 7, "+233241000001", "Ama", time.Now(), nil))
+	mock.ExpectRollback()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	_, err = repo.SyncContacts(context.Background(), 7, []*UserContact{
+		{Msisdn: "+233241000002", Fullname: "Kofi"},
+	}, SyncMerge, 1)
+	if err != ErrContactLimit {
+		t.Fatalf("expected ErrContactLimit, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_UpdateContact_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT msisdn FROM mobile_user_contacts WHERE id = \? AND user_id = \? FOR UPDATE$`).
+		WithArgs(3, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"msisdn"}).AddRow("+233241000004"))
+	mock.ExpectExec(`^UPDATE mobile_user_contacts SET status = \?, invited_at = NULL, responded_at = NULL WHERE id = \?$`).
+		WithArgs(ContactStatusPending, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE mobile_user_contacts SET msisdn = \?, fullname = \?, priority = \?, relationship = \?, updated_at = NOW\(\) WHERE id = \?$`).
+		WithArgs("+233241000003", "Esi", 1, ContactRelationshipParent, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectApplyDeclines(mock, 7)
+	mock.ExpectQuery(`^SELECT c.\* FROM mobile_user_contacts AS c WHERE c.id = \?$`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "msisdn", "fullname", "priority", "relationship", "status", "created_at", "updated_at"}).
+			AddRow(3, 7, "+233241000003", "Esi", 1, ContactRelationshipParent, ContactStatusPending, time.Now(), time.Now()))
+	mock.ExpectCommit()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	contact := &UserContact{ID: 3, UserID: 7, Msisdn: "+233241000003", Fullname: "Esi", Priority: 1, Relationship: ContactRelationshipParent}
+	ok, err := repo.UpdateContact(context.Background(), contact)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !ok {
+		t.Fatal("expected the contact to be updated")
+	}
+
+	if !contact.UpdatedAt.Valid || contact.Status != ContactStatusPending {
+		t.Fatal("expected the contact to be read back")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_UpdateContact_ShouldNotUpdateContactsOfOthers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT msisdn FROM mobile_user_contacts WHERE id = \? AND user_id = \? FOR UPDATE$`).
+		WithArgs(3, 8).
+		WillReturnRows(sqlmock.NewRows([]string{"msisdn"}))
+	mock.ExpectCommit()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	ok, err := repo.UpdateContact(context.Background(), &UserContact{ID: 3, UserID: 8, Msisdn: "+233241000003", Fullname: "Esi"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ok {
+		t.Fatal("expected the contact not to be found")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_UpdateContact_ShouldFailForDuplicateNumbers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT msisdn FROM mobile_user_contacts WHERE id = \? AND user_id = \? FOR UPDATE$`).
+		WithArgs(3, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"msisdn"}).AddRow("+233241000001"))
+	mock.ExpectExec(`^UPDATE mobile_user_contacts SET msisdn`).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	mock.ExpectRollback()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	_, err = repo.UpdateContact(context.Background(), &UserContact{ID: 3, UserID: 7, Msisdn: "+233241000001", Fullname: "Esi"})
+	if err != ErrDuplicateContact {
+		t.Fatalf("expected ErrDuplicateContact, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_DeleteContact_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^DELETE FROM mobile_user_contacts WHERE id = \? AND user_id = \?$`).
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	ok, err := repo.DeleteContact(context.Background(), 7, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !ok {
+		t.Fatal("expected the contact to be deleted")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_Respond_ShouldFailForInvalidResponses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.Respond(context.Background(), 3, ContactStatusPending)
+	if err == nil {
+		t.Fatal("expected contacts not to be able to make their invitation pending")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserContactsRepo_Respond_ShouldKeepDeclines(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE mobile_user_contacts SET status = \?, responded_at = NOW\(\) WHERE id = \?$`).
+		WithArgs(ContactStatusDeclined, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO mobile_user_contact_declines \(user_id, msisdn\) SELECT user_id, msisdn FROM mobile_user_contacts WHERE id = \? ON DUPLICATE KEY UPDATE declined_at = NOW\(\)$`).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := NewUserContactsRepo(sqlx.NewDb(db, "sqlmock"))
+	err = repo.Respond(context.Background(), 3, ContactStatusDeclined)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
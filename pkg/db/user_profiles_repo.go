@@ -1,31 +1,63 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// UserProfile models the profile information
-// of mobile users
+// profileColumns selects the columns of a user profile aliased p, with
+// its location split into latitude and longitude
+const profileColumns = "p.id, p.user_id, p.title, p.fullname, p.street, p.city, p.post_code, " +
+	"p.has_location, ST_Latitude(p.location) AS geo_lat, ST_Longitude(p.location) AS geo_lng, " +
+	"p.responder, p.created_at, p.updated_at"
+
+// UserProfile models the profile information of mobile users. The
+// coordinate is nil when the user has not given their location.
+// Responders are users who volunteer to help with alerts raised
+// near them. Only admins can make users responders, so the flag is
+// never read from or written to JSON payloads.
 type UserProfile struct {
-	ID        int          `db:"id" json:"id"`
-	UserID    int          `db:"user_id" json:"userId"`
-	Title     string       `db:"title" json:"title"`
-	Fullname  string       `db:"fullname" json:"fullname"`
-	Street    string       `db:"street" json:"street"`
-	City      string       `db:"city" json:"city"`
-	PostCode  string       `db:"post_code" json:"postCode"`
-	GeoLng    string       `db:"geo_lng" json:"geoLng"`
-	GeoLat    string       `db:"geo_lat" json:"geoLat"`
+	ID       int    `db:"id" json:"id"`
+	UserID   int    `db:"user_id" json:"userId"`
+	Title    string `db:"title" json:"title"`
+	Fullname string `db:"fullname" json:"fullname"`
+	Street   string `db:"street" json:"street"`
+	City     string `db:"city" json:"city"`
+	PostCode string `db:"post_code" json:"postCode"`
+	*Coordinate
+	Responder bool         `db:"responder" json:"-"`
 	CreatedAt time.Time    `db:"created_at" json:"createdAt"`
 	UpdatedAt NullableTime `db:"updated_at" json:"updatedAt"`
 }
 
+// NearbyUser is the profile of a user and their distance
+// in meters from a point
+type NearbyUser struct {
+	UserProfile
+	Distance float64 `db:"distance" json:"distance"`
+}
+
+// userProfileRow is a user profile as selected from the database,
+// where a location that is not known is stored as unknownLocation
+type userProfileRow struct {
+	UserProfile
+	HasLocation bool `db:"has_location"`
+}
+
+func (row *userProfileRow) profile() *UserProfile {
+	if !row.HasLocation {
+		row.Coordinate = nil
+	}
+	return &row.UserProfile
+}
+
 // UserProfilesRepo defines methods for interacting with user
 // profile records in the database
 type UserProfilesRepo struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewUserProfilesRepo returns a new user profiles repo
@@ -38,9 +70,19 @@ func NewUserProfilesRepo(db *sqlx.DB) *UserProfilesRepo {
 // Create saves a new user profile into the database, update the value
 // of ID with auto-generated value from database, and returns the user
 // profile or error if the operation fails
-func (repo *UserProfilesRepo) Create(profile *UserProfile) (*UserProfile, error) {
-	query := "INSERT INTO mobile_user_profiles (user_id, title, fullname, street, city, post_code, geo_lng, geo_lat) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"
-	res, err := repo.db.Exec(
+func (repo *UserProfilesRepo) Create(ctx context.Context, profile *UserProfile) (*UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	location := unknownLocation
+	if profile.Coordinate != nil {
+		location = profile.WKT()
+	}
+
+	query := "INSERT INTO mobile_user_profiles (user_id, title, fullname, street, city, post_code, location, has_location) " +
+		"VALUES(?, ?, ?, ?, ?, ?, " + geomFromText + ", ?)"
+	res, err := repo.db.ExecContext(
+		ctx,
 		query,
 		profile.UserID,
 		profile.Title,
@@ -48,8 +90,8 @@ func (repo *UserProfilesRepo) Create(profile *UserProfile) (*UserProfile, error)
 		profile.Street,
 		profile.City,
 		profile.PostCode,
-		profile.GeoLng,
-		profile.GeoLat,
+		location,
+		profile.Coordinate != nil,
 	)
 
 	if err != nil {
@@ -67,14 +109,92 @@ func (repo *UserProfilesRepo) Create(profile *UserProfile) (*UserProfile, error)
 
 // GetAll returns records of all user profiles in the database,
 // or an error if the operation fails
-func (repo *UserProfilesRepo) GetAll() ([]*UserProfile, error) {
-	query := "SELECT * FROM mobile_user_profiles"
-	var profiles []*UserProfile
+func (repo *UserProfilesRepo) GetAll(ctx context.Context) ([]*UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + profileColumns + " FROM mobile_user_profiles AS p"
+	var rows []*userProfileRow
 
-	err := repo.db.Select(&profiles, query)
+	err := repo.db.SelectContext(ctx, &rows, query)
 	if err != nil {
 		return nil, err
 	}
 
+	profiles := make([]*UserProfile, len(rows))
+	for i, row := range rows {
+		profiles[i] = row.profile()
+	}
+
 	return profiles, nil
 }
+
+// GetByUserID returns the profile of the mobile user with the specified
+// ID, or nil if the user has not created a profile
+func (repo *UserProfilesRepo) GetByUserID(ctx context.Context, userID int) (*UserProfile, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	row := userProfileRow{}
+
+	query := "SELECT " + profileColumns + " FROM mobile_user_profiles AS p WHERE p.user_id = ?"
+	err := repo.db.QueryRowxContext(ctx, query, userID).StructScan(&row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return row.profile(), nil
+}
+
+// SetResponder makes the user with the specified ID a responder, or
+// stops them being one when responder is false
+func (repo *UserProfilesRepo) SetResponder(ctx context.Context, userID int, responder bool) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE mobile_user_profiles SET responder = ?, updated_at = NOW() WHERE user_id = ?"
+	_, err := repo.db.ExecContext(ctx, query, responder, userID)
+	return err
+}
+
+// GetNear returns the users who have given a location within meters of
+// point, nearest first. When respondersOnly is set, only responders are
+// returned.
+func (repo *UserProfilesRepo) GetNear(ctx context.Context, point Coordinate, meters float64, respondersOnly bool) ([]*NearbyUser, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// the bounding box lets the spatial index narrow down the
+	// profiles before their exact distance is computed
+	query := "SELECT " + profileColumns + ", ST_Distance(p.location, " + geomFromText + ") AS distance " +
+		"FROM mobile_user_profiles AS p " +
+		"WHERE p.has_location = TRUE AND MBRContains(" + geomFromText + ", p.location)"
+	args := []interface{}{point.WKT(), Around(point, meters).WKT()}
+
+	if respondersOnly {
+		query += " AND p.responder = TRUE"
+	}
+
+	query += " HAVING distance <= ? ORDER BY distance"
+	args = append(args, meters)
+
+	var rows []*struct {
+		userProfileRow
+		Distance float64 `db:"distance"`
+	}
+
+	err := repo.db.SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*NearbyUser, len(rows))
+	for i, row := range rows {
+		users[i] = &NearbyUser{UserProfile: *row.profile(), Distance: row.Distance}
+	}
+
+	return users, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+var profileRowColumns = []string{"id", "user_id", "title", "fullname", "street", "city", "post_code", "has_location", "geo_lat", "geo_lng", "responder", "created_at", "updated_at"}
+
+func TestUserProfilesRepo_Create_ShouldStoreUnknownLocation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^INSERT INTO mobile_user_profiles \(user_id, title, fullname, street, city, post_code, location, has_location\) VALUES\(\?, \?, \?, \?, \?, \?, ST_GeomFromText\(\?, 4326, 'axis-order=long-lat'\), \?\)$`).
+		WithArgs(7, "Mr", "Kofi Mensah", "", "Accra", "", "POINT(0 0)", false).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	repo := NewUserProfilesRepo(sqlx.NewDb(db, "sqlmock"))
+	profile, err := repo.Create(context.Background(), &UserProfile{UserID: 7, Title: "Mr", Fullname: "Kofi Mensah", City: "Accra"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if profile.ID != 3 {
+		t.Fatalf("expected profile 3, got %+v", profile)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserProfilesRepo_GetByUserID_ShouldHideUnknownLocation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows(profileRowColumns).
+		AddRow(3, 7, "Mr", "Kofi Mensah", "", "Accra", "", false, 0.0, 0.0, false, time.Now(), nil)
+	mock.ExpectQuery(`FROM mobile_user_profiles AS p WHERE p.user_id = \?$`).
+		WithArgs(7).
+		WillReturnRows(rows)
+
+	repo := NewUserProfilesRepo(sqlx.NewDb(db, "sqlmock"))
+	profile, err := repo.GetByUserID(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if profile == nil || profile.Coordinate != nil {
+		t.Fatalf("expected profile without location, got %+v", profile)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUserProfilesRepo_GetNear_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	point := Coordinate{Lat: 5.6037, Lng: -0.187}
+	rows := sqlmock.NewRows(append(profileRowColumns, "distance")).
+		AddRow(4, 9, "", "Ama Owusu", "", "Accra", "", true, 5.6047, -0.187, true, time.Now(), nil, 111.3)
+	mock.ExpectQuery(`WHERE p.has_location = TRUE AND MBRContains\(ST_GeomFromText\(\?, 4326, 'axis-order=long-lat'\), p.location\) AND p.responder = TRUE HAVING distance <= \? ORDER BY distance$`).
+		WithArgs(point.WKT(), Around(point, 500).WKT(), 500.0).
+		WillReturnRows(rows)
+
+	repo := NewUserProfilesRepo(sqlx.NewDb(db, "sqlmock"))
+	users, err := repo.GetNear(context.Background(), point, 500, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(users) != 1 || users[0].UserID != 9 || users[0].Coordinate == nil || users[0].Distance != 111.3 {
+		t.Fatalf("expected user 9 at 111.3 meters, got %+v", users)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// VerificationCode is a one-time code sent to a phone number by the built-in
+// phone verifier. Only the hash of the code is stored.
+type VerificationCode struct {
+	ID         int          `db:"id" json:"id"`
+	Msisdn     string       `db:"msisdn" json:"msisdn"`
+	CodeHash   string       `db:"code_hash" json:"-"`
+	Attempts   int          `db:"attempts" json:"attempts"`
+	ExpiresAt  time.Time    `db:"expires_at" json:"expiresAt"`
+	VerifiedAt NullableTime `db:"verified_at" json:"verifiedAt"`
+	CanceledAt NullableTime `db:"canceled_at" json:"canceledAt"`
+	CreatedAt  time.Time    `db:"created_at" json:"createdAt"`
+}
+
+// VerificationCodesRepo defines methods for interacting with phone
+// verification code records in the database
+type VerificationCodesRepo struct {
+	db queryer
+}
+
+// NewVerificationCodesRepo returns a new verification codes repo
+func NewVerificationCodesRepo(db *sqlx.DB) *VerificationCodesRepo {
+	return &VerificationCodesRepo{
+		db: db,
+	}
+}
+
+// Create saves a new verification code into the database, updates the value
+// with the ID auto-generated by the database, and returns the code or error
+// if the operation fails
+func (repo *VerificationCodesRepo) Create(ctx context.Context, code *VerificationCode) (*VerificationCode, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO phone_verification_codes (msisdn, code_hash, expires_at) VALUES(?, ?, ?)"
+	res, err := repo.db.ExecContext(ctx, query, code.Msisdn, code.CodeHash, code.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	code.ID = int(id)
+	return code, nil
+}
+
+// GetLatest returns the verification code most recently sent to msisdn,
+// or nil if no code has ever been sent to it
+func (repo *VerificationCodesRepo) GetLatest(ctx context.Context, msisdn string) (*VerificationCode, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	code := VerificationCode{}
+
+	query := "SELECT c.* FROM phone_verification_codes AS c WHERE c.msisdn = ? ORDER BY c.id DESC LIMIT 1"
+	err := repo.db.QueryRowxContext(ctx, query, msisdn).StructScan(&code)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// UseAttempt records an attempt at entering the code with the specified
+// ID. It returns false without recording it when maxAttempts attempts
+// have already been made, or the code has been used or canceled. The
+// check and the update are a single statement, so that concurrent
+// attempts cannot get past the limit.
+func (repo *VerificationCodesRepo) UseAttempt(ctx context.Context, id, maxAttempts int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE phone_verification_codes SET attempts = attempts + 1 " +
+		"WHERE id = ? AND attempts < ? AND verified_at IS NULL AND canceled_at IS NULL"
+	res, err := repo.db.ExecContext(ctx, query, id, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// MarkVerified records that the code with the specified ID was entered
+// correctly. It returns false if the code had already been used or canceled.
+func (repo *VerificationCodesRepo) MarkVerified(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE phone_verification_codes SET verified_at = NOW() WHERE id = ? AND verified_at IS NULL AND canceled_at IS NULL"
+	res, err := repo.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// CancelPending cancels every code sent to msisdn that has not been used yet
+func (repo *VerificationCodesRepo) CancelPending(ctx context.Context, msisdn string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE phone_verification_codes SET canceled_at = NOW() WHERE msisdn = ? AND verified_at IS NULL AND canceled_at IS NULL"
+	_, err := repo.db.ExecContext(ctx, query, msisdn)
+	return err
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestVerificationCodesRepo_UseAttempt_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE phone_verification_codes SET attempts = attempts \+ 1 WHERE id = \? AND attempts < \? AND verified_at IS NULL AND canceled_at IS NULL$`).
+		WithArgs(4, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewVerificationCodesRepo(sqlx.NewDb(db, "sqlmock"))
+	ok, err := repo.UseAttempt(context.Background(), 4, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !ok {
+		t.Fatal("expected attempt to be recorded")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestVerificationCodesRepo_UseAttempt_ShouldFailWhenAttemptsAreUsedUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE phone_verification_codes SET attempts = attempts \+ 1`).
+		WithArgs(4, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewVerificationCodesRepo(sqlx.NewDb(db, "sqlmock"))
+	ok, err := repo.UseAttempt(context.Background(), 4, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ok {
+		t.Fatal("expected attempt not to be recorded")
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
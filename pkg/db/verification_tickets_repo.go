@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// VerificationTicket is issued once a phone number has been verified and is
+// exchanged, exactly once, for a session for the user owning that number.
+// Only the hash of the ticket is stored.
+type VerificationTicket struct {
+	ID         int          `db:"id" json:"id"`
+	Msisdn     string       `db:"msisdn" json:"msisdn"`
+	TicketHash string       `db:"ticket_hash" json:"-"`
+	ExpiresAt  time.Time    `db:"expires_at" json:"expiresAt"`
+	UsedAt     NullableTime `db:"used_at" json:"usedAt"`
+	CreatedAt  time.Time    `db:"created_at" json:"createdAt"`
+}
+
+// VerificationTicketsRepo defines methods for interacting with phone
+// verification ticket records in the database
+type VerificationTicketsRepo struct {
+	db queryer
+}
+
+// NewVerificationTicketsRepo returns a new verification tickets repo
+func NewVerificationTicketsRepo(db *sqlx.DB) *VerificationTicketsRepo {
+	return &VerificationTicketsRepo{
+		db: db,
+	}
+}
+
+// Create saves a new verification ticket into the database, updates the value
+// with the ID auto-generated by the database, and returns the ticket or error
+// if the operation fails
+func (repo *VerificationTicketsRepo) Create(ctx context.Context, ticket *VerificationTicket) (*VerificationTicket, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO phone_verification_tickets (msisdn, ticket_hash, expires_at) VALUES(?, ?, ?)"
+	res, err := repo.db.ExecContext(ctx, query, ticket.Msisdn, ticket.TicketHash, ticket.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	ticket.ID = int(id)
+	return ticket, nil
+}
+
+// Consume marks the unexpired, unused ticket with the specified hash as used
+// and returns the msisdn it was issued for. An empty msisdn is returned if
+// there is no such ticket, so a ticket can never be redeemed twice.
+func (repo *VerificationTicketsRepo) Consume(ctx context.Context, hash string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	// expires_at is written from the clock of the app, which it
+	// must also be compared with in case the database is in another zone
+	query := "UPDATE phone_verification_tickets SET used_at = NOW() WHERE ticket_hash = ? AND used_at IS NULL AND expires_at > ?"
+	res, err := repo.db.ExecContext(ctx, query, hash, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+
+	if n != 1 {
+		return "", nil
+	}
+
+	var msisdn string
+	query = "SELECT t.msisdn FROM phone_verification_tickets AS t WHERE t.ticket_hash = ?"
+	err = repo.db.GetContext(ctx, &msisdn, query, hash)
+	if err != nil {
+		return "", err
+	}
+
+	return msisdn, nil
+}
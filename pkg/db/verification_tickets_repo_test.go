@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+// recentTime matches times within a second of now
+type recentTime struct{}
+
+func (recentTime) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	return ok && time.Since(t) < time.Second && time.Until(t) < time.Second
+}
+
+func TestVerificationTicketsRepo_Consume_ShouldPass(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE phone_verification_tickets SET used_at = NOW\(\) WHERE ticket_hash = \? AND used_at IS NULL AND expires_at > \?$`).
+		WithArgs("h4sh", recentTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(`^SELECT t.msisdn FROM phone_verification_tickets AS t WHERE t.ticket_hash = \?$`).
+		WithArgs("h4sh").
+		WillReturnRows(sqlmock.NewRows([]string{"msisdn"}).AddRow("+233200662782"))
+
+	repo := NewVerificationTicketsRepo(sqlx.NewDb(db, "sqlmock"))
+	msisdn, err := repo.Consume(context.Background(), "h4sh")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if msisdn != "+233200662782" {
+		t.Fatalf("expected msisdn %s, got %s", "+233200662782", msisdn)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestVerificationTicketsRepo_Consume_ShouldFailForUsedTicket(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`^UPDATE phone_verification_tickets SET used_at = NOW\(\)`).
+		WithArgs("h4sh", recentTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewVerificationTicketsRepo(sqlx.NewDb(db, "sqlmock"))
+	msisdn, err := repo.Consume(context.Background(), "h4sh")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(msisdn) != 0 {
+		t.Fatalf("expected empty msisdn, got %s", msisdn)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
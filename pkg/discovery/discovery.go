@@ -0,0 +1,236 @@
+// Package discovery tells users which of their contacts use the app without
+// the server learning the phone numbers of those who do not. Clients hash
+// the numbers of their contacts with a pepper the server publishes and
+// rotates, and the server matches the hashes against the numbers of its
+// users hashed with the same pepper.
+package discovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrUnknownPepper is returned when hashes were made with a pepper that is
+// not in use anymore, or never was. Clients should fetch the current pepper
+// and hash again.
+var ErrUnknownPepper = errors.New("pepper is not in use")
+
+// ErrInvalidHash is returned for hashes that are not hex encoded SHA-256 HMACs
+var ErrInvalidHash = errors.New("hash must be a hex encoded SHA-256 HMAC")
+
+// UserStore returns the phone numbers of the users who can be discovered.
+// It is implemented by *db.MobileUsersRepo.
+type UserStore interface {
+	GetActiveMsisdns(ctx context.Context) ([]string, error)
+}
+
+// Config holds the settings of a Service
+type Config struct {
+	// Rotation is how long a pepper is in use for. Hashes made with the
+	// previous pepper are still accepted, so that clients that fetched
+	// it just before it rotated are not turned away.
+	Rotation time.Duration
+
+	// Refresh is how long the hashes of the numbers of users are kept
+	// before being made again, which is how long new users take to be
+	// discovered
+	Refresh time.Duration
+}
+
+// Pepper is the key clients hash phone numbers with. Version identifies
+// the pepper when hashes are submitted.
+type Pepper struct {
+	Version   int64     `json:"version"`
+	Value     string    `json:"pepper"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Service publishes peppers and matches hashed phone numbers
+// against the phone numbers of users
+type Service struct {
+	users  UserStore
+	secret []byte
+	cfg    Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	indexes map[int64]*index
+	builds  map[int64]*build
+}
+
+// index holds the hashes of the numbers of users made with a pepper
+type index struct {
+	builtAt time.Time
+	hashes  map[[sha256.Size]byte]struct{}
+}
+
+// build is an index being made. Its fields are set before done is closed.
+type build struct {
+	done chan struct{}
+	idx  *index
+	err  error
+}
+
+// NewService returns a pointer to a value of Service. Peppers are derived
+// from secret, so that every instance of the server publishes the same. It
+// should not be used to sign anything else, since peppers are public.
+func NewService(users UserStore, secret string, cfg Config) *Service {
+	if cfg.Rotation <= 0 {
+		cfg.Rotation = 24 * time.Hour
+	}
+
+	return &Service{
+		users:   users,
+		secret:  []byte(secret),
+		cfg:     cfg,
+		now:     time.Now,
+		indexes: map[int64]*index{},
+		builds:  map[int64]*build{},
+	}
+}
+
+// Pepper returns the pepper clients should currently hash phone numbers with
+func (s *Service) Pepper() Pepper {
+	version := s.version(s.now())
+
+	return Pepper{
+		Version:   version,
+		Value:     hex.EncodeToString(s.pepper(version)),
+		ExpiresAt: time.Unix(0, (version+1)*int64(s.cfg.Rotation)).UTC(),
+	}
+}
+
+// Match returns those of hashes that were made from the phone number of a
+// user with the pepper of the specified version. Hashes are made by
+// Hash. The hashes that did not match are neither kept nor logged.
+func (s *Service) Match(ctx context.Context, version int64, hashes []string) ([]string, error) {
+	current := s.version(s.now())
+	if version != current && version != current-1 {
+		return nil, ErrUnknownPepper
+	}
+
+	sums := make([][sha256.Size]byte, len(hashes))
+	for i, hash := range hashes {
+		b, err := hex.DecodeString(hash)
+		if err != nil || len(b) != sha256.Size {
+			return nil, ErrInvalidHash
+		}
+		copy(sums[i][:], b)
+	}
+
+	idx, err := s.index(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]string, 0)
+	for i, sum := range sums {
+		if _, ok := idx.hashes[sum]; ok {
+			matched = append(matched, hashes[i])
+		}
+	}
+
+	return matched, nil
+}
+
+// Hash returns the hex encoded SHA-256 HMAC of msisdn, given in E.164
+// format, keyed with the hex encoded pepper. Clients hash numbers the
+// same way.
+func Hash(pepper, msisdn string) (string, error) {
+	key, err := hex.DecodeString(pepper)
+	if err != nil {
+		return "", err
+	}
+
+	sum := hash(key, msisdn)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func hash(key []byte, msisdn string) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msisdn))
+
+	var sum [sha256.Size]byte
+	copy(sum[:], mac.Sum(nil))
+	return sum
+}
+
+func (s *Service) version(t time.Time) int64 {
+	return t.UnixNano() / int64(s.cfg.Rotation)
+}
+
+func (s *Service) pepper(version int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("contact-discovery:" + strconv.FormatInt(version, 10)))
+	return mac.Sum(nil)
+}
+
+// index returns the hashes of the numbers of users made with the pepper of
+// version, making them again when they are older than the refresh interval.
+// Indexes are made without holding the lock, once for all the requests
+// that need them, and replace the index they refresh when done. Indexes
+// of peppers that are not in use anymore are dropped.
+func (s *Service) index(ctx context.Context, version int64) (*index, error) {
+	s.mu.Lock()
+	if idx, ok := s.indexes[version]; ok && s.now().Sub(idx.builtAt) < s.cfg.Refresh {
+		s.mu.Unlock()
+		return idx, nil
+	}
+
+	b, ok := s.builds[version]
+	if !ok {
+		b = &build{done: make(chan struct{})}
+		s.builds[version] = b
+
+		// the index outlives the request that asked for it
+		go s.build(context.Background(), version, b)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.idx, b.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Service) build(ctx context.Context, version int64, b *build) {
+	defer close(b.done)
+
+	now := s.now()
+	msisdns, err := s.users.GetActiveMsisdns(ctx)
+	if err == nil {
+		key := s.pepper(version)
+		b.idx = &index{
+			builtAt: now,
+			hashes:  make(map[[sha256.Size]byte]struct{}, len(msisdns)),
+		}
+		for _, msisdn := range msisdns {
+			b.idx.hashes[hash(key, msisdn)] = struct{}{}
+		}
+	}
+	b.err = err
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.builds, version)
+	if err != nil {
+		return
+	}
+
+	current := s.version(s.now())
+	for v := range s.indexes {
+		if v != current && v != current-1 {
+			delete(s.indexes, v)
+		}
+	}
+	s.indexes[version] = b.idx
+}
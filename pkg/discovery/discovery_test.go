@@ -0,0 +1,172 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeUsers struct {
+	msisdns []string
+	calls   int
+}
+
+func (fu *fakeUsers) GetActiveMsisdns(ctx context.Context) ([]string, error) {
+	fu.calls++
+	return fu.msisdns, nil
+}
+
+func newTestService(users UserStore, now *time.Time) *Service {
+	s := NewService(users, "50m3h@rd2gu355t3xt", Config{
+		Rotation: 24 * time.Hour,
+		Refresh:  time.Minute,
+	})
+	s.now = func() time.Time { return *now }
+
+	return s
+}
+
+func mustHash(t *testing.T, pepper, msisdn string) string {
+	hash, err := Hash(pepper, msisdn)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return hash
+}
+
+func TestService_Match_ShouldFindRegisteredUsers(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	users := &fakeUsers{msisdns: []string{"+233200662782", "+233244111111"}}
+	s := newTestService(users, &now)
+
+	pepper := s.Pepper()
+	registered := mustHash(t, pepper.Value, "+233200662782")
+	stranger := mustHash(t, pepper.Value, "+233244999999")
+
+	matched, err := s.Match(context.Background(), pepper.Version, []string{stranger, registered})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(matched) != 1 || matched[0] != registered {
+		t.Fatalf("expected only the registered number to match, got %v", matched)
+	}
+}
+
+func TestService_Pepper_ShouldRotate(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	users := &fakeUsers{msisdns: []string{"+233200662782"}}
+	s := newTestService(users, &now)
+
+	old := s.Pepper()
+	if !old.ExpiresAt.Equal(time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the pepper to expire at midnight, got %v", old.ExpiresAt)
+	}
+
+	now = now.Add(24 * time.Hour)
+	current := s.Pepper()
+	if current.Version != old.Version+1 || current.Value == old.Value {
+		t.Fatalf("expected a new pepper, got %+v after %+v", current, old)
+	}
+
+	hash := mustHash(t, old.Value, "+233200662782")
+	matched, err := s.Match(context.Background(), old.Version, []string{hash})
+	if err != nil || len(matched) != 1 {
+		t.Fatalf("expected hashes made with the previous pepper to match, got %v, %v", matched, err)
+	}
+
+	now = now.Add(24 * time.Hour)
+	_, err = s.Match(context.Background(), old.Version, []string{hash})
+	if err != ErrUnknownPepper {
+		t.Fatalf("expected ErrUnknownPepper, got %v", err)
+	}
+}
+
+func TestService_Match_ShouldRefreshUsers(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	users := &fakeUsers{}
+	s := newTestService(users, &now)
+
+	pepper := s.Pepper()
+	hash := mustHash(t, pepper.Value, "+233200662782")
+
+	matched, _ := s.Match(context.Background(), pepper.Version, []string{hash})
+	if len(matched) != 0 {
+		t.Fatalf("expected no matches, got %v", matched)
+	}
+
+	users.msisdns = []string{"+233200662782"}
+	matched, _ = s.Match(context.Background(), pepper.Version, []string{hash})
+	if len(matched) != 0 || users.calls != 1 {
+		t.Fatalf("expected the users to be cached, got %v after %d calls", matched, users.calls)
+	}
+
+	now = now.Add(time.Minute)
+	matched, _ = s.Match(context.Background(), pepper.Version, []string{hash})
+	if len(matched) != 1 {
+		t.Fatalf("expected new users to be discovered after a refresh, got %v", matched)
+	}
+}
+
+func TestService_Match_ShouldFailForInvalidHashes(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestService(&fakeUsers{}, &now)
+
+	for _, hash := range []string{"", "zz", "abcd"} {
+		_, err := s.Match(context.Background(), s.Pepper().Version, []string{hash})
+		if err != ErrInvalidHash {
+			t.Errorf("expected ErrInvalidHash for %q, got %v", hash, err)
+		}
+	}
+}
+
+type blockingUsers struct {
+	started chan struct{}
+	release chan struct{}
+	calls   int
+}
+
+func (bu *blockingUsers) GetActiveMsisdns(ctx context.Context) ([]string, error) {
+	bu.calls++
+	close(bu.started)
+	<-bu.release
+	return []string{"+233200662782"}, nil
+}
+
+func TestService_Match_ShouldNotBlockWhileUsersLoad(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	users := &blockingUsers{started: make(chan struct{}), release: make(chan struct{})}
+	s := newTestService(users, &now)
+
+	pepper := s.Pepper()
+	hash := mustHash(t, pepper.Value, "+233200662782")
+
+	type result struct {
+		matched []string
+		err     error
+	}
+	first := make(chan result)
+	go func() {
+		matched, err := s.Match(context.Background(), pepper.Version, []string{hash})
+		first <- result{matched, err}
+	}()
+	<-users.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Match(ctx, pepper.Version, []string{hash})
+	if err != context.Canceled {
+		t.Fatalf("expected %v while users load, got %v", context.Canceled, err)
+	}
+
+	close(users.release)
+	res := <-first
+	if res.err != nil || len(res.matched) != 1 {
+		t.Fatalf("expected the registered number to match, got %v, %v", res.matched, res.err)
+	}
+
+	if users.calls != 1 {
+		t.Fatalf("expected users to be loaded once, got %d calls", users.calls)
+	}
+}
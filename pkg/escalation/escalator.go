@@ -0,0 +1,184 @@
+// Package escalation notifies ever wider circles of people about alerts that
+// nobody acknowledges. The escalation level of each alert is kept in the
+// database, so escalation carries on where it left off after a restart, and
+// several instances of the service can escalate alerts side by side.
+package escalation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/notify"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"go.uber.org/zap"
+)
+
+// Clock tells the current time. Tests replace it with a fake.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Store keeps the escalation level of alerts. It is implemented
+// by *db.AlertsRepo.
+type Store interface {
+	GetDueEscalations(ctx context.Context, now time.Time, maxLevel, limit int) ([]*db.Alert, error)
+	ClaimEscalation(ctx context.Context, id, level int, escalateAt db.NullableTime) (bool, error)
+}
+
+// Level is a circle of people notified about an alert once it has not been
+// acknowledged for After since the previous circle was notified
+type Level struct {
+	Name   string
+	After  time.Duration
+	Notify notify.AlertNotifier
+}
+
+// Config holds the settings of an Escalator. Interval is how often alerts
+// due for escalation are looked for, and BatchSize the most escalated at
+// a time. They default to 15 seconds and 100.
+type Config struct {
+	Levels    []Level
+	Interval  time.Duration
+	BatchSize int
+}
+
+// Escalator is a notify.AlertNotifier that notifies the first level about
+// alerts as they are raised, and the following levels about alerts that
+// are still not acknowledged when they are due.
+type Escalator struct {
+	store  Store
+	events stream.Broker
+	cfg    Config
+	clock  Clock
+	logger *zap.Logger
+}
+
+// NewEscalator returns a pointer to a value of Escalator. Escalations are
+// published to events unless it is nil.
+func NewEscalator(store Store, events stream.Broker, cfg Config, logger *zap.Logger) *Escalator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 100
+	}
+
+	return &Escalator{
+		store:  store,
+		events: events,
+		cfg:    cfg,
+		clock:  systemClock{},
+		logger: logger,
+	}
+}
+
+// AlertRaised notifies the first level about alert
+func (e *Escalator) AlertRaised(ctx context.Context, alert *db.Alert) error {
+	_, err := e.escalate(ctx, alert)
+	return err
+}
+
+// Run escalates the alerts that are due every interval until ctx is done,
+// which also cancels the escalations under way. Alerts that became due
+// while the service was down are escalated on the first run.
+func (e *Escalator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := e.EscalateDue(ctx)
+		if err != nil {
+			e.logger.Error("failed escalating alerts", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EscalateDue escalates up to the batch size of alerts that are due,
+// oldest first, and returns the number of alerts escalated. Alerts are
+// escalated concurrently, so that slow notifications about one alert do
+// not hold up the others.
+func (e *Escalator) EscalateDue(ctx context.Context) (int, error) {
+	alerts, err := e.store.GetDueEscalations(ctx, e.clock.Now(), len(e.cfg.Levels), e.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		escalated int
+	)
+
+	for _, alert := range alerts {
+		wg.Add(1)
+		go func(alert *db.Alert) {
+			defer wg.Done()
+
+			ok, err := e.escalate(ctx, alert)
+			if err != nil {
+				e.logger.Error("failed escalating alert", zap.Int("alertId", alert.ID), zap.Error(err))
+			}
+
+			if ok {
+				mu.Lock()
+				escalated++
+				mu.Unlock()
+			}
+		}(alert)
+	}
+
+	wg.Wait()
+	return escalated, nil
+}
+
+// escalate notifies the next level about alert, after claiming it so that
+// no other instance notifies the same level, and reports whether it claimed
+// the alert. A level whose notification fails is not retried, so that its
+// circle is not notified twice.
+func (e *Escalator) escalate(ctx context.Context, alert *db.Alert) (bool, error) {
+	level := alert.EscalationLevel
+	if level >= len(e.cfg.Levels) {
+		return false, nil
+	}
+
+	var escalateAt db.NullableTime
+	if level+1 < len(e.cfg.Levels) {
+		escalateAt = db.NewNullableTime(e.clock.Now().Add(e.cfg.Levels[level+1].After))
+	}
+
+	claimed, err := e.store.ClaimEscalation(ctx, alert.ID, level, escalateAt)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	escalated := *alert
+	escalated.EscalationLevel = level + 1
+	escalated.EscalateAt = escalateAt
+
+	e.logger.Info("escalating alert",
+		zap.Int("alertId", alert.ID),
+		zap.Int("level", escalated.EscalationLevel),
+		zap.String("circle", e.cfg.Levels[level].Name),
+	)
+
+	if e.events != nil {
+		e.events.Publish(stream.EventAlertEscalated, &escalated)
+	}
+
+	return true, e.cfg.Levels[level].Notify.AlertRaised(ctx, &escalated)
+}
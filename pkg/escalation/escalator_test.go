@@ -0,0 +1,256 @@
+package escalation
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/stream"
+	"go.uber.org/zap"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	return fc.now
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.now = fc.now.Add(d)
+}
+
+// fakeStore keeps alerts in memory the way *db.AlertsRepo keeps them in
+// the database, so it outlives the escalators using it
+type fakeStore struct {
+	mu     sync.Mutex
+	alerts map[int]*db.Alert
+}
+
+func newFakeStore(alerts ...*db.Alert) *fakeStore {
+	fs := &fakeStore{alerts: map[int]*db.Alert{}}
+	for _, alert := range alerts {
+		fs.alerts[alert.ID] = alert
+	}
+	return fs
+}
+
+func (fs *fakeStore) GetDueEscalations(ctx context.Context, now time.Time, maxLevel, limit int) ([]*db.Alert, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var due []*db.Alert
+	for _, alert := range fs.alerts {
+		if alert.Status != db.AlertStatusRaised || alert.EscalationLevel >= maxLevel {
+			continue
+		}
+
+		if alert.EscalateAt.Valid && alert.EscalateAt.Time.After(now) {
+			continue
+		}
+
+		copied := *alert
+		due = append(due, &copied)
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (fs *fakeStore) ClaimEscalation(ctx context.Context, id, level int, escalateAt db.NullableTime) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	alert := fs.alerts[id]
+	if alert == nil || alert.EscalationLevel != level || alert.Status != db.AlertStatusRaised {
+		return false, nil
+	}
+
+	alert.EscalationLevel, alert.EscalateAt = level+1, escalateAt
+	return true, nil
+}
+
+func (fs *fakeStore) setStatus(id int, status string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.alerts[id].Status = status
+}
+
+type recordingNotifier struct {
+	mu       sync.Mutex
+	alertIDs []int
+}
+
+func (rn *recordingNotifier) AlertRaised(ctx context.Context, alert *db.Alert) error {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	rn.alertIDs = append(rn.alertIDs, alert.ID)
+	return nil
+}
+
+func (rn *recordingNotifier) notified() []int {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+
+	return append([]int(nil), rn.alertIDs...)
+}
+
+type testCircles struct {
+	contacts, volunteers, admins *recordingNotifier
+}
+
+func newTestEscalator(store Store, clock Clock) (*Escalator, *testCircles, *stream.Hub) {
+	circles := &testCircles{&recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}}
+	events := stream.NewHub(stream.HubConfig{History: 10, Buffer: 10})
+
+	escalator := NewEscalator(store, events, Config{
+		Levels: []Level{
+			{Name: "contacts", Notify: circles.contacts},
+			{Name: "volunteers", After: 2 * time.Minute, Notify: circles.volunteers},
+			{Name: "admins", After: 5 * time.Minute, Notify: circles.admins},
+		},
+	}, zap.NewNop())
+	escalator.clock = clock
+
+	return escalator, circles, events
+}
+
+func assertNotified(t *testing.T, circle string, rn *recordingNotifier, ids ...int) {
+	t.Helper()
+
+	got := rn.notified()
+	sort.Ints(got)
+	if len(got) != len(ids) {
+		t.Fatalf("expected %s notified about %v, got %v", circle, ids, got)
+	}
+
+	for i := range ids {
+		if got[i] != ids[i] {
+			t.Fatalf("expected %s notified about %v, got %v", circle, ids, got)
+		}
+	}
+}
+
+func escalateDue(t *testing.T, e *Escalator, expected int) {
+	t.Helper()
+
+	n, err := e.EscalateDue(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if n != expected {
+		t.Fatalf("expected %d alerts escalated, got %d", expected, n)
+	}
+}
+
+func TestEscalator_ShouldNotifyWiderCirclesUntilAcknowledged(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	alert := &db.Alert{ID: 1, UserID: 7, Status: db.AlertStatusRaised}
+	store := newFakeStore(alert)
+	escalator, circles, _ := newTestEscalator(store, clock)
+
+	err := escalator.AlertRaised(context.Background(), alert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertNotified(t, "contacts", circles.contacts, 1)
+
+	clock.Advance(time.Minute)
+	escalateDue(t, escalator, 0)
+	assertNotified(t, "volunteers", circles.volunteers)
+
+	clock.Advance(time.Minute)
+	escalateDue(t, escalator, 1)
+	assertNotified(t, "volunteers", circles.volunteers, 1)
+
+	store.setStatus(1, db.AlertStatusAcknowledged)
+	clock.Advance(10 * time.Minute)
+	escalateDue(t, escalator, 0)
+	assertNotified(t, "admins", circles.admins)
+}
+
+func TestEscalator_ShouldStopAfterTheLastCircle(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	store := newFakeStore(&db.Alert{ID: 1, UserID: 7, Status: db.AlertStatusRaised})
+	escalator, circles, _ := newTestEscalator(store, clock)
+
+	escalateDue(t, escalator, 1)
+	clock.Advance(2 * time.Minute)
+	escalateDue(t, escalator, 1)
+	clock.Advance(5 * time.Minute)
+	escalateDue(t, escalator, 1)
+	clock.Advance(time.Hour)
+	escalateDue(t, escalator, 0)
+
+	assertNotified(t, "contacts", circles.contacts, 1)
+	assertNotified(t, "volunteers", circles.volunteers, 1)
+	assertNotified(t, "admins", circles.admins, 1)
+}
+
+func TestEscalator_ShouldResumeAfterRestart(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	store := newFakeStore(
+		// raised just before the service went down, before contacts were notified
+		&db.Alert{ID: 1, UserID: 7, Status: db.AlertStatusRaised},
+		// due for the volunteers while the service was down
+		&db.Alert{ID: 2, UserID: 8, Status: db.AlertStatusRaised, EscalationLevel: 1, EscalateAt: db.NewNullableTime(clock.Now().Add(-time.Minute))},
+		// not yet due for the volunteers
+		&db.Alert{ID: 3, UserID: 9, Status: db.AlertStatusRaised, EscalationLevel: 1, EscalateAt: db.NewNullableTime(clock.Now().Add(time.Minute))},
+	)
+
+	escalator, circles, _ := newTestEscalator(store, clock)
+	escalateDue(t, escalator, 2)
+
+	assertNotified(t, "contacts", circles.contacts, 1)
+	assertNotified(t, "volunteers", circles.volunteers, 2)
+
+	// a second instance sharing the store does not notify the same circles again
+	other, otherCircles, _ := newTestEscalator(store, clock)
+	escalateDue(t, other, 0)
+	assertNotified(t, "contacts", otherCircles.contacts)
+	assertNotified(t, "volunteers", otherCircles.volunteers)
+}
+
+func TestEscalator_ShouldPublishEscalations(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	store := newFakeStore(&db.Alert{ID: 1, UserID: 7, Status: db.AlertStatusRaised, EscalationLevel: 1})
+	escalator, _, events := newTestEscalator(store, clock)
+
+	sub, err := events.Subscribe(stream.Filter{UserID: 7}, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer sub.Close()
+
+	escalateDue(t, escalator, 1)
+
+	select {
+	case event := <-sub.Events():
+		if event.Type != stream.EventAlertEscalated || event.Alert.EscalationLevel != 2 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+
+		if !event.Alert.EscalateAt.Valid || !event.Alert.EscalateAt.Time.Equal(clock.Now().Add(5*time.Minute)) {
+			t.Fatalf("expected the admins to be due in 5 minutes, got %+v", event.Alert.EscalateAt)
+		}
+	default:
+		t.Fatalf("expected an escalation event")
+	}
+}
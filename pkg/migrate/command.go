@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Usage describes the arguments accepted by Command
+const Usage = `usage: migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down         roll back the newest applied migration
+  to N         apply or roll back migrations until N is the newest applied
+  status       list migrations and whether they are applied
+  baseline N   record migrations up to N as applied without running them`
+
+// Command runs the migrate subcommand described by args, e.g. "up" or
+// "to 4", and writes its outcome to w
+func Command(ctx context.Context, m *Migrator, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(Usage)
+	}
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		count, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "applied %d migrations\n", count)
+		return nil
+
+	case args[0] == "down" && len(args) == 1:
+		err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "rolled back 1 migration")
+		return nil
+
+	case args[0] == "to" && len(args) == 2:
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errors.Errorf("invalid migration version %q", args[1])
+		}
+
+		count, err := m.To(ctx, version)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "migrated %d migrations to version %d\n", count, version)
+		return nil
+
+	case args[0] == "baseline" && len(args) == 2:
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errors.Errorf("invalid migration version %q", args[1])
+		}
+
+		err = m.Baseline(ctx, version)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "recorded migrations up to version %d as applied\n", version)
+		return nil
+
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return renderStatus(w, statuses)
+	}
+
+	return errors.New(Usage)
+}
+
+func renderStatus(w io.Writer, statuses []MigrationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, s := range statuses {
+		status, appliedAt := "pending", ""
+		if s.Applied {
+			status, appliedAt = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		switch {
+		case s.Unknown:
+			status = "applied, unknown to this build"
+		case s.Modified:
+			status = "applied, modified since"
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+	}
+
+	return tw.Flush()
+}
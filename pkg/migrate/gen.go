@@ -0,0 +1,45 @@
+//go:build ignore
+// +build ignore
+
+// gen.go writes sources.go, which compiles the migration files into the
+// migrate package. Run it with go generate after changing a migration.
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+func main() {
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		log.Fatalf("failed listing migrations : %v", err)
+	}
+	sort.Strings(files)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage migrate\n\nvar sources = map[string]string{\n")
+	for _, file := range files {
+		sql, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatalf("failed reading %s : %v", file, err)
+		}
+		buf.WriteString(strconv.Quote(filepath.Base(file)) + ": " + strconv.Quote(string(sql)) + ",\n")
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("failed formatting sources : %v", err)
+	}
+
+	err = ioutil.WriteFile("sources.go", src, 0644)
+	if err != nil {
+		log.Fatalf("failed writing sources.go : %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package migrate applies the numbered migrations in the migrations folder
+// to the database and records them in the schema_migrations table. The
+// migrations are compiled into the binary by go generate, so the service
+// can migrate the database it runs against without the SQL files at hand.
+//
+// Migrations are pairs of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, with versions numbered from 1 without gaps.
+// Each file is made of sections that start with a "-- name: <name>"
+// comment and hold a single statement.
+package migrate
+
+//go:generate go run gen.go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Migration is a numbered change to the schema of the database
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum returns the hash of the up SQL of m, which is recorded when
+// m is applied so that changes to applied migrations can be detected
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Statement is a section of a migration
+type Statement struct {
+	Name string
+	SQL  string
+}
+
+var (
+	fileNameRegexp = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	sectionRegexp  = regexp.MustCompile(`(?m)^-- name:[ \t]*(\S+)[ \t]*$`)
+)
+
+// Statements returns the sections of sql in order. Text before the first
+// section is ignored.
+func Statements(sql string) []Statement {
+	var statements []Statement
+
+	bounds := sectionRegexp.FindAllStringSubmatchIndex(sql, -1)
+	for i, b := range bounds {
+		end := len(sql)
+		if i+1 < len(bounds) {
+			end = bounds[i+1][0]
+		}
+
+		body := strings.TrimSpace(sql[b[1]:end])
+		body = strings.TrimSpace(strings.TrimSuffix(body, ";"))
+		if len(body) == 0 {
+			continue
+		}
+
+		statements = append(statements, Statement{Name: sql[b[2]:b[3]], SQL: body})
+	}
+
+	return statements
+}
+
+// Load returns the migrations in sources, which holds the contents of
+// migration files indexed by file name, ordered by version
+func Load(sources map[string]string) ([]Migration, error) {
+	byVersion := map[int]*Migration{}
+
+	for file, sql := range sources {
+		match := fileNameRegexp.FindStringSubmatch(file)
+		if match == nil {
+			return nil, errors.Errorf("migration file %s is not named <version>_<name>.(up|down).sql", file)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, errors.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+
+		if len(Statements(sql)) == 0 {
+			return nil, errors.Errorf("migration file %s has no statements", file)
+		}
+
+		if match[3] == "up" {
+			m.Up = sql
+		} else {
+			m.Down = sql
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, errors.Errorf("migration %d is missing", i+1)
+		}
+
+		if len(m.Up) == 0 {
+			return nil, errors.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Embedded returns the migrations compiled into the binary
+func Embedded() ([]Migration, error) {
+	return Load(sources)
+}
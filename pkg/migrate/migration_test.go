@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatements_ShouldSplitNamedSections(t *testing.T) {
+	sql := `-- leading comments are ignored
+-- name: create-things
+CREATE TABLE things (
+    id INT NOT NULL
+);
+
+-- name: empty
+
+-- name: index-things
+CREATE INDEX things_id ON things (id);
+`
+
+	statements := Statements(sql)
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements, got %+v", statements)
+	}
+
+	if statements[0].Name != "create-things" || statements[0].SQL != "CREATE TABLE things (\n    id INT NOT NULL\n)" {
+		t.Fatalf("unexpected first statement %+v", statements[0])
+	}
+
+	if statements[1].Name != "index-things" || statements[1].SQL != "CREATE INDEX things_id ON things (id)" {
+		t.Fatalf("unexpected second statement %+v", statements[1])
+	}
+}
+
+func TestLoad_ShouldOrderMigrationsByVersion(t *testing.T) {
+	migrations, err := Load(map[string]string{
+		"0002_things_index.up.sql":   "-- name: a\nCREATE INDEX things_id ON things (id);",
+		"0001_things.down.sql":       "-- name: a\nDROP TABLE things;",
+		"0001_things.up.sql":         "-- name: a\nCREATE TABLE things (id INT);",
+		"0002_things_index.down.sql": "-- name: a\nDROP INDEX things_id ON things;",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Name != "things" || migrations[1].Name != "things_index" {
+		t.Fatalf("unexpected migrations %+v", migrations)
+	}
+
+	if migrations[0].Checksum() == migrations[1].Checksum() || len(migrations[0].Checksum()) != 64 {
+		t.Fatalf("unexpected checksums %s and %s", migrations[0].Checksum(), migrations[1].Checksum())
+	}
+}
+
+func TestLoad_ShouldFailForInvalidMigrations(t *testing.T) {
+	cases := map[string]map[string]string{
+		"bad name":      {"things.up.sql": "-- name: a\nSELECT 1;"},
+		"gap":           {"0001_a.up.sql": "-- name: a\nSELECT 1;", "0003_c.up.sql": "-- name: a\nSELECT 1;"},
+		"no up file":    {"0001_a.down.sql": "-- name: a\nSELECT 1;"},
+		"no statements": {"0001_a.up.sql": "SELECT 1;"},
+		"renamed":       {"0001_a.up.sql": "-- name: a\nSELECT 1;", "0001_b.down.sql": "-- name: a\nSELECT 1;"},
+	}
+
+	for name, sources := range cases {
+		_, err := Load(sources)
+		if err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestEmbedded_ShouldMatchMigrationFiles(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(files) != len(sources) {
+		t.Fatalf("expected %d embedded files, got %d, run go generate", len(files), len(sources))
+	}
+
+	for _, file := range files {
+		sql, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if sources[filepath.Base(file)] != string(sql) {
+			t.Fatalf("embedded %s is out of date, run go generate", filepath.Base(file))
+		}
+	}
+
+	_, err = Embedded()
+	if err != nil {
+		t.Fatalf("expected embedded migrations to load, got %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// lockName is the name of the MySQL advisory lock held while migrating, so
+// that replicas starting at the same time do not apply migrations twice
+const lockName = "hoodcops_schema_migrations"
+
+// ErrLockTimeout is returned when the migration lock is not acquired in time
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// AppliedMigration is a migration recorded in the schema_migrations table
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// MigrationStatus is the state of a migration in the database. Migrations
+// applied by a newer build of the service have no SQL in this one.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool
+	Unknown   bool
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db          *sqlx.DB
+	migrations  []Migration
+	lockTimeout time.Duration
+	logger      *zap.Logger
+}
+
+// NewMigrator returns a migrator of db to migrations, which must be
+// ordered by version as returned by Load. The migrator waits up to
+// lockTimeout for other migrators of the same database to finish.
+func NewMigrator(db *sqlx.DB, migrations []Migration, lockTimeout time.Duration, logger *zap.Logger) *Migrator {
+	return &Migrator{
+		db:          db,
+		migrations:  migrations,
+		lockTimeout: lockTimeout,
+		logger:      logger,
+	}
+}
+
+// Latest returns the version of the newest migration known to m
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Up applies all pending migrations and returns how many were applied.
+// A database migrated by a newer build of the service is left as it is.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn, applied []AppliedMigration) error {
+		current := len(applied)
+		if current > m.Latest() {
+			m.logger.Warn("database has migrations unknown to this build",
+				zap.Int("version", current),
+				zap.Int("latest", m.Latest()),
+			)
+			return nil
+		}
+
+		var err error
+		count, err = m.migrate(ctx, conn, current, m.Latest())
+		return err
+	})
+
+	return count, err
+}
+
+// Down rolls back the newest applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn, applied []AppliedMigration) error {
+		if len(applied) == 0 {
+			return errors.New("no migrations have been applied")
+		}
+
+		_, err := m.migrate(ctx, conn, len(applied), len(applied)-1)
+		return err
+	})
+}
+
+// To applies or rolls back migrations until version is the newest
+// applied migration, and returns how many were applied or rolled back
+func (m *Migrator) To(ctx context.Context, version int) (int, error) {
+	if version < 0 || version > m.Latest() {
+		return 0, errors.Errorf("unknown migration %d, the latest is %d", version, m.Latest())
+	}
+
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn, applied []AppliedMigration) error {
+		var err error
+		count, err = m.migrate(ctx, conn, len(applied), version)
+		return err
+	})
+
+	return count, err
+}
+
+// Baseline records migrations up to version as applied without running
+// them, for databases that were migrated by hand before the migrations
+// were tracked. It fails if any migration has been recorded already.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	if version < 1 || version > m.Latest() {
+		return errors.Errorf("unknown migration %d, the latest is %d", version, m.Latest())
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn, applied []AppliedMigration) error {
+		if len(applied) > 0 {
+			return errors.Errorf("database is already at migration %d", len(applied))
+		}
+
+		for _, migration := range m.migrations[:version] {
+			err := m.record(ctx, conn, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		m.logger.Info("recorded baseline migrations", zap.Int("version", version))
+		return nil
+	})
+}
+
+// Status returns the state of every known or applied migration
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name})
+		}
+
+		for _, a := range applied {
+			if a.Version > m.Latest() {
+				statuses = append(statuses, MigrationStatus{Version: a.Version, Name: a.Name, Unknown: true})
+			}
+
+			s := &statuses[a.Version-1]
+			s.Applied, s.AppliedAt = true, a.AppliedAt
+			s.Modified = !s.Unknown && a.Checksum != m.migrations[a.Version-1].Checksum()
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// migrate applies or rolls back migrations to move the database from
+// version current to version target
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target int) (int, error) {
+	count := 0
+
+	for v := current + 1; v <= target; v++ {
+		migration := m.migrations[v-1]
+		err := m.exec(ctx, conn, migration, migration.Up)
+		if err != nil {
+			return count, err
+		}
+
+		err = m.record(ctx, conn, migration)
+		if err != nil {
+			return count, err
+		}
+
+		count++
+		m.logger.Info("applied migration", zap.Int("version", v), zap.String("name", migration.Name))
+	}
+
+	for v := current; v > target; v-- {
+		if v > m.Latest() {
+			return count, errors.Errorf("migration %d is unknown to this build and cannot be rolled back", v)
+		}
+
+		migration := m.migrations[v-1]
+		if len(migration.Down) == 0 {
+			return count, errors.Errorf("migration %d_%s cannot be rolled back", v, migration.Name)
+		}
+
+		err := m.exec(ctx, conn, migration, migration.Down)
+		if err != nil {
+			return count, err
+		}
+
+		_, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", v)
+		if err != nil {
+			return count, errors.Wrapf(err, "failed unrecording migration %d", v)
+		}
+
+		count++
+		m.logger.Info("rolled back migration", zap.Int("version", v), zap.String("name", migration.Name))
+	}
+
+	return count, nil
+}
+
+// exec runs the statements of source, one of the files of migration. MySQL
+// commits schema changes as they are made, so a migration that fails
+// halfway has to be fixed by hand before it is run again.
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, migration Migration, source string) error {
+	for _, statement := range Statements(source) {
+		_, err := conn.ExecContext(ctx, statement.SQL)
+		if err != nil {
+			return errors.Wrapf(err, "migration %d_%s failed at %s", migration.Version, migration.Name, statement.Name)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) record(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	query := "INSERT INTO schema_migrations (version, name, checksum) VALUES(?, ?, ?)"
+	_, err := conn.ExecContext(ctx, query, migration.Version, migration.Name, migration.Checksum())
+	if err != nil {
+		return errors.Wrapf(err, "failed recording migration %d", migration.Version)
+	}
+
+	return nil
+}
+
+// applied returns the applied migrations ordered by version. Applied
+// versions must run from 1 without gaps.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]AppliedMigration, error) {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     INT             NOT NULL PRIMARY KEY,
+		name        VARCHAR(128)    NOT NULL,
+		checksum    CHAR(64)        NOT NULL,
+		applied_at  DATETIME        NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	_, err := conn.ExecContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating schema_migrations table")
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		a := AppliedMigration{}
+		err = rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if a.Version != len(applied)+1 {
+			return nil, errors.Errorf("migration %d is recorded but migration %d is not", a.Version, len(applied)+1)
+		}
+
+		applied = append(applied, a)
+	}
+
+	return applied, rows.Err()
+}
+
+// withConn runs fn on a connection of its own, so that session state
+// such as advisory locks is kept between statements
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+// withLock runs fn holding the migration lock, with the applied migrations.
+// fn is not run if any applied migration has been changed since.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied []AppliedMigration) error) error {
+	return m.withConn(ctx, func(conn *sql.Conn) error {
+		var acquired sql.NullInt64
+		timeout := int(math.Ceil(m.lockTimeout.Seconds()))
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, timeout).Scan(&acquired)
+		if err != nil {
+			return errors.Wrap(err, "failed acquiring migration lock")
+		}
+
+		if acquired.Int64 != 1 {
+			return ErrLockTimeout
+		}
+
+		defer func() {
+			_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+			if err != nil {
+				m.logger.Error("failed releasing migration lock", zap.Error(err))
+			}
+		}()
+
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range applied {
+			if a.Version <= m.Latest() && a.Checksum != m.migrations[a.Version-1].Checksum() {
+				return errors.Errorf("migration %d_%s has changed since it was applied", a.Version, a.Name)
+			}
+		}
+
+		return fn(conn, applied)
+	})
+}
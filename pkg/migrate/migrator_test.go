@@ -0,0 +1,151 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "things", Up: "-- name: create-things\nCREATE TABLE things (id INT);", Down: "-- name: drop-things\nDROP TABLE things;"},
+	{Version: 2, Name: "things_index", Up: "-- name: index-things\nCREATE INDEX things_id ON things (id);"},
+}
+
+func expectLock(mock sqlmock.Sqlmock, acquired int) {
+	mock.ExpectQuery(`^SELECT GET_LOCK\(\?, \?\)$`).
+		WithArgs(lockName, 60).
+		WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(acquired))
+}
+
+func expectApplied(mock sqlmock.Sqlmock, applied ...Migration) {
+	mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+	for _, m := range applied {
+		rows.AddRow(m.Version, m.Name, m.Checksum(), time.Now())
+	}
+	mock.ExpectQuery(`^SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version$`).
+		WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`^SELECT RELEASE_LOCK\(\?\)$`).
+		WithArgs(lockName).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestMigrator_Up_ShouldApplyPendingMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	expectLock(mock, 1)
+	expectApplied(mock, testMigrations[0])
+	mock.ExpectExec(`^CREATE INDEX things_id ON things \(id\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO schema_migrations \(version, name, checksum\) VALUES\(\?, \?, \?\)$`).
+		WithArgs(2, "things_index", testMigrations[1].Checksum()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	m := NewMigrator(sqlx.NewDb(db, "sqlmock"), testMigrations, time.Minute, zap.NewNop())
+	count, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("expected 1 migration to be applied, got %d", count)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrator_Up_ShouldFailWhenLockIsHeld(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	expectLock(mock, 0)
+
+	m := NewMigrator(sqlx.NewDb(db, "sqlmock"), testMigrations, time.Minute, zap.NewNop())
+	_, err = m.Up(context.Background())
+	if err != ErrLockTimeout {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrator_Up_ShouldFailForModifiedMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	modified := testMigrations[0]
+	modified.Up = "-- name: create-things\nCREATE TABLE things (id BIGINT);"
+
+	expectLock(mock, 1)
+	expectApplied(mock, modified)
+	expectUnlock(mock)
+
+	m := NewMigrator(sqlx.NewDb(db, "sqlmock"), testMigrations, time.Minute, zap.NewNop())
+	_, err = m.Up(context.Background())
+	if err == nil || err.Error() != "migration 1_things has changed since it was applied" {
+		t.Fatalf("expected modified migration error, got %v", err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrator_To_ShouldRollBackMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening database connection", err)
+	}
+	defer db.Close()
+
+	expectLock(mock, 1)
+	expectApplied(mock, testMigrations[0])
+	mock.ExpectExec(`^DROP TABLE things$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^DELETE FROM schema_migrations WHERE version = \?$`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(mock)
+
+	m := NewMigrator(sqlx.NewDb(db, "sqlmock"), testMigrations, time.Minute, zap.NewNop())
+	count, err := m.To(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("expected 1 migration to be rolled back, got %d", count)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
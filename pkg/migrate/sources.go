@@ -0,0 +1,38 @@
+// Code generated by gen.go; DO NOT EDIT.
+
+package migrate
+
+var sources = map[string]string{
+	"0001_initial.down.sql":                     "-- name: remove-mobile-user-alerts\nDROP TABLE IF EXISTS mobile_user_alerts;\n\n-- name: remove-mobile-user-profiles\nDROP TABLE IF EXISTS mobile_user_profiles;\n\n-- name: remove-mobile-user-contacts\nDROP TABLE IF EXISTS mobile_user_contacts;\n\n-- name: remove-mobile-user-tokens\nDROP TABLE IF EXISTS mobile_user_tokens;\n\n-- name: remove-mobile-users\nDROP TABLE IF EXISTS mobile_users;\n\n-- name: remove-user-accounts\nDROP TABLE IF EXISTS user_accounts;\n",
+	"0001_initial.up.sql":                       "-- name: create-user-accounts\nCREATE TABLE IF NOT EXISTS user_accounts\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    username        VARCHAR(255)   NOT NULL,\n    password        VARCHAR(255)   NOT NULL,\n    is_admin        BOOLEAN        DEFAULT TRUE,\n    created_at      DATETIME       DEFAULT NOW(),\n    last_login_at   DATETIME       NULL,\n    updated_at      DATETIME       NULL,      \n    PRIMARY KEY(id)\n);\n\n-- name: create-user-accounts-username-index\nCREATE UNIQUE INDEX user_accounts_username_index ON user_accounts(username);\n\n-- name: create-mobile-users\nCREATE TABLE IF NOT EXISTS mobile_users\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    msisdn          VARCHAR(255)   NOT NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    last_login_at   DATETIME       NULL,     \n    PRIMARY KEY(id)\n);\n\n-- name: create-mobile-users-msisdn-index\nCREATE UNIQUE INDEX mobile_users_msisdn_index ON mobile_users(msisdn);\n\n-- name: create-mobile-user-tokens\nCREATE TABLE IF NOT EXISTS mobile_user_tokens\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    user_id         INT            NOT NULL,\n    platform        VARCHAR(255)   NOT NULL,\n    token           VARCHAR(255)   NOT NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    updated_at      DATETIME       NULL,     \n    PRIMARY KEY(id),\n    CONSTRAINT fk_mobile_user_tokens_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)\n);\n\n-- name: create-mobile-users-token-index\nCREATE UNIQUE INDEX mobile_users_token_index ON mobile_user_tokens(token);\n\n-- name: create-contacts\nCREATE TABLE IF NOT EXISTS mobile_user_contacts\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    msisdn          VARCHAR(255)   NOT NULL,\n    fullname        VARCHAR(255)   NOT NULL,\n    user_id         INT            NOT NULL,\n    created_at      DATETIME       DEFAULT NOW(),   \n    PRIMARY KEY(id),\n    CONSTRAINT fk_mobile_user_contacts_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)\n);\n\n-- name: create-mobile-user-profiles\nCREATE TABLE IF NOT EXISTS mobile_user_profiles\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    user_id         INT            NOT NULL,\n    title           VARCHAR(255)   NULL,\n    fullname        VARCHAR(255)   NULL,\n    street          VARCHAR(255)   NULL,\n    city            VARCHAR(255)   NULL,\n    post_code       VARCHAR(255)   NULL,\n    geo_lng         VARCHAR(255)   NULL,\n    geo_lat         VARCHAR(255)   NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    updated_at      DATETIME       NULL,     \n    PRIMARY KEY(id),\n    CONSTRAINT fk_mobile_user_profiles_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)\n);\n\n-- name: create-mobile-user-profiles-index\nCREATE UNIQUE INDEX mobile_user_profiles_index ON mobile_user_profiles(user_id);\n\n-- name: create-mobile-user-alerts\nCREATE TABLE IF NOT EXISTS mobile_user_alerts\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    user_id         INT            NOT NULL,\n    geo_lng         VARCHAR(255)   NULL,\n    geo_lat         VARCHAR(255)   NULL,\n    created_at      DATETIME       DEFAULT NOW(),   \n    PRIMARY KEY(id),\n    CONSTRAINT fk_mobile_user_alerts_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)\n);\n",
+	"0002_refresh_tokens.down.sql":              "-- name: remove-mobile-user-refresh-tokens\nDROP TABLE IF EXISTS mobile_user_refresh_tokens;\n",
+	"0002_refresh_tokens.up.sql":                "-- name: create-mobile-user-refresh-tokens\nCREATE TABLE IF NOT EXISTS mobile_user_refresh_tokens\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    user_id         INT            NOT NULL,\n    family_id       VARCHAR(64)    NOT NULL,\n    device_id       VARCHAR(255)   NOT NULL,\n    token_hash      CHAR(64)       NOT NULL,\n    expires_at      DATETIME       NOT NULL,\n    used_at         DATETIME       NULL,\n    revoked_at      DATETIME       NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    PRIMARY KEY(id),\n    CONSTRAINT fk_mobile_user_refresh_tokens_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)\n);\n\n-- name: create-mobile-user-refresh-tokens-hash-index\nCREATE UNIQUE INDEX mobile_user_refresh_tokens_hash_index ON mobile_user_refresh_tokens(token_hash);\n\n-- name: create-mobile-user-refresh-tokens-family-index\nCREATE INDEX mobile_user_refresh_tokens_family_index ON mobile_user_refresh_tokens(family_id);\n\n-- name: create-mobile-user-refresh-tokens-device-index\nCREATE INDEX mobile_user_refresh_tokens_device_index ON mobile_user_refresh_tokens(user_id, device_id);\n",
+	"0003_verification_tickets.down.sql":        "-- name: remove-phone-verification-tickets\nDROP TABLE IF EXISTS phone_verification_tickets;\n",
+	"0003_verification_tickets.up.sql":          "-- name: create-phone-verification-tickets\nCREATE TABLE IF NOT EXISTS phone_verification_tickets\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    msisdn          VARCHAR(255)   NOT NULL,\n    ticket_hash     CHAR(64)       NOT NULL,\n    expires_at      DATETIME       NOT NULL,\n    used_at         DATETIME       NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    PRIMARY KEY(id)\n);\n\n-- name: create-phone-verification-tickets-hash-index\nCREATE UNIQUE INDEX phone_verification_tickets_hash_index ON phone_verification_tickets(ticket_hash);\n",
+	"0004_verification_codes.down.sql":          "-- name: remove-phone-verification-codes\nDROP TABLE IF EXISTS phone_verification_codes;\n",
+	"0004_verification_codes.up.sql":            "-- name: create-phone-verification-codes\nCREATE TABLE IF NOT EXISTS phone_verification_codes\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    msisdn          VARCHAR(255)   NOT NULL,\n    code_hash       CHAR(64)       NOT NULL,\n    attempts        INT            NOT NULL     DEFAULT 0,\n    expires_at      DATETIME       NOT NULL,\n    verified_at     DATETIME       NULL,\n    canceled_at     DATETIME       NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    PRIMARY KEY(id)\n);\n\n-- name: create-phone-verification-codes-msisdn-index\nCREATE INDEX phone_verification_codes_msisdn_index ON phone_verification_codes(msisdn);\n",
+	"0005_rate_limits.down.sql":                 "-- name: remove-rate-limits\nDROP TABLE IF EXISTS rate_limits;\n",
+	"0005_rate_limits.up.sql":                   "-- name: create-rate-limits\nCREATE TABLE IF NOT EXISTS rate_limits\n(\n    rate_key        VARCHAR(255)   NOT NULL,\n    tokens          DOUBLE         NOT NULL     DEFAULT 0,\n    count           INT            NOT NULL     DEFAULT 0,\n    window_ends_at  DATETIME       NULL,\n    next_allowed_at DATETIME       NULL,\n    updated_at      DATETIME       NULL,\n    PRIMARY KEY(rate_key)\n);\n",
+	"0006_alerts.down.sql":                      "-- name: remove-mobile-user-alert-events\nDROP TABLE IF EXISTS mobile_user_alert_events;\n\n-- name: drop-mobile-user-alerts-user-index\nDROP INDEX mobile_user_alerts_user_index ON mobile_user_alerts;\n\n-- name: restore-mobile-user-alerts\nALTER TABLE mobile_user_alerts\n    MODIFY geo_lng  VARCHAR(255)   NULL,\n    MODIFY geo_lat  VARCHAR(255)   NULL,\n    DROP accuracy,\n    DROP category,\n    DROP message,\n    DROP status,\n    DROP updated_at;\n",
+	"0006_alerts.up.sql":                        "-- Legacy alerts were stored with free text coordinates, so those that are\n-- missing or out of range are canceled and placed at 0,0 before the\n-- coordinates become numbers.\n\n-- name: alter-mobile-user-alerts\nALTER TABLE mobile_user_alerts\n    ADD accuracy    DOUBLE         NOT NULL     DEFAULT 0,\n    ADD category    VARCHAR(64)    NOT NULL     DEFAULT 'general',\n    ADD message     VARCHAR(1024)  NOT NULL     DEFAULT '',\n    ADD status      VARCHAR(32)    NOT NULL     DEFAULT 'raised',\n    ADD updated_at  DATETIME       NULL;\n\n-- name: update-mobile-user-alerts-invalid-location\nUPDATE mobile_user_alerts\n    SET status = 'canceled',\n        message = 'Alert had no valid location',\n        geo_lng = '0',\n        geo_lat = '0'\n    WHERE geo_lat IS NULL\n       OR geo_lng IS NULL\n       OR geo_lat NOT REGEXP '^-?([0-8]?[0-9](\\\\.[0-9]+)?|90(\\\\.0+)?)$'\n       OR geo_lng NOT REGEXP '^-?((1[0-7][0-9]|[0-9]?[0-9])(\\\\.[0-9]+)?|180(\\\\.0+)?)$';\n\n-- name: alter-mobile-user-alerts-location\nALTER TABLE mobile_user_alerts\n    MODIFY geo_lng  DOUBLE         NOT NULL,\n    MODIFY geo_lat  DOUBLE         NOT NULL;\n\n-- name: create-mobile-user-alerts-user-index\nCREATE INDEX mobile_user_alerts_user_index ON mobile_user_alerts(user_id, created_at);\n\n-- name: create-mobile-user-alert-events\nCREATE TABLE IF NOT EXISTS mobile_user_alert_events\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    alert_id        INT            NOT NULL,\n    status          VARCHAR(32)    NOT NULL,\n    note            VARCHAR(1024)  NOT NULL     DEFAULT '',\n    user_id         INT            NULL,\n    created_at      DATETIME       DEFAULT NOW(),\n    PRIMARY KEY(id),\n    CONSTRAINT fk_mobile_user_alert_events_alert_id  FOREIGN KEY  (alert_id) REFERENCES mobile_user_alerts(id)\n);\n",
+	"0007_alert_notification_attempts.down.sql": "-- name: remove-alert-notification-attempts\nDROP TABLE IF EXISTS alert_notification_attempts;\n",
+	"0007_alert_notification_attempts.up.sql":   "-- name: create-alert-notification-attempts\nCREATE TABLE IF NOT EXISTS alert_notification_attempts\n(\n    id              INT            NOT NULL     AUTO_INCREMENT,\n    alert_id        INT            NOT NULL,\n    contact_id      INT            NULL,\n    channel         VARCHAR(16)    NOT NULL,\n    recipient       VARCHAR(255)   NOT NULL,\n    attempt         INT            NOT NULL,\n    status          VARCHAR(16)    NOT NULL,\n    error           VARCHAR(1024)  NOT NULL     DEFAULT '',\n    created_at      DATETIME       DEFAULT NOW(),\n    PRIMARY KEY(id),\n    CONSTRAINT fk_alert_notification_attempts_alert_id  FOREIGN KEY  (alert_id) REFERENCES mobile_user_alerts(id)\n);\n\n-- name: create-alert-notification-attempts-alert-index\nCREATE INDEX alert_notification_attempts_alert_index ON alert_notification_attempts(alert_id);\n",
+	"0008_device_ids.down.sql":                  "-- name: drop-mobile-user-tokens-device-index\nDROP INDEX mobile_user_tokens_device_index ON mobile_user_tokens;\n\n-- name: restore-mobile-user-tokens\nALTER TABLE mobile_user_tokens\n    DROP device_id;\n",
+	"0008_device_ids.up.sql":                    "-- name: alter-mobile-user-tokens\nALTER TABLE mobile_user_tokens\n    ADD device_id   VARCHAR(255)   NOT NULL     DEFAULT '';\n\n-- name: create-mobile-user-tokens-device-index\nCREATE INDEX mobile_user_tokens_device_index ON mobile_user_tokens(user_id, device_id);\n",
+	"0009_locations.down.sql":                   "-- name: restore-mobile-user-profiles-geo\nALTER TABLE mobile_user_profiles\n    ADD geo_lng     VARCHAR(255)   NULL,\n    ADD geo_lat     VARCHAR(255)   NULL;\n\n-- name: update-mobile-user-profiles-geo\nUPDATE mobile_user_profiles\n    SET geo_lng = ST_Longitude(location),\n        geo_lat = ST_Latitude(location)\n    WHERE has_location;\n\n-- name: drop-mobile-user-profiles-location\nALTER TABLE mobile_user_profiles\n    DROP INDEX mobile_user_profiles_location_index,\n    DROP location,\n    DROP has_location,\n    DROP responder;\n\n-- name: restore-mobile-user-alerts-geo\nALTER TABLE mobile_user_alerts\n    ADD geo_lng     DOUBLE         NULL,\n    ADD geo_lat     DOUBLE         NULL;\n\n-- name: update-mobile-user-alerts-geo\nUPDATE mobile_user_alerts\n    SET geo_lng = ST_Longitude(location),\n        geo_lat = ST_Latitude(location);\n\n-- name: drop-mobile-user-alerts-location\nALTER TABLE mobile_user_alerts\n    MODIFY geo_lng  DOUBLE         NOT NULL,\n    MODIFY geo_lat  DOUBLE         NOT NULL,\n    DROP INDEX mobile_user_alerts_location_index,\n    DROP location;\n",
+	"0009_locations.up.sql":                     "-- name: alter-mobile-user-alerts-location\nALTER TABLE mobile_user_alerts\n    ADD location    POINT          NULL         SRID 4326;\n\n-- name: update-mobile-user-alerts-location\nUPDATE mobile_user_alerts\n    SET location = ST_GeomFromWKB(ST_AsBinary(POINT(geo_lng, geo_lat)), 4326, 'axis-order=long-lat');\n\n-- name: alter-mobile-user-alerts-drop-geo\nALTER TABLE mobile_user_alerts\n    MODIFY location POINT          NOT NULL     SRID 4326,\n    DROP geo_lng,\n    DROP geo_lat;\n\n-- name: create-mobile-user-alerts-location-index\nCREATE SPATIAL INDEX mobile_user_alerts_location_index ON mobile_user_alerts(location);\n\n-- name: alter-mobile-user-profiles-location\nALTER TABLE mobile_user_profiles\n    ADD location    POINT          NULL         SRID 4326,\n    ADD has_location BOOLEAN       NOT NULL     DEFAULT FALSE,\n    ADD responder   BOOLEAN        NOT NULL     DEFAULT FALSE;\n\n-- name: update-mobile-user-profiles-location\nUPDATE mobile_user_profiles\n    SET location = ST_GeomFromWKB(ST_AsBinary(POINT(geo_lng, geo_lat)), 4326, 'axis-order=long-lat'),\n        has_location = TRUE\n    WHERE geo_lat REGEXP '^-?([0-8]?[0-9](\\\\.[0-9]+)?|90(\\\\.0+)?)$'\n      AND geo_lng REGEXP '^-?((1[0-7][0-9]|[0-9]?[0-9])(\\\\.[0-9]+)?|180(\\\\.0+)?)$';\n\n-- name: update-mobile-user-profiles-unknown-location\nUPDATE mobile_user_profiles\n    SET location = ST_GeomFromText('POINT(0 0)', 4326)\n    WHERE location IS NULL;\n\n-- name: alter-mobile-user-profiles-drop-geo\nALTER TABLE mobile_user_profiles\n    MODIFY location POINT          NOT NULL     SRID 4326,\n    DROP geo_lng,\n    DROP geo_lat;\n\n-- name: create-mobile-user-profiles-location-index\nCREATE SPATIAL INDEX mobile_user_profiles_location_index ON mobile_user_profiles(location);\n",
+	"0010_alert_escalation.down.sql":            "-- name: drop-mobile-user-alerts-escalation-index\nDROP INDEX mobile_user_alerts_escalation_index ON mobile_user_alerts;\n\n-- name: restore-mobile-user-alerts-escalation\nALTER TABLE mobile_user_alerts\n    DROP escalation_level,\n    DROP escalate_at;\n",
+	"0010_alert_escalation.up.sql":              "-- name: alter-mobile-user-alerts-escalation\nALTER TABLE mobile_user_alerts\n    ADD escalation_level INT       NOT NULL     DEFAULT 0,\n    ADD escalate_at     DATETIME   NULL;\n\n-- name: update-mobile-user-alerts-escalation\nUPDATE mobile_user_alerts\n    SET escalation_level = 1\n    WHERE status = 'raised';\n\n-- name: create-mobile-user-alerts-escalation-index\nCREATE INDEX mobile_user_alerts_escalation_index ON mobile_user_alerts(status, escalate_at);\n",
+	"0011_admin_auth.down.sql":                  "-- name: restore-user-accounts-admin-auth\nALTER TABLE user_accounts\n    MODIFY is_admin BOOLEAN        DEFAULT TRUE,\n    DROP role,\n    DROP failed_logins,\n    DROP locked_until;\n",
+	"0011_admin_auth.up.sql":                    "-- name: update-user-accounts-is-admin\nUPDATE user_accounts SET is_admin = FALSE WHERE is_admin IS NULL;\n\n-- name: alter-user-accounts-admin-auth\nALTER TABLE user_accounts\n    MODIFY is_admin BOOLEAN        NOT NULL     DEFAULT FALSE,\n    ADD role        VARCHAR(32)    NOT NULL     DEFAULT 'viewer',\n    ADD failed_logins INT          NOT NULL     DEFAULT 0,\n    ADD locked_until DATETIME      NULL;\n",
+	"0012_mobile_user_suspension.down.sql":      "-- name: restore-mobile-users-suspension\nALTER TABLE mobile_users\n    DROP suspended_at,\n    DROP sessions_revoked_at;\n",
+	"0012_mobile_user_suspension.up.sql":        "-- name: alter-mobile-users-suspension\nALTER TABLE mobile_users\n    ADD suspended_at DATETIME      NULL,\n    ADD sessions_revoked_at DATETIME NULL;\n",
+	"0013_user_contacts_unique_msisdn.down.sql": "-- name: restore-contacts-unique-msisdn\nALTER TABLE mobile_user_contacts\n    DROP INDEX uq_mobile_user_contacts_user_msisdn,\n    DROP updated_at;\n",
+	"0013_user_contacts_unique_msisdn.up.sql":   "-- Duplicates are only found by exact msisdn, so cmd/normalize-msisdns must\n-- be run before this migration to catch numbers written in different forms.\n\n-- name: remove-duplicate-contacts\nDELETE c FROM mobile_user_contacts AS c\n    JOIN mobile_user_contacts AS d ON d.user_id = c.user_id AND d.msisdn = c.msisdn AND d.id < c.id;\n\n-- name: alter-contacts-unique-msisdn\nALTER TABLE mobile_user_contacts\n    ADD updated_at  DATETIME       NULL,\n    ADD CONSTRAINT uq_mobile_user_contacts_user_msisdn UNIQUE (user_id, msisdn);\n",
+	"0014_user_contacts_priority.down.sql":      "-- name: restore-contacts-priority\nALTER TABLE mobile_user_contacts\n    DROP priority,\n    DROP relationship;\n",
+	"0014_user_contacts_priority.up.sql":        "-- name: alter-contacts-priority\nALTER TABLE mobile_user_contacts\n    ADD priority        INT            NOT NULL     DEFAULT 0,\n    ADD relationship    VARCHAR(32)    NOT NULL     DEFAULT '';\n",
+	"0015_user_contacts_consent.down.sql":       "-- name: restore-contacts-consent\nALTER TABLE mobile_user_contacts\n    DROP status,\n    DROP invited_at,\n    DROP responded_at;\n",
+	"0015_user_contacts_consent.up.sql":         "-- name: alter-contacts-consent\nALTER TABLE mobile_user_contacts\n    ADD status          VARCHAR(16)    NOT NULL     DEFAULT 'pending',\n    ADD invited_at      DATETIME       NULL,\n    ADD responded_at    DATETIME       NULL;\n",
+	"0016_contact_declines.down.sql":            "-- name: remove-contact-declines\nDROP TABLE IF EXISTS mobile_user_contact_declines;\n",
+	"0016_contact_declines.up.sql":              "-- name: create-contact-declines\nCREATE TABLE IF NOT EXISTS mobile_user_contact_declines\n(\n    user_id         INT            NOT NULL,\n    msisdn          VARCHAR(255)   NOT NULL,\n    declined_at     DATETIME       DEFAULT NOW(),\n    PRIMARY KEY(user_id, msisdn),\n    CONSTRAINT fk_mobile_user_contact_declines_user_id  FOREIGN KEY  (user_id) REFERENCES mobile_users(id)\n);\n\n-- name: backfill-contact-declines\nINSERT IGNORE INTO mobile_user_contact_declines (user_id, msisdn, declined_at)\n    SELECT user_id, msisdn, COALESCE(responded_at, NOW()) FROM mobile_user_contacts WHERE status = 'declined';\n",
+}
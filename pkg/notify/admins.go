@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// AdminsConfig holds the settings of an AdminsNotifier
+type AdminsConfig struct {
+	// Msisdns are the phone numbers of the administrators notified
+	Msisdns []string
+
+	// Locale is the locale of messages. It defaults to DefaultLocale.
+	Locale string
+
+	// LocationURL is the format of links to the location of alerts. It
+	// defaults to DefaultLocationURL.
+	LocationURL string
+}
+
+// AdminsNotifier is an AlertNotifier that sends an SMS to administrators.
+// Every message sent is recorded as a notification attempt.
+type AdminsNotifier struct {
+	users    UserStore
+	profiles ProfileStore
+	attempts AttemptStore
+	sender   sms.Sender
+	cfg      AdminsConfig
+	logger   *zap.Logger
+}
+
+// NewAdminsNotifier returns a pointer to a value of AdminsNotifier
+func NewAdminsNotifier(
+	users UserStore,
+	profiles ProfileStore,
+	attempts AttemptStore,
+	sender sms.Sender,
+	cfg AdminsConfig,
+	logger *zap.Logger,
+) *AdminsNotifier {
+	if _, ok := adminTemplates[cfg.Locale]; !ok {
+		cfg.Locale = DefaultLocale
+	}
+
+	if len(cfg.LocationURL) == 0 {
+		cfg.LocationURL = DefaultLocationURL
+	}
+
+	return &AdminsNotifier{
+		users:    users,
+		profiles: profiles,
+		attempts: attempts,
+		sender:   sender,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// AlertRaised sends an SMS about alert to every administrator
+func (an *AdminsNotifier) AlertRaised(ctx context.Context, alert *db.Alert) error {
+	if len(an.cfg.Msisdns) == 0 {
+		an.logger.Warn("no administrators to notify about alert", zap.Int("alertId", alert.ID))
+		return nil
+	}
+
+	name, err := userName(ctx, an.profiles, an.users, alert.UserID)
+	if err != nil {
+		return err
+	}
+
+	body := adminMessage(an.cfg.Locale, name, locationLink(an.cfg.LocationURL, alert), alert)
+
+	failed := 0
+	for _, msisdn := range an.cfg.Msisdns {
+		record := &db.NotificationAttempt{
+			AlertID:   alert.ID,
+			Channel:   ChannelSMS,
+			Recipient: msisdn,
+			Attempt:   1,
+			Status:    db.NotificationStatusSent,
+		}
+
+		err := an.sender.Send(msisdn, body)
+		if err != nil {
+			failed++
+			record.Status = db.NotificationStatusFailed
+			record.Error = err.Error()
+
+			an.logger.Warn("failed sending alert escalation to administrator", zap.Int("alertId", alert.ID), zap.Error(err))
+		}
+
+		if _, rerr := an.attempts.Create(ctx, record); rerr != nil {
+			an.logger.Error("failed recording notification attempt", zap.Int("alertId", alert.ID), zap.Error(rerr))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed notifying %d of %d administrators", failed, len(an.cfg.Msisdns))
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"go.uber.org/zap"
+)
+
+func TestAdminsNotifier_AlertRaised_ShouldTextEveryAdministrator(t *testing.T) {
+	stores := &fakeStores{
+		user:    &db.MobileUser{ID: 7, Msisdn: "+233244000000"},
+		profile: &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+	}
+	sender := sms.NewFakeSender()
+	sender.FailNext(1, errors.New("gateway unavailable"))
+
+	notifier := NewAdminsNotifier(stores, stores, stores, sender, AdminsConfig{
+		Msisdns: []string{"+233200000001", "+233200000002"},
+	}, zap.NewNop())
+
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err == nil {
+		t.Fatalf("expected an error for the failed message")
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].To != "+233200000002" || !strings.Contains(messages[0].Body, "Kofi Mensah raised a medical alert (#42)") {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+
+	if len(stores.attempts) != 2 || stores.attempts[0].Status != db.NotificationStatusFailed || stores.attempts[1].Status != db.NotificationStatusSent {
+		t.Fatalf("expected a failed and a sent attempt, got %+v", stores.attempts)
+	}
+}
@@ -0,0 +1,415 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/push"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// ChannelSMS is the channel of notifications sent via SMS
+const ChannelSMS = "sms"
+
+// DefaultLocationURL is the link to the location of an alert included in
+// notifications. It is given the latitude and longitude of the alert.
+const DefaultLocationURL = "https://maps.google.com/?q=%s,%s"
+
+// ContactStore returns the emergency contacts of users. It is implemented
+// by *db.UserContactsRepo.
+type ContactStore interface {
+	GetUserContacts(ctx context.Context, userID int) ([]*db.UserContact, error)
+}
+
+// UserStore returns mobile users. It is implemented by *db.MobileUsersRepo.
+type UserStore interface {
+	GetByID(ctx context.Context, id int) (*db.MobileUser, error)
+	GetByPhoneNumber(ctx context.Context, phoneNumber string) (*db.MobileUser, error)
+}
+
+// ProfileStore returns the profiles of mobile users. It is implemented by
+// *db.UserProfilesRepo.
+type ProfileStore interface {
+	GetByUserID(ctx context.Context, userID int) (*db.UserProfile, error)
+}
+
+// AttemptStore records notification attempts. It is implemented by
+// *db.NotificationAttemptsRepo.
+type AttemptStore interface {
+	Create(ctx context.Context, attempt *db.NotificationAttempt) (*db.NotificationAttempt, error)
+}
+
+// Pusher delivers push notifications to the devices of users. It is
+// implemented by *push.Service.
+type Pusher interface {
+	SendToUsers(ctx context.Context, userIDs []int, n *push.Notification) (*push.Result, error)
+}
+
+// Clock waits for time to pass. Tests replace it with a fake.
+type Clock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Fallback policies decide which contacts who have not responded to their
+// invitation yet are alerted. Contacts who declined are never alerted.
+const (
+	// FallbackNone alerts accepted contacts only
+	FallbackNone = "none"
+
+	// FallbackNoneAccepted alerts pending contacts
+	// when the user has no accepted contacts
+	FallbackNoneAccepted = "none_accepted"
+
+	// FallbackPending alerts pending contacts along with accepted ones
+	FallbackPending = "pending"
+)
+
+// ContactsConfig holds the settings of a ContactsNotifier
+type ContactsConfig struct {
+	// Locale is the locale of messages sent to numbers of regions without
+	// a locale of their own. It defaults to DefaultLocale.
+	Locale string
+
+	// LocationURL is the format of links to the location of alerts. It
+	// defaults to DefaultLocationURL.
+	LocationURL string
+
+	// MaxAttempts is the number of times sending a message to a contact
+	// is attempted before giving up
+	MaxAttempts int
+
+	// Backoff is the time to wait before the second attempt. It doubles
+	// with every further attempt, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Fallback is the policy deciding whether pending contacts are
+	// alerted. It defaults to FallbackNoneAccepted.
+	Fallback string
+}
+
+// ContactsNotifier is an AlertNotifier that sends an SMS to each of the
+// emergency contacts of the user who raised an alert. Every attempt to send
+// a message is recorded, and failed attempts are retried with backoff.
+// Contacts who use the app themselves also get a push notification.
+type ContactsNotifier struct {
+	contacts ContactStore
+	users    UserStore
+	profiles ProfileStore
+	attempts AttemptStore
+	sender   sms.Sender
+	pusher   Pusher
+	cfg      ContactsConfig
+	logger   *zap.Logger
+	clock    Clock
+}
+
+// NewContactsNotifier returns a pointer to a value of ContactsNotifier.
+// Push notifications are not sent when pusher is nil.
+func NewContactsNotifier(
+	contacts ContactStore,
+	users UserStore,
+	profiles ProfileStore,
+	attempts AttemptStore,
+	sender sms.Sender,
+	pusher Pusher,
+	cfg ContactsConfig,
+	logger *zap.Logger,
+) *ContactsNotifier {
+	if len(cfg.Locale) == 0 {
+		cfg.Locale = DefaultLocale
+	}
+
+	if len(cfg.LocationURL) == 0 {
+		cfg.LocationURL = DefaultLocationURL
+	}
+
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	if len(cfg.Fallback) == 0 {
+		cfg.Fallback = FallbackNoneAccepted
+	}
+
+	return &ContactsNotifier{
+		contacts: contacts,
+		users:    users,
+		profiles: profiles,
+		attempts: attempts,
+		sender:   sender,
+		pusher:   pusher,
+		cfg:      cfg,
+		logger:   logger,
+		clock:    systemClock{},
+	}
+}
+
+// AlertRaised sends an SMS to the emergency contacts of the user who raised
+// alert who accepted to be alerted, and to pending contacts as the fallback
+// policy allows. Contacts are notified in order of priority: contacts of
+// the same priority concurrently, and those of the next priority once each
+// of them was attempted, while failed attempts are retried alongside.
+// AlertRaised returns once every contact was notified or every attempt to
+// notify them failed.
+func (cn *ContactsNotifier) AlertRaised(ctx context.Context, alert *db.Alert) error {
+	contacts, err := cn.contacts.GetUserContacts(ctx, alert.UserID)
+	if err != nil {
+		return err
+	}
+
+	contacts = cn.recipients(contacts)
+
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	name, err := userName(ctx, cn.profiles, cn.users, alert.UserID)
+	if err != nil {
+		return err
+	}
+
+	location := locationLink(cn.cfg.LocationURL, alert)
+
+	if cn.pusher != nil {
+		cn.pushToContacts(ctx, alert, contacts, alertMessage(localeFor("", cn.cfg.Locale), name, location, alert))
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+
+	for _, tier := range priorityTiers(contacts) {
+		var attempted sync.WaitGroup
+		for _, contact := range tier {
+			wg.Add(1)
+			attempted.Add(1)
+			go func(contact *db.UserContact) {
+				defer wg.Done()
+
+				body := alertMessage(localeFor(contact.Msisdn, cn.cfg.Locale), name, location, alert)
+				if !cn.deliver(ctx, alert, contact, body, attempted.Done) {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}(contact)
+		}
+
+		attempted.Wait()
+	}
+
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("failed notifying %d of %d contacts", failed, len(contacts))
+	}
+
+	return nil
+}
+
+// recipients returns the contacts to alert, keeping their order
+func (cn *ContactsNotifier) recipients(contacts []*db.UserContact) []*db.UserContact {
+	alertPending := cn.cfg.Fallback == FallbackPending
+	if cn.cfg.Fallback == FallbackNoneAccepted {
+		alertPending = true
+		for _, contact := range contacts {
+			if contact.Status == db.ContactStatusAccepted {
+				alertPending = false
+				break
+			}
+		}
+	}
+
+	var recipients []*db.UserContact
+	for _, contact := range contacts {
+		if contact.Status == db.ContactStatusAccepted || (alertPending && contact.Status == db.ContactStatusPending) {
+			recipients = append(recipients, contact)
+		}
+	}
+
+	return recipients
+}
+
+// priorityTiers groups contacts by priority, from the highest to the lowest.
+// Priority 1 is the highest, and contacts without a priority come last.
+func priorityTiers(contacts []*db.UserContact) [][]*db.UserContact {
+	sorted := make([]*db.UserContact, len(contacts))
+	copy(sorted, contacts)
+
+	rank := func(contact *db.UserContact) int {
+		if contact.Priority <= 0 {
+			return int(^uint(0) >> 1)
+		}
+		return contact.Priority
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+
+	var tiers [][]*db.UserContact
+	for i, contact := range sorted {
+		if i == 0 || rank(contact) != rank(sorted[i-1]) {
+			tiers = append(tiers, nil)
+		}
+		tiers[len(tiers)-1] = append(tiers[len(tiers)-1], contact)
+	}
+
+	return tiers
+}
+
+// deliver sends body to contact until it succeeds or runs out of attempts,
+// recording every attempt, and reports whether it succeeded. attempted is
+// called once the first attempt is over. Retries are given up when ctx is
+// done.
+func (cn *ContactsNotifier) deliver(ctx context.Context, alert *db.Alert, contact *db.UserContact, body string, attempted func()) bool {
+	backoff := cn.cfg.Backoff
+
+	for attempt := 1; attempt <= cn.cfg.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-cn.clock.After(backoff):
+			}
+
+			backoff *= 2
+			if cn.cfg.MaxBackoff > 0 && backoff > cn.cfg.MaxBackoff {
+				backoff = cn.cfg.MaxBackoff
+			}
+		}
+
+		record := &db.NotificationAttempt{
+			AlertID:   alert.ID,
+			Channel:   ChannelSMS,
+			Recipient: contact.Msisdn,
+			Attempt:   attempt,
+			Status:    db.NotificationStatusSent,
+		}
+		record.ContactID.Int64, record.ContactID.Valid = int64(contact.ID), true
+
+		err := cn.sender.Send(contact.Msisdn, body)
+		if err != nil {
+			record.Status = db.NotificationStatusFailed
+			record.Error = err.Error()
+
+			cn.logger.Warn("failed sending alert notification",
+				zap.Int("alertId", alert.ID),
+				zap.Int("contactId", contact.ID),
+				zap.Int("attempt", attempt),
+				zap.Error(err),
+			)
+		}
+
+		if _, rerr := cn.attempts.Create(ctx, record); rerr != nil {
+			cn.logger.Error("failed recording notification attempt", zap.Int("alertId", alert.ID), zap.Error(rerr))
+		}
+
+		if attempt == 1 {
+			attempted()
+		}
+
+		if err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pushToContacts sends a push notification to the devices of the contacts
+// who use the app. Push notifications complement the SMS messages contacts
+// get anyway, so failures are only logged.
+func (cn *ContactsNotifier) pushToContacts(ctx context.Context, alert *db.Alert, contacts []*db.UserContact, body string) {
+	var userIDs []int
+	for _, contact := range contacts {
+		user, err := cn.users.GetByPhoneNumber(ctx, contact.Msisdn)
+		if err != nil {
+			cn.logger.Error("failed fetching contact's mobile user", zap.Int("contactId", contact.ID), zap.Error(err))
+			continue
+		}
+
+		if user != nil && user.ID != alert.UserID {
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+
+	if len(userIDs) == 0 {
+		return
+	}
+
+	result, err := cn.pusher.SendToUsers(ctx, userIDs, alertNotification(alert, body))
+	if err != nil {
+		cn.logger.Error("failed sending alert push notifications", zap.Int("alertId", alert.ID), zap.Error(err))
+		return
+	}
+
+	cn.logger.Info("sent alert push notifications",
+		zap.Int("alertId", alert.ID),
+		zap.Int("sent", result.Sent),
+		zap.Int("failed", result.Failed),
+	)
+}
+
+// userName returns the name contacts know the user with the specified ID by:
+// the full name on their profile or, without one, their phone number
+func userName(ctx context.Context, profiles ProfileStore, users UserStore, userID int) (string, error) {
+	profile, err := profiles.GetByUserID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if profile != nil && len(profile.Fullname) > 0 {
+		return profile.Fullname, nil
+	}
+
+	user, err := users.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if user == nil {
+		return "", fmt.Errorf("mobile user %d does not exist", userID)
+	}
+
+	return user.Msisdn, nil
+}
+
+// locationLink returns the link to the location of alert
+// formatted with format
+func locationLink(format string, alert *db.Alert) string {
+	return fmt.Sprintf(
+		format,
+		strconv.FormatFloat(alert.Lat, 'f', -1, 64),
+		strconv.FormatFloat(alert.Lng, 'f', -1, 64),
+	)
+}
+
+// alertNotification returns the push notification about alert with body.
+// Notifications about the same alert replace each other on devices.
+func alertNotification(alert *db.Alert, body string) *push.Notification {
+	alertID := strconv.Itoa(alert.ID)
+	return &push.Notification{
+		Title:       "Hoodcops",
+		Body:        body,
+		Data:        map[string]string{"type": "alert", "alertId": alertID},
+		Priority:    push.PriorityHigh,
+		CollapseKey: "alert-" + alertID,
+		TTL:         time.Hour,
+	}
+}
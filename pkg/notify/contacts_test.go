@@ -0,0 +1,353 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/push"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"go.uber.org/zap"
+)
+
+type fakeStores struct {
+	mu       sync.Mutex
+	contacts []*db.UserContact
+	user     *db.MobileUser
+	profile  *db.UserProfile
+	attempts []db.NotificationAttempt
+	appUsers []*db.MobileUser
+}
+
+type recordingPusher struct {
+	userIDs []int
+	n       *push.Notification
+}
+
+func (rp *recordingPusher) SendToUsers(ctx context.Context, userIDs []int, n *push.Notification) (*push.Result, error) {
+	rp.userIDs, rp.n = userIDs, n
+	return &push.Result{Sent: len(userIDs)}, nil
+}
+
+func (fs *fakeStores) GetUserContacts(ctx context.Context, userID int) ([]*db.UserContact, error) {
+	return fs.contacts, nil
+}
+
+func (fs *fakeStores) GetByID(ctx context.Context, id int) (*db.MobileUser, error) {
+	return fs.user, nil
+}
+
+func (fs *fakeStores) GetByPhoneNumber(ctx context.Context, phoneNumber string) (*db.MobileUser, error) {
+	for _, user := range fs.appUsers {
+		if user.Msisdn == phoneNumber {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (fs *fakeStores) GetByUserID(ctx context.Context, userID int) (*db.UserProfile, error) {
+	return fs.profile, nil
+}
+
+func (fs *fakeStores) Create(ctx context.Context, attempt *db.NotificationAttempt) (*db.NotificationAttempt, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.attempts = append(fs.attempts, *attempt)
+	return attempt, nil
+}
+
+func newTestContactsNotifier(stores *fakeStores, sender sms.Sender) (*ContactsNotifier, *[]time.Duration) {
+	notifier := NewContactsNotifier(stores, stores, stores, stores, sender, nil, ContactsConfig{
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+	}, zap.NewNop())
+
+	clock := &fakeClock{}
+	notifier.clock = clock
+
+	return notifier, &clock.waits
+}
+
+// fakeClock records how long it is waited for and lets waits end at once,
+// or never when stopped is set
+type fakeClock struct {
+	mu      sync.Mutex
+	waits   []time.Duration
+	stopped bool
+}
+
+func (fc *fakeClock) After(d time.Duration) <-chan time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.waits = append(fc.waits, d)
+	if fc.stopped {
+		return nil
+	}
+
+	c := make(chan time.Time, 1)
+	c <- time.Now()
+	return c
+}
+
+var testAlert = &db.Alert{ID: 42, UserID: 7, Coordinate: db.Coordinate{Lat: 5.6037, Lng: -0.187}, Category: db.AlertCategoryMedical}
+
+func TestContactsNotifier_AlertRaised_ShouldSendLocalizedMessages(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{
+			{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusAccepted},
+			{ID: 2, UserID: 7, Msisdn: "+2250701234567", Status: db.ContactStatusAccepted},
+		},
+		user:    &db.MobileUser{ID: 7, Msisdn: "+233244000000"},
+		profile: &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+	}
+	sender := sms.NewFakeSender()
+
+	notifier, _ := newTestContactsNotifier(stores, sender)
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	bodies := map[string]string{}
+	for _, msg := range sender.Messages() {
+		bodies[msg.To] = msg.Body
+	}
+
+	en := bodies["+233200662782"]
+	if !strings.Contains(en, "Kofi Mensah raised a medical alert") || !strings.Contains(en, "https://maps.google.com/?q=5.6037,-0.187") {
+		t.Fatalf("unexpected english message %q", en)
+	}
+
+	fr := bodies["+2250701234567"]
+	if !strings.Contains(fr, "Kofi Mensah a lancé une alerte médicale") {
+		t.Fatalf("unexpected french message %q", fr)
+	}
+
+	if len(stores.attempts) != 2 || stores.attempts[0].Status != db.NotificationStatusSent {
+		t.Fatalf("expected 2 successful attempts, got %+v", stores.attempts)
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldNotifyInPriorityOrder(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{
+			{ID: 1, UserID: 7, Msisdn: "+233200000001", Status: db.ContactStatusAccepted},
+			{ID: 2, UserID: 7, Msisdn: "+233200000002", Status: db.ContactStatusAccepted, Priority: 2},
+			{ID: 3, UserID: 7, Msisdn: "+233200000003", Status: db.ContactStatusAccepted, Priority: 1},
+			{ID: 4, UserID: 7, Msisdn: "+233200000004", Status: db.ContactStatusAccepted, Priority: 2},
+			{ID: 5, UserID: 7, Msisdn: "+233200000005", Status: db.ContactStatusAccepted, Priority: 1},
+		},
+		profile: &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+	}
+	sender := sms.NewFakeSender()
+
+	notifier, _ := newTestContactsNotifier(stores, sender)
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tiers := map[string]int{
+		"+233200000003": 0, "+233200000005": 0,
+		"+233200000002": 1, "+233200000004": 1,
+		"+233200000001": 2,
+	}
+
+	messages := sender.Messages()
+	if len(messages) != len(tiers) {
+		t.Fatalf("expected %d messages, got %+v", len(tiers), messages)
+	}
+
+	for i := 1; i < len(messages); i++ {
+		if tiers[messages[i].To] < tiers[messages[i-1].To] {
+			t.Fatalf("expected contacts to be notified in order of priority, got %+v", messages)
+		}
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldFallBackToPhoneNumber(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusAccepted}},
+		user:     &db.MobileUser{ID: 7, Msisdn: "+233244000000"},
+	}
+	sender := sms.NewFakeSender()
+
+	notifier, _ := newTestContactsNotifier(stores, sender)
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || !strings.HasPrefix(messages[0].Body, "HOODCOPS ALERT: +233244000000 raised") {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldRetryWithBackoff(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusAccepted}},
+		profile:  &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+	}
+	sender := sms.NewFakeSender()
+	sender.FailNext(2, errors.New("gateway timeout"))
+
+	notifier, waits := newTestContactsNotifier(stores, sender)
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(sender.Messages()) != 1 {
+		t.Fatalf("expected message to be sent on the third attempt, got %+v", sender.Messages())
+	}
+
+	if len(*waits) != 2 || (*waits)[0] != time.Second || (*waits)[1] != 2*time.Second {
+		t.Fatalf("expected backoffs of 1s and 2s, got %v", *waits)
+	}
+
+	statuses := []string{}
+	for _, attempt := range stores.attempts {
+		statuses = append(statuses, attempt.Status)
+	}
+
+	if strings.Join(statuses, ",") != "failed,failed,sent" || stores.attempts[0].Error != "gateway timeout" {
+		t.Fatalf("unexpected attempts %+v", stores.attempts)
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldFailWhenAttemptsRunOut(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusAccepted}},
+		profile:  &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+	}
+	sender := sms.NewFakeSender()
+	sender.FailNext(3, errors.New("gateway timeout"))
+
+	notifier, _ := newTestContactsNotifier(stores, sender)
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if len(stores.attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(stores.attempts))
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldStopRetryingWhenContextIsDone(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusAccepted}},
+		profile:  &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+	}
+	sender := sms.NewFakeSender()
+	sender.FailNext(1, errors.New("gateway timeout"))
+
+	notifier, _ := newTestContactsNotifier(stores, sender)
+	notifier.clock = &fakeClock{stopped: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- notifier.AlertRaised(ctx, testAlert)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected notifying to stop when the context is done")
+	}
+
+	if len(stores.attempts) != 1 {
+		t.Fatalf("expected 1 attempt, got %d", len(stores.attempts))
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldPushToContactsUsingTheApp(t *testing.T) {
+	stores := &fakeStores{
+		contacts: []*db.UserContact{
+			{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusAccepted},
+			{ID: 2, UserID: 7, Msisdn: "+233244111111", Status: db.ContactStatusAccepted},
+		},
+		profile:  &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+		appUsers: []*db.MobileUser{{ID: 9, Msisdn: "+233200662782"}},
+	}
+	pusher := &recordingPusher{}
+
+	notifier, _ := newTestContactsNotifier(stores, sms.NewFakeSender())
+	notifier.pusher = pusher
+
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(pusher.userIDs) != 1 || pusher.userIDs[0] != 9 {
+		t.Fatalf("expected push to user 9, got %v", pusher.userIDs)
+	}
+
+	if pusher.n.Priority != push.PriorityHigh || pusher.n.CollapseKey != "alert-42" || pusher.n.Data["alertId"] != "42" {
+		t.Fatalf("unexpected notification %+v", pusher.n)
+	}
+}
+
+func TestContactsNotifier_AlertRaised_ShouldApplyFallbackPolicy(t *testing.T) {
+	pending := &db.UserContact{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusPending}
+	accepted := &db.UserContact{ID: 2, UserID: 7, Msisdn: "+233244111111", Status: db.ContactStatusAccepted}
+	declined := &db.UserContact{ID: 3, UserID: 7, Msisdn: "+233244222222", Status: db.ContactStatusDeclined}
+
+	tests := []struct {
+		fallback string
+		contacts []*db.UserContact
+		expected []string
+	}{
+		{FallbackNone, []*db.UserContact{pending, declined}, nil},
+		{FallbackNoneAccepted, []*db.UserContact{pending, declined}, []string{pending.Msisdn}},
+		{FallbackNoneAccepted, []*db.UserContact{pending, accepted, declined}, []string{accepted.Msisdn}},
+		{FallbackPending, []*db.UserContact{pending, accepted, declined}, []string{pending.Msisdn, accepted.Msisdn}},
+	}
+
+	for _, test := range tests {
+		stores := &fakeStores{
+			contacts: test.contacts,
+			profile:  &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"},
+		}
+		sender := sms.NewFakeSender()
+
+		notifier, _ := newTestContactsNotifier(stores, sender)
+		notifier.cfg.Fallback = test.fallback
+
+		err := notifier.AlertRaised(context.Background(), testAlert)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		recipients := map[string]bool{}
+		for _, message := range sender.Messages() {
+			recipients[message.To] = true
+		}
+
+		if len(recipients) != len(test.expected) {
+			t.Fatalf("expected %v to be alerted with fallback %s, got %v", test.expected, test.fallback, recipients)
+		}
+
+		for _, msisdn := range test.expected {
+			if !recipients[msisdn] {
+				t.Fatalf("expected %v to be alerted with fallback %s, got %v", test.expected, test.fallback, recipients)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/phone"
+	"github.com/hoodcops/xcore/pkg/ratelimit"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// Inviter asks people a user added as emergency contacts whether they
+// agree to be alerted when the user raises an alert
+type Inviter interface {
+	Invite(ctx context.Context, userID int, contacts []*db.UserContact) error
+}
+
+// InviteStore records the invitations sent to contacts. It is implemented
+// by *db.UserContactsRepo.
+type InviteStore interface {
+	MarkInvited(ctx context.Context, id int, at time.Time) error
+}
+
+// InviteSigner signs the links contacts follow to respond to their
+// invitations. It is implemented by *auth.TokenService.
+type InviteSigner interface {
+	InviteToken(contactID int, invitedAt time.Time) string
+}
+
+// InvitesConfig holds the settings of an SMSInviter
+type InvitesConfig struct {
+	// Locale is the locale of messages sent to numbers of regions without
+	// a locale of their own. It defaults to DefaultLocale.
+	Locale string
+
+	// InviteURL is the format of links to invitations. It is given
+	// the token of the invitation.
+	InviteURL string
+}
+
+// SMSInviter is an Inviter that sends contacts an SMS with a signed link
+// to a page where they accept or decline to be an emergency contact,
+// without having to install the app. Invitations go through the same
+// limits and allowed regions as other SMS messages, and through a limit
+// on the invitations each user sends, so that uploading contacts cannot
+// be used to send paid messages to numbers at will.
+type SMSInviter struct {
+	invites     InviteStore
+	users       UserStore
+	profiles    ProfileStore
+	sender      sms.Sender
+	signer      InviteSigner
+	limiter     *ratelimit.SMSLimiter
+	userLimiter *ratelimit.Limiter
+	cfg         InvitesConfig
+	logger      *zap.Logger
+	now         func() time.Time
+}
+
+// NewSMSInviter returns a pointer to a value of SMSInviter
+func NewSMSInviter(
+	invites InviteStore,
+	users UserStore,
+	profiles ProfileStore,
+	sender sms.Sender,
+	signer InviteSigner,
+	limiter *ratelimit.SMSLimiter,
+	userLimiter *ratelimit.Limiter,
+	cfg InvitesConfig,
+	logger *zap.Logger,
+) *SMSInviter {
+	if len(cfg.Locale) == 0 {
+		cfg.Locale = DefaultLocale
+	}
+
+	return &SMSInviter{
+		invites:     invites,
+		users:       users,
+		profiles:    profiles,
+		sender:      sender,
+		signer:      signer,
+		limiter:     limiter,
+		userLimiter: userLimiter,
+		cfg:         cfg,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// Invite sends an invitation to each of the contacts the user with the
+// specified ID added. Contacts who already responded to an invitation are
+// skipped, and so are those a rate limit or the allowed regions keep from
+// being sent an SMS. Inviting a contact again invalidates the link they
+// were sent before.
+func (si *SMSInviter) Invite(ctx context.Context, userID int, contacts []*db.UserContact) error {
+	name, err := userName(ctx, si.profiles, si.users, userID)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, contact := range contacts {
+		if contact.Status != db.ContactStatusPending {
+			continue
+		}
+
+		err := si.userLimiter.Allow(ctx, ratelimit.Request{Subject: strconv.Itoa(userID)})
+		if err == nil {
+			err = si.limiter.Allow(ctx, ratelimit.SMSRequest{Msisdn: phone.Number(contact.Msisdn)})
+		}
+
+		if _, ok := err.(*ratelimit.Error); ok || err == ratelimit.ErrRegionNotAllowed {
+			failed++
+			si.logger.Warn("contact invitation denied", zap.Int("contactId", contact.ID), zap.Error(err))
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// invitations are recorded to the second, and so are the
+		// times their tokens are signed with
+		invitedAt := si.now().Truncate(time.Second)
+		err = si.invites.MarkInvited(ctx, contact.ID, invitedAt)
+		if err != nil {
+			return err
+		}
+
+		link := fmt.Sprintf(si.cfg.InviteURL, si.signer.InviteToken(contact.ID, invitedAt))
+		err = si.sender.Send(contact.Msisdn, inviteMessage(localeFor(contact.Msisdn, si.cfg.Locale), name, link))
+		if err != nil {
+			failed++
+			si.logger.Warn("failed sending contact invitation", zap.Int("contactId", contact.ID), zap.Error(err))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed inviting %d of %d contacts", failed, len(contacts))
+	}
+
+	return nil
+}
+
+// LogInviter is an Inviter that writes invitations to a log instead of
+// sending them. It is meant to be used when no invitation links can be
+// made, e.g. during development.
+type LogInviter struct {
+	logger *zap.Logger
+}
+
+// NewLogInviter returns a pointer to a value of LogInviter
+func NewLogInviter(logger *zap.Logger) *LogInviter {
+	return &LogInviter{
+		logger: logger,
+	}
+}
+
+// Invite logs the contacts that would have been invited
+func (li *LogInviter) Invite(ctx context.Context, userID int, contacts []*db.UserContact) error {
+	for _, contact := range contacts {
+		li.logger.Info("contact invitation",
+			zap.Int("userId", userID),
+			zap.Int("contactId", contact.ID),
+			zap.String("status", contact.Status),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/ratelimit"
+	"github.com/hoodcops/xcore/pkg/sms"
+	"go.uber.org/zap"
+)
+
+type fakeInvites struct {
+	invited map[int]time.Time
+}
+
+func (fi *fakeInvites) MarkInvited(ctx context.Context, id int, at time.Time) error {
+	fi.invited[id] = at
+	return nil
+}
+
+type fakeSigner struct{}
+
+func (fakeSigner) InviteToken(contactID int, invitedAt time.Time) string {
+	return strconv.Itoa(contactID) + "." + strconv.FormatInt(invitedAt.Unix(), 10)
+}
+
+func newTestSMSInviter(smsCfg ratelimit.SMSConfig, perUser ratelimit.Bucket) (*SMSInviter, *fakeInvites, *sms.FakeSender) {
+	stores := &fakeStores{profile: &db.UserProfile{UserID: 7, Fullname: "Kofi Mensah"}}
+	invites := &fakeInvites{invited: map[int]time.Time{}}
+	sender := sms.NewFakeSender()
+	limits := ratelimit.NewMemoryStore()
+
+	inviter := NewSMSInviter(
+		invites,
+		stores,
+		stores,
+		sender,
+		fakeSigner{},
+		ratelimit.NewSMSLimiter(limits, smsCfg),
+		ratelimit.NewLimiter(limits, "invite", ratelimit.LimiterConfig{Subject: ratelimit.LimitUser, PerSubject: perUser}),
+		InvitesConfig{InviteURL: "https://hoodcops.test/i/%s"},
+		zap.NewNop(),
+	)
+	inviter.now = func() time.Time { return time.Unix(1500000000, 500) }
+
+	return inviter, invites, sender
+}
+
+func TestSMSInviter_Invite_ShouldSendLinksToPendingContacts(t *testing.T) {
+	inviter, invites, sender := newTestSMSInviter(ratelimit.SMSConfig{}, ratelimit.Bucket{})
+
+	err := inviter.Invite(context.Background(), 7, []*db.UserContact{
+		{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusPending},
+		{ID: 2, UserID: 7, Msisdn: "+233244111111", Status: db.ContactStatusDeclined},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].To != "+233200662782" {
+		t.Fatalf("expected only the pending contact to be invited, got %+v", messages)
+	}
+
+	if !strings.Contains(messages[0].Body, "Kofi Mensah") || !strings.Contains(messages[0].Body, "https://hoodcops.test/i/1.1500000000") {
+		t.Fatalf("unexpected invitation %q", messages[0].Body)
+	}
+
+	if at, ok := invites.invited[1]; !ok || !at.Equal(time.Unix(1500000000, 0)) {
+		t.Fatalf("expected the invitation to be recorded to the second, got %v", invites.invited)
+	}
+}
+
+func TestSMSInviter_Invite_ShouldEnforceSMSLimits(t *testing.T) {
+	inviter, invites, sender := newTestSMSInviter(ratelimit.SMSConfig{
+		AllowedRegions: []string{"GH"},
+	}, ratelimit.Bucket{Burst: 2, Interval: time.Hour})
+
+	err := inviter.Invite(context.Background(), 7, []*db.UserContact{
+		{ID: 1, UserID: 7, Msisdn: "+233200662782", Status: db.ContactStatusPending},
+		{ID: 2, UserID: 7, Msisdn: "+447700900123", Status: db.ContactStatusPending},
+		{ID: 3, UserID: 7, Msisdn: "+233244111111", Status: db.ContactStatusPending},
+		{ID: 4, UserID: 7, Msisdn: "+233244222222", Status: db.ContactStatusPending},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the contacts that were not invited")
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].To != "+233200662782" {
+		t.Fatalf("expected only the first contact to be invited, got %+v", messages)
+	}
+
+	if len(invites.invited) != 1 {
+		t.Fatalf("expected only one invitation to be recorded, got %v", invites.invited)
+	}
+}
@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"fmt"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/phone"
+)
+
+// DefaultLocale is the locale of messages sent to numbers of regions
+// without a locale of their own, when no other default is configured
+const DefaultLocale = "en"
+
+// alertTemplates holds the SMS sent to the contacts of a user who raised an
+// alert, indexed by locale. The template is given the name of the user, the
+// category of the alert and a link to its location.
+var alertTemplates = map[string]string{
+	"en": "HOODCOPS ALERT: %s raised %s alert and may need your help. Location: %s",
+	"fr": "ALERTE HOODCOPS : %s a lancé %s et a peut-être besoin de votre aide. Position : %s",
+}
+
+// volunteerTemplates holds the message sent to volunteers near an alert
+// nobody has acknowledged, indexed by locale. The template is given the
+// category of the alert and a link to its location. The name of the user
+// who raised the alert is not shared with strangers.
+var volunteerTemplates = map[string]string{
+	"en": "HOODCOPS ALERT: someone near you raised %s alert and nobody has responded yet. Location: %s",
+	"fr": "ALERTE HOODCOPS : quelqu'un près de vous a lancé %s et personne n'a encore répondu. Position : %s",
+}
+
+// adminTemplates holds the SMS sent to administrators about an alert nobody
+// has acknowledged, indexed by locale. The template is given the name of the
+// user who raised the alert, the category and ID of the alert and a link to
+// its location.
+var adminTemplates = map[string]string{
+	"en": "HOODCOPS ESCALATION: %s raised %s alert (#%d) that nobody has acknowledged. Location: %s",
+	"fr": "ESCALADE HOODCOPS : %s a lancé %s (n°%d) que personne n'a prise en charge. Position : %s",
+}
+
+// inviteTemplates holds the SMS inviting someone to be the emergency contact
+// of a user, indexed by locale. The template is given the name of the user
+// and a link to the invitation.
+var inviteTemplates = map[string]string{
+	"en": "HOODCOPS: %s added you as an emergency contact, so you would get an SMS if they raise an alert. Accept or decline: %s",
+	"fr": "HOODCOPS : %s vous a ajouté comme contact d'urgence, vous recevrez un SMS en cas d'alerte. Accepter ou refuser : %s",
+}
+
+// categoryNames holds the names of alert categories as used in alertTemplates,
+// indexed by locale
+var categoryNames = map[string]map[string]string{
+	"en": {
+		db.AlertCategoryGeneral:  "an",
+		db.AlertCategoryMedical:  "a medical",
+		db.AlertCategoryFire:     "a fire",
+		db.AlertCategoryCrime:    "a crime",
+		db.AlertCategoryAccident: "an accident",
+	},
+	"fr": {
+		db.AlertCategoryGeneral:  "une alerte",
+		db.AlertCategoryMedical:  "une alerte médicale",
+		db.AlertCategoryFire:     "une alerte incendie",
+		db.AlertCategoryCrime:    "une alerte crime",
+		db.AlertCategoryAccident: "une alerte accident",
+	},
+}
+
+// regionLocales holds the locales of regions whose numbers get messages in
+// a language other than the configured default
+var regionLocales = map[string]string{
+	"BF": "fr",
+	"BJ": "fr",
+	"CI": "fr",
+	"CM": "fr",
+	"FR": "fr",
+	"MA": "fr",
+	"SN": "fr",
+	"TG": "fr",
+}
+
+// localeFor returns the locale of messages sent to msisdn
+func localeFor(msisdn, defaultLocale string) string {
+	for region, locale := range regionLocales {
+		if phone.InRegion(phone.Number(msisdn), region) {
+			return locale
+		}
+	}
+
+	if _, ok := alertTemplates[defaultLocale]; ok {
+		return defaultLocale
+	}
+
+	return DefaultLocale
+}
+
+// alertMessage returns the message telling a contact that name raised alert
+func alertMessage(locale, name, location string, alert *db.Alert) string {
+	return fmt.Sprintf(alertTemplates[locale], name, categoryName(locale, alert), location)
+}
+
+// volunteerMessage returns the message asking volunteers near alert for help
+func volunteerMessage(locale, location string, alert *db.Alert) string {
+	return fmt.Sprintf(volunteerTemplates[locale], categoryName(locale, alert), location)
+}
+
+// adminMessage returns the message telling administrators
+// that nobody has acknowledged alert raised by name
+func adminMessage(locale, name, location string, alert *db.Alert) string {
+	return fmt.Sprintf(adminTemplates[locale], name, categoryName(locale, alert), alert.ID, location)
+}
+
+// inviteMessage returns the message inviting a contact
+// to be the emergency contact of name
+func inviteMessage(locale, name, link string) string {
+	return fmt.Sprintf(inviteTemplates[locale], name, link)
+}
+
+func categoryName(locale string, alert *db.Alert) string {
+	category, ok := categoryNames[locale][alert.Category]
+	if !ok {
+		category = categoryNames[locale][db.AlertCategoryGeneral]
+	}
+
+	return category
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// AlertNotifier tells the emergency contacts of a user that the user
+// raised an alert. Notifying carries on for as long as ctx allows.
+type AlertNotifier interface {
+	AlertRaised(ctx context.Context, alert *db.Alert) error
+}
+
+// LogNotifier is an AlertNotifier that writes raised alerts to a log
+// instead of notifying anyone. It is meant to be used during development.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+// NewLogNotifier returns a pointer to a value of LogNotifier
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{
+		logger: logger,
+	}
+}
+
+// AlertRaised logs the alert
+func (ln *LogNotifier) AlertRaised(ctx context.Context, alert *db.Alert) error {
+	ln.logger.Info("alert raised",
+		zap.Int("alertId", alert.ID),
+		zap.Int("userId", alert.UserID),
+		zap.String("category", alert.Category),
+	)
+	return nil
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// NearbyStore finds users near a point. It is implemented
+// by *db.UserProfilesRepo.
+type NearbyStore interface {
+	GetNear(ctx context.Context, point db.Coordinate, meters float64, respondersOnly bool) ([]*db.NearbyUser, error)
+}
+
+// VolunteersConfig holds the settings of a VolunteersNotifier
+type VolunteersConfig struct {
+	// Radius is the distance in meters from an alert
+	// within which volunteers are notified
+	Radius float64
+
+	// Locale is the locale of messages. It defaults to DefaultLocale.
+	Locale string
+
+	// LocationURL is the format of links to the location of alerts. It
+	// defaults to DefaultLocationURL.
+	LocationURL string
+}
+
+// VolunteersNotifier is an AlertNotifier that sends a push notification to
+// the responders whose location is near an alert
+type VolunteersNotifier struct {
+	nearby NearbyStore
+	pusher Pusher
+	cfg    VolunteersConfig
+	logger *zap.Logger
+}
+
+// NewVolunteersNotifier returns a pointer to a value of VolunteersNotifier
+func NewVolunteersNotifier(nearby NearbyStore, pusher Pusher, cfg VolunteersConfig, logger *zap.Logger) *VolunteersNotifier {
+	if _, ok := volunteerTemplates[cfg.Locale]; !ok {
+		cfg.Locale = DefaultLocale
+	}
+
+	if len(cfg.LocationURL) == 0 {
+		cfg.LocationURL = DefaultLocationURL
+	}
+
+	return &VolunteersNotifier{
+		nearby: nearby,
+		pusher: pusher,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// AlertRaised notifies the responders within the configured radius
+// of alert, apart from the user who raised it
+func (vn *VolunteersNotifier) AlertRaised(ctx context.Context, alert *db.Alert) error {
+	volunteers, err := vn.nearby.GetNear(ctx, alert.Coordinate, vn.cfg.Radius, true)
+	if err != nil {
+		return err
+	}
+
+	var userIDs []int
+	for _, volunteer := range volunteers {
+		if volunteer.UserID != alert.UserID {
+			userIDs = append(userIDs, volunteer.UserID)
+		}
+	}
+
+	if len(userIDs) == 0 {
+		vn.logger.Info("no volunteers near alert", zap.Int("alertId", alert.ID))
+		return nil
+	}
+
+	body := volunteerMessage(vn.cfg.Locale, locationLink(vn.cfg.LocationURL, alert), alert)
+	result, err := vn.pusher.SendToUsers(ctx, userIDs, alertNotification(alert, body))
+	if err != nil {
+		return err
+	}
+
+	vn.logger.Info("notified volunteers near alert",
+		zap.Int("alertId", alert.ID),
+		zap.Int("volunteers", len(userIDs)),
+		zap.Int("sent", result.Sent),
+		zap.Int("failed", result.Failed),
+	)
+	return nil
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+type fakeNearbyStore struct {
+	users          []*db.NearbyUser
+	meters         float64
+	respondersOnly bool
+}
+
+func (fn *fakeNearbyStore) GetNear(ctx context.Context, point db.Coordinate, meters float64, respondersOnly bool) ([]*db.NearbyUser, error) {
+	fn.meters, fn.respondersOnly = meters, respondersOnly
+	return fn.users, nil
+}
+
+func TestVolunteersNotifier_AlertRaised_ShouldPushToNearbyRespondersButTheOwner(t *testing.T) {
+	nearby := &fakeNearbyStore{
+		users: []*db.NearbyUser{
+			{UserProfile: db.UserProfile{UserID: 7}},
+			{UserProfile: db.UserProfile{UserID: 11}},
+			{UserProfile: db.UserProfile{UserID: 12}},
+		},
+	}
+	pusher := &recordingPusher{}
+
+	notifier := NewVolunteersNotifier(nearby, pusher, VolunteersConfig{Radius: 2000}, zap.NewNop())
+	err := notifier.AlertRaised(context.Background(), testAlert)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if nearby.meters != 2000 || !nearby.respondersOnly {
+		t.Fatalf("expected responders within 2000m, got %vm responders only %v", nearby.meters, nearby.respondersOnly)
+	}
+
+	if len(pusher.userIDs) != 2 || pusher.userIDs[0] != 11 || pusher.userIDs[1] != 12 {
+		t.Fatalf("expected push to users 11 and 12, got %v", pusher.userIDs)
+	}
+
+	if strings.Contains(pusher.n.Body, "Kofi") || !strings.Contains(pusher.n.Body, "nobody has responded yet") {
+		t.Fatalf("unexpected notification body %q", pusher.n.Body)
+	}
+}
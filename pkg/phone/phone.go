@@ -0,0 +1,241 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidNumber is returned when a phone number cannot be
+	// parsed into a valid E.164 number
+	ErrInvalidNumber = errors.New("invalid phone number")
+
+	// ErrUnknownRegion is returned when a national number is parsed
+	// with a default region there is no numbering plan for
+	ErrUnknownRegion = errors.New("unknown phone number region")
+)
+
+const (
+	// E.164 numbers have at most 15 digits, country calling code included
+	maxDigits = 15
+	minDigits = 8
+)
+
+// Number is a phone number in canonical E.164 format, e.g. "+233200662782"
+type Number string
+
+// String returns the E.164 representation of the number
+func (n Number) String() string {
+	return string(n)
+}
+
+// region is the numbering plan of a country or territory
+type region struct {
+	callingCode string
+	trunkPrefix string
+	minLength   int
+	maxLength   int
+}
+
+// regions holds the numbering plans of the regions phone numbers can be
+// parsed in without an international prefix, indexed by ISO 3166-1 code
+var regions = map[string]region{
+	"BF": {callingCode: "226", minLength: 8, maxLength: 8},
+	"BJ": {callingCode: "229", minLength: 8, maxLength: 10},
+	"CA": {callingCode: "1", trunkPrefix: "1", minLength: 10, maxLength: 10},
+	"CI": {callingCode: "225", minLength: 10, maxLength: 10},
+	"CM": {callingCode: "237", minLength: 9, maxLength: 9},
+	"CN": {callingCode: "86", trunkPrefix: "0", minLength: 10, maxLength: 11},
+	"DE": {callingCode: "49", trunkPrefix: "0", minLength: 6, maxLength: 13},
+	"EG": {callingCode: "20", trunkPrefix: "0", minLength: 8, maxLength: 10},
+	"FR": {callingCode: "33", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"GB": {callingCode: "44", trunkPrefix: "0", minLength: 9, maxLength: 10},
+	"GH": {callingCode: "233", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"IN": {callingCode: "91", trunkPrefix: "0", minLength: 10, maxLength: 10},
+	"KE": {callingCode: "254", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"MA": {callingCode: "212", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"NG": {callingCode: "234", trunkPrefix: "0", minLength: 8, maxLength: 10},
+	"NL": {callingCode: "31", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"RW": {callingCode: "250", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"SN": {callingCode: "221", minLength: 9, maxLength: 9},
+	"TG": {callingCode: "228", minLength: 8, maxLength: 8},
+	"TZ": {callingCode: "255", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"UG": {callingCode: "256", trunkPrefix: "0", minLength: 9, maxLength: 9},
+	"US": {callingCode: "1", trunkPrefix: "1", minLength: 10, maxLength: 10},
+	"ZA": {callingCode: "27", trunkPrefix: "0", minLength: 9, maxLength: 9},
+}
+
+// IsSupportedRegion reports whether national numbers can be parsed with
+// code as their default region
+func IsSupportedRegion(code string) bool {
+	_, ok := regions[strings.ToUpper(code)]
+	return ok
+}
+
+// Parse parses raw into an E.164 number. Numbers in international format,
+// starting with "+" or "00", are parsed as is. Any other number is taken to be
+// a national number of defaultRegion, with or without its trunk prefix, or a
+// number of defaultRegion that includes the country calling code but not the
+// "+". Spaces, dashes, dots and parentheses are ignored.
+func Parse(raw, defaultRegion string) (Number, error) {
+	digits, international, err := clean(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if international {
+		return parseInternational(digits)
+	}
+
+	r, ok := regions[strings.ToUpper(defaultRegion)]
+	if !ok {
+		return "", ErrUnknownRegion
+	}
+
+	return parseNational(digits, r)
+}
+
+// ParseWithCallingCode parses raw as a number of the country with the
+// specified calling code, e.g. "233". It is meant for clients that collect
+// the calling code and the rest of the number separately. An empty calling
+// code behaves like Parse.
+func ParseWithCallingCode(callingCode, raw, defaultRegion string) (Number, error) {
+	callingCode = strings.TrimLeft(strings.TrimSpace(callingCode), "+")
+	if len(callingCode) == 0 {
+		return Parse(raw, defaultRegion)
+	}
+
+	digits, international, err := clean(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if international {
+		return parseInternational(digits)
+	}
+
+	if r, ok := regions[strings.ToUpper(defaultRegion)]; ok && r.callingCode == callingCode {
+		return parseNational(digits, r)
+	}
+
+	for _, r := range regions {
+		if r.callingCode == callingCode {
+			return parseNational(digits, r)
+		}
+	}
+
+	return parseInternational(callingCode + strings.TrimLeft(digits, "0"))
+}
+
+// InRegion reports whether n belongs to the numbering plan of the region
+// with the ISO 3166-1 code, e.g. "GH". Regions sharing a calling code, like
+// US and CA, cannot be told apart.
+func InRegion(n Number, code string) bool {
+	r, ok := regions[strings.ToUpper(code)]
+	if !ok || !strings.HasPrefix(string(n), "+"+r.callingCode) {
+		return false
+	}
+
+	national := len(n) - len(r.callingCode) - 1
+	return national >= r.minLength && national <= r.maxLength
+}
+
+// IsE164 reports whether s is a number in canonical E.164 format
+func IsE164(s string) bool {
+	if len(s) < minDigits+1 || len(s) > maxDigits+1 || s[0] != '+' || s[1] == '0' {
+		return false
+	}
+
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clean strips formatting characters from raw, returning its digits and
+// whether it was written in international format
+func clean(raw string) (string, bool, error) {
+	raw = strings.TrimSpace(raw)
+
+	international := false
+	if strings.HasPrefix(raw, "+") {
+		international = true
+		raw = raw[1:]
+	}
+
+	var b strings.Builder
+	for _, c := range raw {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')' || c == '/':
+		default:
+			return "", false, ErrInvalidNumber
+		}
+	}
+
+	digits := b.String()
+	if !international && strings.HasPrefix(digits, "00") {
+		international = true
+		digits = digits[2:]
+	}
+
+	if len(digits) == 0 {
+		return "", false, ErrInvalidNumber
+	}
+
+	return digits, international, nil
+}
+
+func parseInternational(digits string) (Number, error) {
+	for _, r := range regions {
+		if strings.HasPrefix(digits, r.callingCode) {
+			national := digits[len(r.callingCode):]
+			if len(national) >= r.minLength && len(national) <= r.maxLength {
+				return Number("+" + digits), nil
+			}
+		}
+	}
+
+	// numbers of regions without a known numbering plan are only checked
+	// against the limits of the E.164 format
+	n := Number("+" + digits)
+	if !IsE164(string(n)) || knownCallingCode(digits) {
+		return "", ErrInvalidNumber
+	}
+
+	return n, nil
+}
+
+func parseNational(digits string, r region) (Number, error) {
+	// the number may already include the calling code without the "+"
+	if strings.HasPrefix(digits, r.callingCode) {
+		national := digits[len(r.callingCode):]
+		if len(national) >= r.minLength && len(national) <= r.maxLength && len(digits) > r.maxLength {
+			return Number("+" + digits), nil
+		}
+	}
+
+	if len(r.trunkPrefix) > 0 && strings.HasPrefix(digits, r.trunkPrefix) && len(digits) > r.minLength {
+		digits = digits[len(r.trunkPrefix):]
+	}
+
+	if len(digits) < r.minLength || len(digits) > r.maxLength || strings.HasPrefix(digits, "0") {
+		return "", ErrInvalidNumber
+	}
+
+	return Number("+" + r.callingCode + digits), nil
+}
+
+func knownCallingCode(digits string) bool {
+	for _, r := range regions {
+		if strings.HasPrefix(digits, r.callingCode) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package phone
+
+import (
+	"testing"
+)
+
+func TestParse_ShouldPass(t *testing.T) {
+	cases := []struct {
+		raw    string
+		region string
+		want   Number
+	}{
+		{"+233 20 066 2782", "GH", "+233200662782"},
+		{"0200662782", "GH", "+233200662782"},
+		{"233200662782", "GH", "+233200662782"},
+		{"200662782", "GH", "+233200662782"},
+		{"00233200662782", "GH", "+233200662782"},
+		{"(020) 066-2782", "gh", "+233200662782"},
+		{"+49 179 4491095", "GH", "+491794491095"},
+		{"0179 4491095", "DE", "+491794491095"},
+		{"(202) 555-0123", "US", "+12025550123"},
+		{"1 202 555 0123", "US", "+12025550123"},
+		{"+380 50 123 4567", "GH", "+380501234567"},
+	}
+
+	for _, c := range cases {
+		got, err := Parse(c.raw, c.region)
+		if err != nil {
+			t.Errorf("Parse(%q, %q): expected no error, got %v", c.raw, c.region, err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("Parse(%q, %q): expected %s, got %s", c.raw, c.region, c.want, got)
+		}
+	}
+}
+
+func TestParse_ShouldFail(t *testing.T) {
+	cases := []struct {
+		raw    string
+		region string
+		err    error
+	}{
+		{"", "GH", ErrInvalidNumber},
+		{"02006627", "GH", ErrInvalidNumber},
+		{"02006627821", "GH", ErrInvalidNumber},
+		{"+233 20066", "GH", ErrInvalidNumber},
+		{"+0123456789", "GH", ErrInvalidNumber},
+		{"020 CALL ME", "GH", ErrInvalidNumber},
+		{"0200662782", "XX", ErrUnknownRegion},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c.raw, c.region)
+		if err != c.err {
+			t.Errorf("Parse(%q, %q): expected %v, got %v", c.raw, c.region, c.err, err)
+		}
+	}
+}
+
+func TestParseWithCallingCode_ShouldPass(t *testing.T) {
+	cases := []struct {
+		callingCode string
+		raw         string
+		want        Number
+	}{
+		{"233", "0200662782", "+233200662782"},
+		{"+233", "200662782", "+233200662782"},
+		{"49", "179-449-1095", "+491794491095"},
+		{"", "0200662782", "+233200662782"},
+		{"380", "0501234567", "+380501234567"},
+	}
+
+	for _, c := range cases {
+		got, err := ParseWithCallingCode(c.callingCode, c.raw, "GH")
+		if err != nil {
+			t.Errorf("ParseWithCallingCode(%q, %q): expected no error, got %v", c.callingCode, c.raw, err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("ParseWithCallingCode(%q, %q): expected %s, got %s", c.callingCode, c.raw, c.want, got)
+		}
+	}
+}
+
+func TestIsE164(t *testing.T) {
+	if !IsE164("+233200662782") {
+		t.Error("expected +233200662782 to be E.164")
+	}
+
+	for _, s := range []string{"233200662782", "+233 200662782", "+0233200662782", "+2332", "+2332006627821234"} {
+		if IsE164(s) {
+			t.Errorf("expected %q not to be E.164", s)
+		}
+	}
+}
+
+func TestInRegion(t *testing.T) {
+	cases := []struct {
+		n      Number
+		region string
+		want   bool
+	}{
+		{"+233200662782", "GH", true},
+		{"+233200662782", "gh", true},
+		{"+233200662782", "NG", false},
+		{"+2332006627821", "GH", false},
+		{"+12025550123", "US", true},
+		{"+12025550123", "CA", true},
+		{"+380501234567", "GH", false},
+		{"+233200662782", "XX", false},
+	}
+
+	for _, c := range cases {
+		if got := InRegion(c.n, c.region); got != c.want {
+			t.Errorf("InRegion(%q, %q): expected %v, got %v", c.n, c.region, c.want, got)
+		}
+	}
+}
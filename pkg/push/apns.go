@@ -0,0 +1,229 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// Hosts of the production and development environments of the Apple Push
+// Notification service
+const (
+	DefaultAPNsHost = "https://api.push.apple.com"
+	SandboxAPNsHost = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenTTL is how long a provider token is used for. APNs rejects
+// tokens older than an hour, and tokens renewed more often than every
+// 20 minutes.
+const apnsTokenTTL = 50 * time.Minute
+
+// APNsConfig holds the settings of an APNsProvider. KeyID, TeamID and
+// PrivateKey are those of an APNs authentication key, with PrivateKey
+// holding the contents of its .p8 file.
+type APNsConfig struct {
+	// Host is the base URL of APNs. It defaults to DefaultAPNsHost.
+	Host string
+
+	KeyID      string
+	TeamID     string
+	PrivateKey string
+
+	// Topic is the bundle ID of the app notifications are sent to
+	Topic string
+}
+
+// APNsProvider delivers notifications to iOS devices through the Apple
+// Push Notification service, authenticating with provider tokens
+type APNsProvider struct {
+	client *http.Client
+	host   string
+	keyID  string
+	teamID string
+	topic  string
+	key    *ecdsa.PrivateKey
+	now    func() time.Time
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNsProvider returns a pointer to a value of APNsProvider, or an error
+// if the private key cannot be parsed
+func NewAPNsProvider(client *http.Client, cfg APNsConfig) (*APNsProvider, error) {
+	key, err := parsePrivateKey([]byte(cfg.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("push: apns private key must be an ECDSA key")
+	}
+
+	host := cfg.Host
+	if len(host) == 0 {
+		host = DefaultAPNsHost
+	}
+
+	return &APNsProvider{
+		client: client,
+		host:   strings.TrimRight(host, "/"),
+		keyID:  cfg.KeyID,
+		teamID: cfg.TeamID,
+		topic:  cfg.Topic,
+		key:    ecKey,
+		now:    time.Now,
+	}, nil
+}
+
+// Platform returns db.PlatformAPNs
+func (ap *APNsProvider) Platform() string {
+	return db.PlatformAPNs
+}
+
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type apnsAps struct {
+	Alert             *apnsAlert `json:"alert,omitempty"`
+	Sound             string     `json:"sound,omitempty"`
+	ContentAvailable  int        `json:"content-available,omitempty"`
+	InterruptionLevel string     `json:"interruption-level,omitempty"`
+}
+
+// Send delivers n to the device with the specified device token.
+// Notifications without a title or body are sent as background
+// notifications that wake the app without alerting the user.
+func (ap *APNsProvider) Send(token string, n *Notification) error {
+	payload := map[string]interface{}{}
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+
+	aps := apnsAps{}
+	pushType, priority := "alert", "10"
+
+	switch {
+	case len(n.Title) == 0 && len(n.Body) == 0:
+		// APNs only accepts background notifications with low priority
+		aps.ContentAvailable = 1
+		pushType, priority = "background", "5"
+	case n.Priority == PriorityHigh:
+		aps.Alert = &apnsAlert{Title: n.Title, Body: n.Body}
+		aps.Sound = "default"
+		aps.InterruptionLevel = "time-sensitive"
+	default:
+		aps.Alert = &apnsAlert{Title: n.Title, Body: n.Body}
+		priority = "5"
+	}
+	payload["aps"] = aps
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ap.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	providerToken, err := ap.authorize()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", ap.topic)
+	req.Header.Set("apns-push-type", pushType)
+	req.Header.Set("apns-priority", priority)
+
+	if len(n.CollapseKey) > 0 {
+		req.Header.Set("apns-collapse-id", n.CollapseKey)
+	}
+
+	if n.TTL > 0 {
+		req.Header.Set("apns-expiration", strconv.FormatInt(ap.now().Add(n.TTL).Unix(), 10))
+	}
+
+	res, err := ap.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		return parseAPNsError(res)
+	}
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+// authorize returns the provider token requests are authenticated with,
+// signing a new one when the current one is about to expire
+func (ap *APNsProvider) authorize() (string, error) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	now := ap.now()
+	if len(ap.token) > 0 && now.Sub(ap.issuedAt) < apnsTokenTTL {
+		return ap.token, nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": ap.teamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = ap.keyID
+
+	signed, err := token.SignedString(ap.key)
+	if err != nil {
+		return "", err
+	}
+
+	ap.token, ap.issuedAt = signed, now
+	return ap.token, nil
+}
+
+func parseAPNsError(res *http.Response) error {
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+
+	perr := &Error{Status: res.StatusCode, Reason: res.Status}
+	if err := json.Unmarshal(data, &body); err == nil && len(body.Reason) > 0 {
+		perr.Reason = body.Reason
+	}
+
+	switch {
+	case res.StatusCode == http.StatusGone:
+		perr.Unregistered = true
+	case perr.Reason == "BadDeviceToken" || perr.Reason == "Unregistered" || perr.Reason == "DeviceTokenNotForTopic":
+		perr.Unregistered = true
+	}
+
+	return perr
+}
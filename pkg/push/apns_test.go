@@ -0,0 +1,112 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func newTestAPNsProvider(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*APNsProvider, *ecdsa.PrivateKey, func()) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed marshalling key: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	provider, err := NewAPNsProvider(srv.Client(), APNsConfig{
+		Host:       srv.URL,
+		KeyID:      "K3Y1D",
+		TeamID:     "T34M1D",
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		Topic:      "com.hoodcops.app",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return provider, key, srv.Close
+}
+
+func TestAPNsProvider_Send_ShouldPass(t *testing.T) {
+	var (
+		req     *http.Request
+		payload map[string]interface{}
+		key     *ecdsa.PrivateKey
+	)
+
+	provider, key, done := newTestAPNsProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		json.NewDecoder(r.Body).Decode(&payload)
+	})
+	defer done()
+
+	err := provider.Send("d3v1c3t0k3n", &Notification{
+		Title:       "Alert",
+		Body:        "Kofi needs help",
+		Data:        map[string]string{"alertId": "42"},
+		Priority:    PriorityHigh,
+		CollapseKey: "alert-42",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if req.URL.Path != "/3/device/d3v1c3t0k3n" {
+		t.Fatalf("unexpected path %s", req.URL.Path)
+	}
+
+	if req.Header.Get("apns-topic") != "com.hoodcops.app" || req.Header.Get("apns-priority") != "10" ||
+		req.Header.Get("apns-push-type") != "alert" || req.Header.Get("apns-collapse-id") != "alert-42" {
+		t.Fatalf("unexpected headers %v", req.Header)
+	}
+
+	token, err := jwt.Parse(strings.TrimPrefix(req.Header.Get("Authorization"), "bearer "), func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	if err != nil || token.Header["kid"] != "K3Y1D" || token.Claims.(jwt.MapClaims)["iss"] != "T34M1D" {
+		t.Fatalf("unexpected provider token %v: %v", token, err)
+	}
+
+	aps := payload["aps"].(map[string]interface{})
+	if aps["alert"].(map[string]interface{})["body"] != "Kofi needs help" || payload["alertId"] != "42" {
+		t.Fatalf("unexpected payload %v", payload)
+	}
+}
+
+func TestAPNsProvider_Send_ShouldReportUnregisteredTokens(t *testing.T) {
+	provider, _, done := newTestAPNsProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/g0n3") {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason": "Unregistered", "timestamp": 1536062400000}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"reason": "PayloadTooLarge"}`))
+	})
+	defer done()
+
+	err := provider.Send("g0n3", &Notification{Title: "Alert"})
+	if !IsUnregistered(err) {
+		t.Fatalf("expected unregistered token error, got %v", err)
+	}
+
+	err = provider.Send("t0k3n", &Notification{Title: "Alert"})
+	if err == nil || IsUnregistered(err) {
+		t.Fatalf("expected other error, got %v", err)
+	}
+}
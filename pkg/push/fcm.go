@@ -0,0 +1,265 @@
+package push
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// Default endpoints of Firebase Cloud Messaging and of the Google OAuth 2.0
+// server that issues access tokens for it
+const (
+	DefaultFCMHost  = "https://fcm.googleapis.com"
+	DefaultTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// FCMConfig holds the settings of an FCMProvider. ClientEmail and
+// PrivateKey are those of a Firebase service account, as found in its
+// JSON key file.
+type FCMConfig struct {
+	// Host is the base URL of the FCM HTTP v1 API. It defaults to
+	// DefaultFCMHost.
+	Host string
+
+	// TokenURL is the URL access tokens are requested from. It defaults
+	// to DefaultTokenURL.
+	TokenURL string
+
+	ProjectID   string
+	ClientEmail string
+	PrivateKey  string
+}
+
+// FCMProvider delivers notifications to Android devices through the
+// Firebase Cloud Messaging HTTP v1 API
+type FCMProvider struct {
+	client      *http.Client
+	host        string
+	tokenURL    string
+	projectID   string
+	clientEmail string
+	key         *rsa.PrivateKey
+	now         func() time.Time
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMProvider returns a pointer to a value of FCMProvider, or an error
+// if the private key of the service account cannot be parsed
+func NewFCMProvider(client *http.Client, cfg FCMConfig) (*FCMProvider, error) {
+	key, err := parsePrivateKey([]byte(cfg.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("push: fcm private key must be an RSA key")
+	}
+
+	host := cfg.Host
+	if len(host) == 0 {
+		host = DefaultFCMHost
+	}
+
+	tokenURL := cfg.TokenURL
+	if len(tokenURL) == 0 {
+		tokenURL = DefaultTokenURL
+	}
+
+	return &FCMProvider{
+		client:      client,
+		host:        strings.TrimRight(host, "/"),
+		tokenURL:    tokenURL,
+		projectID:   cfg.ProjectID,
+		clientEmail: cfg.ClientEmail,
+		key:         rsaKey,
+		now:         time.Now,
+	}, nil
+}
+
+// Platform returns db.PlatformFCM
+func (fp *FCMProvider) Platform() string {
+	return db.PlatformFCM
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type fcmAndroidConfig struct {
+	Priority    string `json:"priority,omitempty"`
+	CollapseKey string `json:"collapse_key,omitempty"`
+	TTL         string `json:"ttl,omitempty"`
+}
+
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification *fcmNotification  `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *fcmAndroidConfig `json:"android,omitempty"`
+}
+
+// Send delivers n to the device with the specified registration token
+func (fp *FCMProvider) Send(token string, n *Notification) error {
+	msg := fcmMessage{
+		Token: token,
+		Data:  n.Data,
+		Android: &fcmAndroidConfig{
+			Priority:    "NORMAL",
+			CollapseKey: n.CollapseKey,
+		},
+	}
+
+	if len(n.Title) > 0 || len(n.Body) > 0 {
+		msg.Notification = &fcmNotification{Title: n.Title, Body: n.Body}
+	}
+
+	if n.Priority == PriorityHigh {
+		msg.Android.Priority = "HIGH"
+	}
+
+	if n.TTL > 0 {
+		msg.Android.TTL = fmt.Sprintf("%ds", int64(n.TTL.Seconds()))
+	}
+
+	body, err := json.Marshal(struct {
+		Message fcmMessage `json:"message"`
+	}{msg})
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := fp.authorize()
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", fp.host, url.PathEscape(fp.projectID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := fp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		return parseFCMError(res)
+	}
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+// authorize returns an OAuth 2.0 access token for the FCM API. Tokens are
+// requested with a JWT signed by the service account, and reused until
+// shortly before they expire.
+func (fp *FCMProvider) authorize() (string, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	now := fp.now()
+	if len(fp.accessToken) > 0 && now.Before(fp.expiresAt) {
+		return fp.accessToken, nil
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   fp.clientEmail,
+		"scope": fcmScope,
+		"aud":   fp.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(fp.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	res, err := fp.client.PostForm(fp.tokenURL, form)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+		return "", fmt.Errorf("push: failed obtaining fcm access token: %s: %s", res.Status, strings.TrimSpace(string(data)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+
+	// tokens are renewed a minute early so that they do not expire in flight
+	fp.accessToken = token.AccessToken
+	fp.expiresAt = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+
+	return fp.accessToken, nil
+}
+
+func parseFCMError(res *http.Response) error {
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+
+	perr := &Error{Status: res.StatusCode, Reason: res.Status}
+	if err := json.Unmarshal(data, &body); err == nil && len(body.Error.Message) > 0 {
+		perr.Reason = body.Error.Message
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		perr.Unregistered = true
+	}
+
+	for _, detail := range body.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			perr.Unregistered = true
+		}
+	}
+
+	return perr
+}
@@ -0,0 +1,143 @@
+package push
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func newTestRSAKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed marshalling key: %v", err)
+	}
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+type mockFCM struct {
+	key          *rsa.PrivateKey
+	tokenIssued  int
+	lastMessage  map[string]interface{}
+	unregistered string
+}
+
+func (m *mockFCM) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(r.FormValue("assertion"), claims, func(token *jwt.Token) (interface{}, error) {
+			return &m.key.PublicKey, nil
+		})
+		if err != nil || claims["iss"] != "push@hoodcops.iam.gserviceaccount.com" || claims["scope"] != fcmScope {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+
+		m.tokenIssued++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "ya29.t0k3n", "expires_in": 3599, "token_type": "Bearer"}`))
+	})
+
+	mux.HandleFunc("/v1/projects/hoodcops/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.t0k3n" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var body struct {
+			Message map[string]interface{} `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		m.lastMessage = body.Message
+
+		if body.Message["token"] == m.unregistered {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "Requested entity was not found.", "status": "NOT_FOUND",
+				"details": [{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": "UNREGISTERED"}]}}`))
+			return
+		}
+
+		w.Write([]byte(`{"name": "projects/hoodcops/messages/0:1500415314455276%31bd1c9631bd1c96"}`))
+	})
+
+	return mux
+}
+
+func newTestFCMProvider(t *testing.T) (*FCMProvider, *mockFCM, func()) {
+	key, pemKey := newTestRSAKey(t)
+	mock := &mockFCM{key: key, unregistered: "st4l3"}
+	srv := httptest.NewServer(mock.handler(t))
+
+	provider, err := NewFCMProvider(srv.Client(), FCMConfig{
+		Host:        srv.URL,
+		TokenURL:    srv.URL + "/token",
+		ProjectID:   "hoodcops",
+		ClientEmail: "push@hoodcops.iam.gserviceaccount.com",
+		PrivateKey:  pemKey,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return provider, mock, srv.Close
+}
+
+func TestFCMProvider_Send_ShouldPass(t *testing.T) {
+	provider, mock, done := newTestFCMProvider(t)
+	defer done()
+
+	n := &Notification{
+		Title:       "Alert",
+		Body:        "Kofi needs help",
+		Data:        map[string]string{"alertId": "42"},
+		Priority:    PriorityHigh,
+		CollapseKey: "alert-42",
+		TTL:         time.Hour,
+	}
+
+	for i := 0; i < 2; i++ {
+		err := provider.Send("t0k3n", n)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if mock.tokenIssued != 1 {
+		t.Fatalf("expected access token to be reused, got %d tokens issued", mock.tokenIssued)
+	}
+
+	android := mock.lastMessage["android"].(map[string]interface{})
+	if android["priority"] != "HIGH" || android["collapse_key"] != "alert-42" || android["ttl"] != "3600s" {
+		t.Fatalf("unexpected android config %v", android)
+	}
+
+	if mock.lastMessage["data"].(map[string]interface{})["alertId"] != "42" {
+		t.Fatalf("unexpected data %v", mock.lastMessage["data"])
+	}
+}
+
+func TestFCMProvider_Send_ShouldReportUnregisteredTokens(t *testing.T) {
+	provider, _, done := newTestFCMProvider(t)
+	defer done()
+
+	err := provider.Send("st4l3", &Notification{Title: "Alert"})
+	if !IsUnregistered(err) {
+		t.Fatalf("expected unregistered token error, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package push
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+// Priority is the delivery priority of a notification
+type Priority string
+
+// Priorities notifications can be sent with. High priority notifications
+// are delivered immediately and may wake sleeping devices, so they are
+// reserved for alerts.
+const (
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// Notification is a push notification shown to the user of a device
+type Notification struct {
+	Title string
+	Body  string
+
+	// Data holds key-value pairs delivered to the app along with the
+	// notification, e.g. the ID of an alert
+	Data map[string]string
+
+	Priority Priority
+
+	// CollapseKey groups notifications so that devices only show the
+	// latest notification of the group, e.g. updates of the same alert
+	CollapseKey string
+
+	// TTL is how long push services keep trying to deliver the notification
+	// to devices that are offline. Zero leaves it to the push service.
+	TTL time.Duration
+}
+
+// Provider delivers notifications through the push service of a platform
+type Provider interface {
+	// Platform returns the platform of the tokens the provider delivers to,
+	// e.g. db.PlatformFCM
+	Platform() string
+
+	// Send delivers n to the device with the specified token
+	Send(token string, n *Notification) error
+}
+
+// Error is returned by providers when a push service rejects a notification
+type Error struct {
+	Status int
+	Reason string
+
+	// Unregistered reports whether the token is no longer valid, e.g.
+	// because the app was uninstalled, and should not be used again
+	Unregistered bool
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("push: %s (status %d)", e.Reason, e.Status)
+}
+
+// IsUnregistered reports whether err tells that a token is no longer valid
+func IsUnregistered(err error) bool {
+	perr, ok := err.(*Error)
+	return ok && perr.Unregistered
+}
+
+// TokenStore returns and deletes the device tokens of users. It is
+// implemented by *db.DeviceTokensRepo.
+type TokenStore interface {
+	GetUserTokens(ctx context.Context, userID int) ([]*db.DeviceToken, error)
+	DeleteTokens(ctx context.Context, tokens []string) error
+}
+
+// Result sums up the delivery of a notification to the devices of users.
+// Pruned counts the tokens deleted because they are no longer valid.
+type Result struct {
+	Sent   int
+	Failed int
+	Pruned int
+}
+
+// Service fans notifications out to every device of users through the
+// provider of each device's platform
+type Service struct {
+	tokens    TokenStore
+	providers map[string]Provider
+	logger    *zap.Logger
+}
+
+// NewService returns a pointer to a value of Service. Devices of platforms
+// without a provider are skipped.
+func NewService(tokens TokenStore, logger *zap.Logger, providers ...Provider) *Service {
+	s := &Service{
+		tokens:    tokens,
+		providers: map[string]Provider{},
+		logger:    logger,
+	}
+
+	for _, p := range providers {
+		s.providers[p.Platform()] = p
+	}
+
+	return s
+}
+
+// SendToUser delivers n to every device of the user with the specified ID
+func (s *Service) SendToUser(ctx context.Context, userID int, n *Notification) (*Result, error) {
+	return s.SendToUsers(ctx, []int{userID}, n)
+}
+
+// SendToUsers delivers n to every device of the users with the specified
+// IDs. Devices are sent to concurrently, and tokens push services report as
+// no longer valid are deleted. Failing to deliver to some devices is not an
+// error; it is reported in the result.
+func (s *Service) SendToUsers(ctx context.Context, userIDs []int, n *Notification) (*Result, error) {
+	var tokens []*db.DeviceToken
+	for _, userID := range userIDs {
+		userTokens, err := s.tokens.GetUserTokens(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, userTokens...)
+	}
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		result       = &Result{}
+		unregistered []string
+	)
+
+	for _, token := range tokens {
+		provider, ok := s.providers[token.Platform]
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(token *db.DeviceToken) {
+			defer wg.Done()
+
+			err := provider.Send(token.Token, n)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err == nil:
+				result.Sent++
+			case IsUnregistered(err):
+				result.Failed++
+				unregistered = append(unregistered, token.Token)
+			default:
+				result.Failed++
+				s.logger.Warn("failed sending push notification",
+					zap.Int("userId", token.UserID),
+					zap.String("deviceId", token.DeviceID),
+					zap.String("platform", token.Platform),
+					zap.Error(err),
+				)
+			}
+		}(token)
+	}
+
+	wg.Wait()
+
+	if len(unregistered) > 0 {
+		err := s.tokens.DeleteTokens(ctx, unregistered)
+		if err != nil {
+			s.logger.Error("failed pruning unregistered device tokens", zap.Error(err))
+		} else {
+			result.Pruned = len(unregistered)
+		}
+	}
+
+	return result, nil
+}
+
+// parsePrivateKey parses a PEM encoded PKCS #8, PKCS #1 or SEC 1 private key
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("push: private key must be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("push: unsupported private key format")
+}
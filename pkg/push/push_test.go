@@ -0,0 +1,81 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"go.uber.org/zap"
+)
+
+type fakeProvider struct {
+	mu       sync.Mutex
+	platform string
+	sent     []string
+	errs     map[string]error
+}
+
+func (fp *fakeProvider) Platform() string {
+	return fp.platform
+}
+
+func (fp *fakeProvider) Send(token string, n *Notification) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	if err, ok := fp.errs[token]; ok {
+		return err
+	}
+
+	fp.sent = append(fp.sent, token)
+	return nil
+}
+
+type fakeTokenStore struct {
+	tokens  map[int][]*db.DeviceToken
+	deleted []string
+}
+
+func (fs *fakeTokenStore) GetUserTokens(ctx context.Context, userID int) ([]*db.DeviceToken, error) {
+	return fs.tokens[userID], nil
+}
+
+func (fs *fakeTokenStore) DeleteTokens(ctx context.Context, tokens []string) error {
+	fs.deleted = append(fs.deleted, tokens...)
+	return nil
+}
+
+func TestService_SendToUsers_ShouldFanOutAndPrune(t *testing.T) {
+	store := &fakeTokenStore{tokens: map[int][]*db.DeviceToken{
+		7: {
+			{UserID: 7, DeviceID: "a", Platform: db.PlatformFCM, Token: "fcm-1"},
+			{UserID: 7, DeviceID: "b", Platform: db.PlatformAPNs, Token: "apns-1"},
+		},
+		8: {
+			{UserID: 8, DeviceID: "c", Platform: db.PlatformFCM, Token: "fcm-stale"},
+			{UserID: 8, DeviceID: "d", Platform: db.PlatformFCM, Token: "fcm-down"},
+		},
+	}}
+
+	fcm := &fakeProvider{platform: db.PlatformFCM, errs: map[string]error{
+		"fcm-stale": &Error{Status: 404, Reason: "UNREGISTERED", Unregistered: true},
+		"fcm-down":  errors.New("connection reset"),
+	}}
+	apns := &fakeProvider{platform: db.PlatformAPNs}
+
+	service := NewService(store, zap.NewNop(), fcm, apns)
+	result, err := service.SendToUsers(context.Background(), []int{7, 8}, &Notification{Title: "Alert", Priority: PriorityHigh})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.Sent != 2 || result.Failed != 2 || result.Pruned != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if len(store.deleted) != 1 || store.deleted[0] != "fcm-stale" {
+		t.Fatalf("expected stale token to be pruned, got %v", store.deleted)
+	}
+}
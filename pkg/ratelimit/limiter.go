@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// LimiterConfig holds the limits a Limiter enforces. Subject names what
+// the requests are made for, like LimitMsisdn for the phone number a code
+// is entered for, and is the name of the limit PerSubject enforces.
+type LimiterConfig struct {
+	Subject    string
+	PerSubject Bucket
+	PerIP      Bucket
+
+	// DailyQuota is the number of units, like the items looked up by a
+	// request, each subject may use a day. There is no quota when it is
+	// zero.
+	DailyQuota int
+}
+
+// Request describes a request made to an endpoint protected by a Limiter.
+// IP identifies the client that made it and is optional.
+type Request struct {
+	Subject string
+	IP      string
+}
+
+// Limiter protects an endpoint that does not send SMS messages from abuse,
+// with a bucket per client IP and one per subject of the requests
+type Limiter struct {
+	store Store
+	name  string
+	cfg   LimiterConfig
+	now   func() time.Time
+}
+
+// NewLimiter returns a pointer to a value of Limiter. Name identifies the
+// endpoint, so that limiters of different endpoints sharing a store keep
+// separate buckets.
+func NewLimiter(store Store, name string, cfg LimiterConfig) *Limiter {
+	return &Limiter{
+		store: store,
+		name:  name,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Allow records req and reports whether it may be served. It returns an
+// *Error when a limit was exceeded.
+func (l *Limiter) Allow(ctx context.Context, req Request) error {
+	return l.AllowN(ctx, req, 1)
+}
+
+// AllowN is like Allow for a request that uses n units of the daily quota
+// of its subject
+func (l *Limiter) AllowN(ctx context.Context, req Request, n int) error {
+	now := l.now()
+
+	if len(req.IP) > 0 {
+		err := Take(ctx, l.store, l.name+":ip:"+req.IP, l.cfg.PerIP, LimitIP, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := Take(ctx, l.store, l.name+":"+l.cfg.Subject+":"+req.Subject, l.cfg.PerSubject, l.cfg.Subject, now)
+	if err != nil || l.cfg.DailyQuota <= 0 {
+		return err
+	}
+
+	return l.store.Update(ctx, l.name+":daily:"+req.Subject, func(limit *db.RateLimit) error {
+		if !limit.WindowEndsAt.Valid || !now.Before(limit.WindowEndsAt.Time) {
+			limit.Count = 0
+			limit.WindowEndsAt = db.NewNullableTime(now.Add(dailyWindow))
+		}
+
+		if limit.Count+n > l.cfg.DailyQuota {
+			return &Error{Limit: LimitDaily, RetryAfter: limit.WindowEndsAt.Time.Sub(now)}
+		}
+
+		limit.Count += n
+		return nil
+	})
+}
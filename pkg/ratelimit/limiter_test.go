@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow_ShouldLimitSubjectsAndIPs(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(NewMemoryStore(), "verify", LimiterConfig{
+		Subject:    LimitMsisdn,
+		PerSubject: Bucket{Burst: 2, Interval: time.Minute},
+		PerIP:      Bucket{Burst: 3, Interval: 10 * time.Second},
+	})
+	limiter.now = clock.now
+
+	for i := 0; i < 2; i++ {
+		err := limiter.Allow(context.Background(), Request{Subject: "+233200662782", IP: "10.0.0.1"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	expectLimit(t, limiter.Allow(context.Background(), Request{Subject: "+233200662782", IP: "10.0.0.2"}), LimitMsisdn, time.Minute)
+
+	err := limiter.Allow(context.Background(), Request{Subject: "+233244000000", IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectLimit(t, limiter.Allow(context.Background(), Request{Subject: "+233244000001", IP: "10.0.0.1"}), LimitIP, 10*time.Second)
+
+	clock.advance(time.Minute)
+	err = limiter.Allow(context.Background(), Request{Subject: "+233200662782", IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestLimiter_AllowN_ShouldEnforceDailyQuota(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(NewMemoryStore(), "discovery", LimiterConfig{
+		Subject:    LimitUser,
+		DailyQuota: 100,
+	})
+	limiter.now = clock.now
+
+	err := limiter.AllowN(context.Background(), Request{Subject: "7"}, 60)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	clock.advance(time.Hour)
+	expectLimit(t, limiter.AllowN(context.Background(), Request{Subject: "7"}, 60), LimitDaily, 23*time.Hour)
+
+	err = limiter.AllowN(context.Background(), Request{Subject: "7"}, 40)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	clock.advance(23 * time.Hour)
+	err = limiter.AllowN(context.Background(), Request{Subject: "7"}, 60)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// MemoryStore is a Store that keeps rate limit state in memory. State is
+// neither shared between processes nor ever evicted, so it is meant for
+// tests and local development.
+type MemoryStore struct {
+	mu     sync.Mutex
+	limits map[string]db.RateLimit
+}
+
+// NewMemoryStore returns a pointer to an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		limits: map[string]db.RateLimit{},
+	}
+}
+
+// Update passes a copy of the state of key to fn and keeps it if fn
+// returns no error
+func (ms *MemoryStore) Update(ctx context.Context, key string, fn func(limit *db.RateLimit) error) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	limit, ok := ms.limits[key]
+	if !ok {
+		limit = db.RateLimit{Key: key}
+	}
+
+	err := fn(&limit)
+	if err != nil {
+		return err
+	}
+
+	ms.limits[key] = limit
+	return nil
+}
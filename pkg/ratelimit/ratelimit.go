@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// Store persists the state of rate limited keys. Update must apply updates
+// of the same key one after the other and discard the state fn leaves behind
+// when it returns an error. It is implemented by *db.RateLimitsRepo and
+// *MemoryStore.
+type Store interface {
+	Update(ctx context.Context, key string, fn func(limit *db.RateLimit) error) error
+}
+
+// Error is returned when an event is denied because a limit was exceeded
+type Error struct {
+	// Limit names the limit that was exceeded, e.g. LimitMsisdn
+	Limit string
+
+	// RetryAfter is how long to wait before the event is allowed again
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded, retry after %s", e.Limit, e.RetryAfter)
+}
+
+// Bucket configures a token bucket that allows bursts of up to Burst events
+// and refills at a rate of one event per Interval. A Bucket with no Burst
+// allows every event.
+type Bucket struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// Enabled reports whether the bucket limits events at all
+func (b Bucket) Enabled() bool {
+	return b.Burst > 0 && b.Interval > 0
+}
+
+// take removes a token from the bucket state held by limit, refilling it
+// for the time passed since it was last updated. A bucket seen for the first
+// time starts full.
+func (b Bucket) take(limit *db.RateLimit, now time.Time) time.Duration {
+	tokens := float64(b.Burst)
+	if limit.UpdatedAt.Valid {
+		elapsed := now.Sub(limit.UpdatedAt.Time)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(tokens, limit.Tokens+float64(elapsed)/float64(b.Interval))
+	}
+
+	if tokens < 1 {
+		return time.Duration((1 - tokens) * float64(b.Interval))
+	}
+
+	limit.Tokens = tokens - 1
+	limit.UpdatedAt = db.NewNullableTime(now)
+	return 0
+}
+
+// Take removes a token from the bucket of key, returning an *Error naming
+// limitName when the bucket is empty
+func Take(ctx context.Context, store Store, key string, b Bucket, limitName string, now time.Time) error {
+	if !b.Enabled() {
+		return nil
+	}
+
+	return store.Update(ctx, key, func(limit *db.RateLimit) error {
+		if wait := b.take(limit, now); wait > 0 {
+			return &Error{Limit: limitName, RetryAfter: wait}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/phone"
+)
+
+// ErrRegionNotAllowed is returned when an SMS is requested for a number
+// outside the regions SMS messages may be sent to
+var ErrRegionNotAllowed = errors.New("sms messages cannot be sent to this region")
+
+// Names of the limits an SMSLimiter or a Limiter enforces
+const (
+	LimitDevice   = "device"
+	LimitIP       = "ip"
+	LimitMsisdn   = "msisdn"
+	LimitUser     = "user"
+	LimitCooldown = "cooldown"
+	LimitDaily    = "daily"
+	LimitGlobal   = "global"
+)
+
+// dailyWindow is the window DailyCap applies to. It starts with the first
+// SMS sent to a number rather than at midnight.
+const dailyWindow = 24 * time.Hour
+
+// SMSConfig holds the limits an SMSLimiter enforces
+type SMSConfig struct {
+	PerDevice Bucket
+	PerIP     Bucket
+	PerMsisdn Bucket
+	Global    Bucket
+
+	// Cooldown is the minimum time between the first and second SMS sent to
+	// a number. It doubles with every further SMS, up to MaxCooldown.
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+
+	// DailyCap is the number of SMS messages a number can receive a day
+	DailyCap int
+
+	// AllowedRegions holds the ISO 3166-1 codes of the regions SMS messages
+	// may be sent to. All regions are allowed when it is empty.
+	AllowedRegions []string
+}
+
+// SMSRequest describes a request to send an SMS to Msisdn. IP and DeviceID
+// identify the client that made it and are optional.
+type SMSRequest struct {
+	Msisdn   phone.Number
+	IP       string
+	DeviceID string
+}
+
+// SMSLimiter protects endpoints that send SMS messages from abuse
+type SMSLimiter struct {
+	store Store
+	cfg   SMSConfig
+	now   func() time.Time
+}
+
+// NewSMSLimiter returns a pointer to a value of SMSLimiter
+func NewSMSLimiter(store Store, cfg SMSConfig) *SMSLimiter {
+	return &SMSLimiter{
+		store: store,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Allow records req and reports whether an SMS may be sent for it. It
+// returns ErrRegionNotAllowed for numbers outside the allowed regions and an
+// *Error when a limit was exceeded.
+func (sl *SMSLimiter) Allow(ctx context.Context, req SMSRequest) error {
+	if !sl.regionAllowed(req.Msisdn) {
+		return ErrRegionNotAllowed
+	}
+
+	now := sl.now()
+
+	if len(req.DeviceID) > 0 {
+		err := Take(ctx, sl.store, "sms:device:"+req.DeviceID, sl.cfg.PerDevice, LimitDevice, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(req.IP) > 0 {
+		err := Take(ctx, sl.store, "sms:ip:"+req.IP, sl.cfg.PerIP, LimitIP, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := sl.store.Update(ctx, "sms:msisdn:"+req.Msisdn.String(), func(limit *db.RateLimit) error {
+		return sl.allowMsisdn(limit, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the global limit is taken last, so that requests denied by any
+	// other limit do not use it up
+	return Take(ctx, sl.store, "sms:global", sl.cfg.Global, LimitGlobal, now)
+}
+
+// allowMsisdn enforces the per number bucket, resend cooldown and daily cap
+func (sl *SMSLimiter) allowMsisdn(limit *db.RateLimit, now time.Time) error {
+	if !limit.WindowEndsAt.Valid || !now.Before(limit.WindowEndsAt.Time) {
+		limit.Count = 0
+		limit.WindowEndsAt = db.NewNullableTime(now.Add(dailyWindow))
+	}
+
+	if sl.cfg.DailyCap > 0 && limit.Count >= sl.cfg.DailyCap {
+		return &Error{Limit: LimitDaily, RetryAfter: limit.WindowEndsAt.Time.Sub(now)}
+	}
+
+	if limit.NextAllowedAt.Valid && now.Before(limit.NextAllowedAt.Time) {
+		return &Error{Limit: LimitCooldown, RetryAfter: limit.NextAllowedAt.Time.Sub(now)}
+	}
+
+	if sl.cfg.PerMsisdn.Enabled() {
+		if wait := sl.cfg.PerMsisdn.take(limit, now); wait > 0 {
+			return &Error{Limit: LimitMsisdn, RetryAfter: wait}
+		}
+	}
+
+	limit.Count++
+	limit.NextAllowedAt = db.NewNullableTime(now.Add(sl.cooldown(limit.Count)))
+	return nil
+}
+
+// cooldown returns the time to wait after the nth SMS sent to a number
+func (sl *SMSLimiter) cooldown(n int) time.Duration {
+	cooldown := sl.cfg.Cooldown
+	for i := 1; i < n && (sl.cfg.MaxCooldown == 0 || cooldown < sl.cfg.MaxCooldown); i++ {
+		cooldown *= 2
+	}
+
+	if sl.cfg.MaxCooldown > 0 && cooldown > sl.cfg.MaxCooldown {
+		cooldown = sl.cfg.MaxCooldown
+	}
+
+	return cooldown
+}
+
+func (sl *SMSLimiter) regionAllowed(msisdn phone.Number) bool {
+	if len(sl.cfg.AllowedRegions) == 0 {
+		return true
+	}
+
+	for _, region := range sl.cfg.AllowedRegions {
+		if phone.InRegion(msisdn, strings.TrimSpace(region)) {
+			return true
+		}
+	}
+
+	return false
+}
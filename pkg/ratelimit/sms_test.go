@@ -0,0 +1,161 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/phone"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (fc *fakeClock) now() time.Time {
+	return fc.t
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	fc.t = fc.t.Add(d)
+}
+
+func newTestSMSLimiter(cfg SMSConfig) (*SMSLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewSMSLimiter(NewMemoryStore(), cfg)
+	limiter.now = clock.now
+
+	return limiter, clock
+}
+
+func expectLimit(t *testing.T, err error, limit string, retryAfter time.Duration) {
+	t.Helper()
+
+	lerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected %s limit error, got %v", limit, err)
+	}
+
+	if lerr.Limit != limit || lerr.RetryAfter != retryAfter {
+		t.Fatalf("expected %s limit with retry after %s, got %s limit with retry after %s", limit, retryAfter, lerr.Limit, lerr.RetryAfter)
+	}
+}
+
+func TestSMSLimiter_Allow_ShouldEscalateCooldown(t *testing.T) {
+	limiter, clock := newTestSMSLimiter(SMSConfig{
+		Cooldown:    30 * time.Second,
+		MaxCooldown: 2 * time.Minute,
+	})
+	req := SMSRequest{Msisdn: "+233200662782"}
+
+	for _, cooldown := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		err := limiter.Allow(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectLimit(t, limiter.Allow(context.Background(), req), LimitCooldown, cooldown)
+
+		clock.advance(cooldown - time.Second)
+		expectLimit(t, limiter.Allow(context.Background(), req), LimitCooldown, time.Second)
+
+		clock.advance(time.Second)
+	}
+}
+
+func TestSMSLimiter_Allow_ShouldEnforceDailyCap(t *testing.T) {
+	limiter, clock := newTestSMSLimiter(SMSConfig{DailyCap: 2})
+	req := SMSRequest{Msisdn: "+233200662782"}
+
+	for i := 0; i < 2; i++ {
+		err := limiter.Allow(context.Background(), req)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		clock.advance(time.Hour)
+	}
+
+	expectLimit(t, limiter.Allow(context.Background(), req), LimitDaily, 22*time.Hour)
+
+	err := limiter.Allow(context.Background(), SMSRequest{Msisdn: "+233244000000"})
+	if err != nil {
+		t.Fatalf("expected other numbers to be allowed, got %v", err)
+	}
+
+	clock.advance(22 * time.Hour)
+	err = limiter.Allow(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected no error once the window passed, got %v", err)
+	}
+}
+
+func TestSMSLimiter_Allow_ShouldRefillBuckets(t *testing.T) {
+	limiter, clock := newTestSMSLimiter(SMSConfig{
+		PerIP: Bucket{Burst: 2, Interval: time.Minute},
+	})
+
+	for _, msisdn := range []string{"+233200000001", "+233200000002"} {
+		err := limiter.Allow(context.Background(), SMSRequest{Msisdn: phone.Number(msisdn), IP: "10.0.0.1"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	req := SMSRequest{Msisdn: "+233200000003", IP: "10.0.0.1"}
+	expectLimit(t, limiter.Allow(context.Background(), req), LimitIP, time.Minute)
+
+	err := limiter.Allow(context.Background(), SMSRequest{Msisdn: "+233200000003", IP: "10.0.0.2"})
+	if err != nil {
+		t.Fatalf("expected other clients to be allowed, got %v", err)
+	}
+
+	clock.advance(30 * time.Second)
+	expectLimit(t, limiter.Allow(context.Background(), req), LimitIP, 30*time.Second)
+
+	clock.advance(30 * time.Second)
+	err = limiter.Allow(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected no error after refill, got %v", err)
+	}
+}
+
+func TestSMSLimiter_Allow_ShouldNotUseUpGlobalLimitWhenDenied(t *testing.T) {
+	limiter, _ := newTestSMSLimiter(SMSConfig{
+		PerDevice: Bucket{Burst: 1, Interval: time.Hour},
+		Global:    Bucket{Burst: 2, Interval: time.Hour},
+	})
+
+	err := limiter.Allow(context.Background(), SMSRequest{Msisdn: "+233200000001", DeviceID: "d1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		expectLimit(t, limiter.Allow(context.Background(), SMSRequest{Msisdn: "+233200000002", DeviceID: "d1"}), LimitDevice, time.Hour)
+	}
+
+	err = limiter.Allow(context.Background(), SMSRequest{Msisdn: "+233200000003", DeviceID: "d2"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectLimit(t, limiter.Allow(context.Background(), SMSRequest{Msisdn: "+233200000004", DeviceID: "d3"}), LimitGlobal, time.Hour)
+}
+
+func TestSMSLimiter_Allow_ShouldEnforceAllowedRegions(t *testing.T) {
+	limiter, _ := newTestSMSLimiter(SMSConfig{AllowedRegions: []string{"GH", "NG"}})
+
+	for _, msisdn := range []string{"+233200662782", "+2348031234567"} {
+		err := limiter.Allow(context.Background(), SMSRequest{Msisdn: phone.Number(msisdn)})
+		if err != nil {
+			t.Fatalf("expected %s to be allowed, got %v", msisdn, err)
+		}
+	}
+
+	for _, msisdn := range []string{"+491794491095", "+380501234567"} {
+		err := limiter.Allow(context.Background(), SMSRequest{Msisdn: phone.Number(msisdn)})
+		if err != ErrRegionNotAllowed {
+			t.Fatalf("expected %v for %s, got %v", ErrRegionNotAllowed, msisdn, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"sync"
+)
+
+// Message is an SMS message recorded by a FakeSender
+type Message struct {
+	To   string
+	Body string
+}
+
+// FakeSender is a Sender that keeps the messages it is asked to send in
+// memory. It is meant to be used in tests.
+type FakeSender struct {
+	mu       sync.Mutex
+	messages []Message
+	failures int
+	err      error
+}
+
+// NewFakeSender returns a pointer to a value of FakeSender
+func NewFakeSender() *FakeSender {
+	return &FakeSender{}
+}
+
+// FailNext makes the next n calls to Send fail with err
+func (fs *FakeSender) FailNext(n int, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.failures, fs.err = n, err
+}
+
+// Send records the message, unless it was told to fail
+func (fs *FakeSender) Send(to, body string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.failures > 0 {
+		fs.failures--
+		return fs.err
+	}
+
+	fs.messages = append(fs.messages, Message{To: to, Body: body})
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (fs *FakeSender) Messages() []Message {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return append([]Message(nil), fs.messages...)
+}
@@ -0,0 +1,30 @@
+package sms
+
+import (
+	"go.uber.org/zap"
+)
+
+// Sender sends SMS messages to phone numbers
+type Sender interface {
+	// Send delivers body to the phone number to, given in E.164 format
+	Send(to, body string) error
+}
+
+// LogSender is a Sender that writes messages to a log instead of
+// delivering them. It is meant to be used during development.
+type LogSender struct {
+	logger *zap.Logger
+}
+
+// NewLogSender returns a pointer to a value of LogSender
+func NewLogSender(logger *zap.Logger) *LogSender {
+	return &LogSender{
+		logger: logger,
+	}
+}
+
+// Send logs the message instead of sending it
+func (ls *LogSender) Send(to, body string) error {
+	ls.logger.Info("sms message", zap.String("to", to), zap.String("body", body))
+	return nil
+}
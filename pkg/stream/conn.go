@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Errors returned by Accept, before anything is written to the client
+var (
+	ErrBadHandshake       = errors.New("stream: bad websocket handshake")
+	ErrHijackNotSupported = errors.New("stream: response writer does not support hijacking")
+)
+
+// ConnConfig holds the settings of a Conn. A heartbeat is sent when no
+// event has been sent for Heartbeat, and the client is dropped when a
+// write to it does not complete within WriteTimeout.
+type ConnConfig struct {
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+}
+
+// transport writes events to a client in the format of a protocol
+type transport interface {
+	send(ev Event) error
+	heartbeat() error
+
+	// done receives the error the client went away with,
+	// or nil if it closed the connection
+	done() <-chan error
+
+	// close ends the stream, telling the client why
+	// when it supports doing so
+	close(err error) error
+}
+
+// Conn is a connection events are streamed to
+type Conn struct {
+	cfg ConnConfig
+	t   transport
+}
+
+// IsWebSocket reports whether r asks for a WebSocket
+func IsWebSocket(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Accept takes over the connection of r to stream events to its client,
+// over a WebSocket when r asks for one and as server-sent events otherwise.
+// The connection is taken from the http server, so that its read and write
+// timeouts no longer apply.
+func Accept(w http.ResponseWriter, r *http.Request, cfg ConnConfig) (*Conn, error) {
+	if IsWebSocket(r) {
+		t, err := acceptWebSocket(w, r, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &Conn{cfg: cfg, t: t}, nil
+	}
+
+	t, err := acceptSSE(w, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{cfg: cfg, t: t}, nil
+}
+
+// Stream sends the events of sub to the client until the client goes away,
+// a write fails or sub ends, and closes the connection. It returns nil when
+// the client went away.
+func (c *Conn) Stream(sub Subscription) error {
+	ticker := time.NewTicker(c.cfg.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-c.t.done():
+			c.t.close(err)
+			return err
+		case ev, ok := <-sub.Events():
+			if !ok {
+				err := sub.Err()
+				c.t.close(err)
+				return err
+			}
+
+			err := c.t.send(ev)
+			if err != nil {
+				c.t.close(nil)
+				return err
+			}
+		case <-ticker.C:
+			err := c.t.heartbeat()
+			if err != nil {
+				c.t.close(nil)
+				return err
+			}
+		}
+	}
+}
+
+func hijack(w http.ResponseWriter) (net.Conn, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, ErrHijackNotSupported
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// the server set deadlines for the request, which would end the stream
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// requests are not expected to have a body, so nothing that the client
+	// sent is lost by ignoring what the server has buffered
+	if brw.Reader.Buffered() > 0 {
+		brw.Reader.Discard(brw.Reader.Buffered())
+	}
+
+	return conn, nil
+}
+
+// writeWithTimeout writes p to conn, failing if the client
+// does not take it within timeout
+func writeWithTimeout(conn net.Conn, timeout time.Duration, p []byte) error {
+	err := conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Write(p)
+	return err
+}
@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testConnConfig = ConnConfig{Heartbeat: time.Minute, WriteTimeout: time.Second}
+
+func newStreamServer(hub *Hub, ended chan<- error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub, _ := hub.Subscribe(Filter{UserID: 7}, 0)
+		defer sub.Close()
+
+		conn, err := Accept(w, r, testConnConfig)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			ended <- err
+			return
+		}
+
+		ended <- conn.Stream(sub)
+	}))
+}
+
+func TestConn_Stream_ShouldSendServerSentEvents(t *testing.T) {
+	hub := NewHub(HubConfig{History: 10, Buffer: 10})
+	ended := make(chan error, 1)
+	server := newStreamServer(hub, ended)
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s", ct)
+	}
+
+	hub.Publish(EventAlertCreated, alertAt(42, 7, accra))
+
+	br := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if len(line) > 0 && !strings.HasPrefix(line, "retry:") {
+			lines = append(lines, line)
+		}
+	}
+
+	if !strings.HasPrefix(lines[0], "id: ") || lines[1] != "event: "+EventAlertCreated {
+		t.Fatalf("expected an alert.created event, got %q", lines)
+	}
+
+	var ev Event
+	err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &ev)
+	if err != nil || ev.Alert == nil || ev.Alert.ID != 42 {
+		t.Fatalf("expected data of alert 42, got %q (%v)", lines[2], err)
+	}
+
+	res.Body.Close()
+	select {
+	case err := <-ended:
+		if err != nil {
+			t.Fatalf("expected stream to end without error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected stream to end when the client went away")
+	}
+}
+
+func TestConn_Stream_ShouldSendWebSocketMessages(t *testing.T) {
+	hub := NewHub(HubConfig{History: 10, Buffer: 10})
+	ended := make(chan error, 1)
+	server := newStreamServer(hub, ended)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET / HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected handshake to be accepted, got %d %v", res.StatusCode, res.Header)
+	}
+
+	hub.Publish(EventAlertCreated, alertAt(42, 7, accra))
+
+	op, payload := readServerFrame(t, br)
+	var ev Event
+	if op != opText || json.Unmarshal(payload, &ev) != nil || ev.Alert.ID != 42 {
+		t.Fatalf("expected a text message with alert 42, got %x %q", op, payload)
+	}
+
+	writeClientFrame(conn, opPing, []byte("hi"))
+	op, payload = readServerFrame(t, br)
+	if op != opPong || string(payload) != "hi" {
+		t.Fatalf("expected pong echoing the ping, got %x %q", op, payload)
+	}
+
+	writeClientFrame(conn, opClose, []byte{0x03, 0xe8})
+	op, _ = readServerFrame(t, br)
+	if op != opClose {
+		t.Fatalf("expected close frame, got %x", op)
+	}
+
+	if err := <-ended; err != nil {
+		t.Fatalf("expected stream to end without error, got %v", err)
+	}
+}
+
+func TestAccept_ShouldRejectBadHandshake(t *testing.T) {
+	hub := NewHub(HubConfig{History: 10, Buffer: 10})
+	ended := make(chan error, 1)
+	server := newStreamServer(hub, ended)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	res.Body.Close()
+
+	if err := <-ended; err != ErrBadHandshake {
+		t.Fatalf("expected ErrBadHandshake, got %v", err)
+	}
+}
+
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+
+	var h [2]byte
+	if _, err := io.ReadFull(br, h[:]); err != nil {
+		t.Fatalf("expected a frame, got %v", err)
+	}
+
+	size := int(h[1] & 0x7f)
+	if size == 126 {
+		var ext [2]byte
+		io.ReadFull(br, ext[:])
+		size = int(binary.BigEndian.Uint16(ext[:]))
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("expected a payload, got %v", err)
+	}
+
+	return h[0] & 0x0f, payload
+}
+
+func writeClientFrame(w io.Writer, op byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | op, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	w.Write(frame)
+}
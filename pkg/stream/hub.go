@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// HubConfig holds the settings of a Hub. History is the number of recent
+// events kept for subscribers that resume, and Buffer the number of events
+// queued for a subscriber before it is dropped as a slow consumer.
+type HubConfig struct {
+	History int
+	Buffer  int
+}
+
+// Hub is a Broker that delivers events to subscribers in the same process.
+// Event IDs start from the time the hub was created, so that IDs issued
+// before a restart are recognized as no longer retained.
+type Hub struct {
+	cfg     HubConfig
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event
+	subs    map[*subscription]struct{}
+	now     func() time.Time
+}
+
+// NewHub returns a hub with cfg
+func NewHub(cfg HubConfig) *Hub {
+	return &Hub{
+		cfg:    cfg,
+		lastID: uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+		subs:   map[*subscription]struct{}{},
+		now:    time.Now,
+	}
+}
+
+// Publish implements Broker. Subscribers whose buffer is full are dropped
+// rather than waited for, so that a slow subscriber cannot hold up others.
+func (hub *Hub) Publish(eventType string, alert *db.Alert) {
+	a := *alert
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.lastID++
+	ev := Event{ID: hub.lastID, Type: eventType, Alert: &a, Time: hub.now()}
+
+	if hub.cfg.History > 0 {
+		if len(hub.history) == hub.cfg.History {
+			hub.history = hub.history[1:]
+		}
+		hub.history = append(hub.history, ev)
+	}
+
+	for sub := range hub.subs {
+		if !sub.filter.Match(&a) {
+			continue
+		}
+
+		select {
+		case sub.events <- ev:
+		default:
+			hub.remove(sub, ErrSlowConsumer)
+		}
+	}
+}
+
+// Subscribe implements Broker
+func (hub *Hub) Subscribe(filter Filter, lastEventID uint64) (Subscription, error) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	var replay []Event
+	if lastEventID > 0 {
+		// the events after lastEventID are only all retained when it is at
+		// most as old as the event before the oldest in history
+		if lastEventID > hub.lastID || lastEventID < hub.lastID-uint64(len(hub.history)) {
+			replay = append(replay, Event{ID: hub.lastID, Type: EventReset, Time: hub.now()})
+		} else {
+			for _, ev := range hub.history {
+				if ev.ID > lastEventID && filter.Match(ev.Alert) {
+					replay = append(replay, ev)
+				}
+			}
+		}
+	}
+
+	sub := &subscription{
+		hub:    hub,
+		filter: filter,
+		events: make(chan Event, len(replay)+hub.cfg.Buffer),
+	}
+
+	for _, ev := range replay {
+		sub.events <- ev
+	}
+
+	hub.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// remove ends sub with err. It must be called with mu held.
+func (hub *Hub) remove(sub *subscription, err error) {
+	if _, ok := hub.subs[sub]; !ok {
+		return
+	}
+
+	delete(hub.subs, sub)
+	sub.err = err
+	close(sub.events)
+}
+
+type subscription struct {
+	hub    *Hub
+	filter Filter
+	events chan Event
+	err    error
+}
+
+func (sub *subscription) Events() <-chan Event {
+	return sub.events
+}
+
+func (sub *subscription) Err() error {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+
+	return sub.err
+}
+
+func (sub *subscription) Close() {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+
+	sub.hub.remove(sub, nil)
+}
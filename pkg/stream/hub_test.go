@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+var accra = db.Coordinate{Lat: 5.6037, Lng: -0.187}
+
+func alertAt(id, userID int, c db.Coordinate) *db.Alert {
+	return &db.Alert{ID: id, UserID: userID, Coordinate: c, Status: db.AlertStatusRaised}
+}
+
+func receive(t *testing.T, sub Subscription) Event {
+	t.Helper()
+
+	select {
+	case ev, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("expected an event, subscription ended with %v", sub.Err())
+		}
+		return ev
+	default:
+		t.Fatal("expected an event, got none")
+	}
+
+	return Event{}
+}
+
+func expectNone(t *testing.T, sub Subscription) {
+	t.Helper()
+
+	select {
+	case ev := <-sub.Events():
+		t.Fatalf("expected no event, got %+v", ev)
+	default:
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	box := db.Around(accra, 1000)
+	kumasi := db.Coordinate{Lat: 6.6885, Lng: -1.6244}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		alert  *db.Alert
+		want   bool
+	}{
+		{"own alert anywhere", Filter{UserID: 7}, alertAt(1, 7, kumasi), true},
+		{"other alert without area", Filter{UserID: 7}, alertAt(1, 9, accra), false},
+		{"other alert in box", Filter{UserID: 7, Box: &box}, alertAt(1, 9, accra), true},
+		{"other alert outside box", Filter{UserID: 7, Box: &box}, alertAt(1, 9, kumasi), false},
+		{"other alert in zone", Filter{UserID: 7, Zone: &Zone{Center: accra, Radius: 500}}, alertAt(1, 9, accra), true},
+		{"other alert outside zone", Filter{UserID: 7, Zone: &Zone{Center: accra, Radius: 500}}, alertAt(1, 9, kumasi), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Match(tt.alert); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestHub_Publish_ShouldDeliverMatchingEvents(t *testing.T) {
+	hub := NewHub(HubConfig{History: 10, Buffer: 10})
+
+	sub, _ := hub.Subscribe(Filter{UserID: 7}, 0)
+	defer sub.Close()
+
+	hub.Publish(EventAlertCreated, alertAt(1, 9, accra))
+	hub.Publish(EventAlertCreated, alertAt(2, 7, accra))
+
+	ev := receive(t, sub)
+	if ev.Type != EventAlertCreated || ev.Alert.ID != 2 {
+		t.Fatalf("expected creation of alert 2, got %+v", ev)
+	}
+
+	expectNone(t, sub)
+}
+
+func TestHub_Subscribe_ShouldReplayEventsAfterLastEventID(t *testing.T) {
+	hub := NewHub(HubConfig{History: 10, Buffer: 10})
+	filter := Filter{UserID: 7}
+
+	sub, _ := hub.Subscribe(filter, 0)
+	hub.Publish(EventAlertCreated, alertAt(1, 7, accra))
+	last := receive(t, sub)
+	sub.Close()
+
+	hub.Publish(EventAlertUpdated, alertAt(1, 7, accra))
+	hub.Publish(EventAlertResolved, alertAt(1, 7, accra))
+
+	sub, _ = hub.Subscribe(filter, last.ID)
+	defer sub.Close()
+
+	for _, want := range []string{EventAlertUpdated, EventAlertResolved} {
+		ev := receive(t, sub)
+		if ev.Type != want {
+			t.Fatalf("expected %s, got %+v", want, ev)
+		}
+	}
+
+	expectNone(t, sub)
+}
+
+func TestHub_Subscribe_ShouldResetWhenEventsAreNotRetained(t *testing.T) {
+	hub := NewHub(HubConfig{History: 1, Buffer: 10})
+	filter := Filter{UserID: 7}
+
+	sub, _ := hub.Subscribe(filter, 0)
+	hub.Publish(EventAlertCreated, alertAt(1, 7, accra))
+	last := receive(t, sub)
+	sub.Close()
+
+	hub.Publish(EventAlertUpdated, alertAt(1, 7, accra))
+	hub.Publish(EventAlertResolved, alertAt(1, 7, accra))
+
+	for _, lastEventID := range []uint64{last.ID, 42} {
+		sub, _ = hub.Subscribe(filter, lastEventID)
+
+		ev := receive(t, sub)
+		if ev.Type != EventReset {
+			t.Fatalf("expected reset after event %d, got %+v", lastEventID, ev)
+		}
+
+		expectNone(t, sub)
+		sub.Close()
+	}
+}
+
+func TestHub_Publish_ShouldDropSlowConsumers(t *testing.T) {
+	hub := NewHub(HubConfig{History: 10, Buffer: 1})
+
+	slow, _ := hub.Subscribe(Filter{UserID: 7}, 0)
+	fast, _ := hub.Subscribe(Filter{UserID: 7}, 0)
+	defer fast.Close()
+
+	hub.Publish(EventAlertCreated, alertAt(1, 7, accra))
+	receive(t, fast)
+	hub.Publish(EventAlertUpdated, alertAt(1, 7, accra))
+	receive(t, fast)
+
+	receive(t, slow)
+	if _, ok := <-slow.Events(); ok {
+		t.Fatal("expected slow subscription to end")
+	}
+
+	if slow.Err() != ErrSlowConsumer {
+		t.Fatalf("expected ErrSlowConsumer, got %v", slow.Err())
+	}
+
+	// closing an ended subscription is harmless
+	slow.Close()
+}
@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// sseRetry is the delay in milliseconds clients wait before reconnecting
+const sseRetry = 3000
+
+// sse streams events as server-sent events. The response has no length
+// and is not chunked, so it ends when the connection is closed.
+type sse struct {
+	cfg  ConnConfig
+	conn net.Conn
+	gone chan error
+}
+
+func acceptSSE(w http.ResponseWriter, cfg ConnConfig) (*sse, error) {
+	conn, err := hijack(w)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sse{cfg: cfg, conn: conn, gone: make(chan error, 1)}
+
+	header := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/event-stream\r\n" +
+		"Cache-Control: no-cache\r\n" +
+		"Connection: close\r\n" +
+		"X-Accel-Buffering: no\r\n" +
+		"\r\n" +
+		fmt.Sprintf("retry: %d\n\n", sseRetry)
+
+	err = writeWithTimeout(conn, cfg.WriteTimeout, []byte(header))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// clients send nothing once the stream has started, so reading
+	// only ends when they close the connection
+	go func() {
+		_, err := io.Copy(ioutil.Discard, conn)
+		s.gone <- err
+	}()
+
+	return s, nil
+}
+
+func (s *sse) send(ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return writeWithTimeout(s.conn, s.cfg.WriteTimeout, []byte(msg))
+}
+
+func (s *sse) heartbeat() error {
+	return writeWithTimeout(s.conn, s.cfg.WriteTimeout, []byte(": heartbeat\n\n"))
+}
+
+func (s *sse) done() <-chan error {
+	return s.gone
+}
+
+// close ends the stream. Clients reconnect on their own and resume
+// from the last event they received, whatever err is.
+func (s *sse) close(err error) error {
+	return s.conn.Close()
+}
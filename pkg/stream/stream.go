@@ -0,0 +1,114 @@
+// Package stream delivers alert events to clients as they happen, over
+// WebSockets or server-sent events. Events are published to a Broker, which
+// fans them out to the subscriptions whose filter they match.
+package stream
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+)
+
+// Types of events
+const (
+	EventAlertCreated  = "alert.created"
+	EventAlertUpdated  = "alert.updated"
+	EventAlertResolved = "alert.resolved"
+
+	// EventAlertEscalated is sent when a wider circle of people
+	// is notified about an alert nobody has acknowledged
+	EventAlertEscalated = "alert.escalated"
+
+	// EventReset is sent to a subscriber resuming after an event that is no
+	// longer retained. Events may have been missed, so the subscriber should
+	// reload the alerts it follows.
+	EventReset = "stream.reset"
+)
+
+// ErrSlowConsumer ends a subscription that does not keep up with its events.
+// The subscriber can resume from the last event it received.
+var ErrSlowConsumer = errors.New("stream: subscriber is not keeping up with events")
+
+// Event is a change to an alert. IDs increase with every event published,
+// so a subscriber can resume after the last event it received.
+type Event struct {
+	ID    uint64    `json:"id"`
+	Type  string    `json:"type"`
+	Alert *db.Alert `json:"alert,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// EventFor returns the type of event published when
+// an alert is moved to status
+func EventFor(status string) string {
+	if status == db.AlertStatusResolved {
+		return EventAlertResolved
+	}
+
+	return EventAlertUpdated
+}
+
+// Zone is the area within Radius meters of Center
+type Zone struct {
+	Center db.Coordinate
+	Radius float64
+}
+
+// Filter selects the events of a subscription. Events of alerts raised by
+// UserID always match. Other alerts match when they are in the bounding box
+// and the zone, whichever are given; with neither, they never match.
+type Filter struct {
+	UserID int
+	Box    *db.BoundingBox
+	Zone   *Zone
+}
+
+// Match reports whether events of alert match f
+func (f Filter) Match(alert *db.Alert) bool {
+	if alert.UserID == f.UserID {
+		return true
+	}
+
+	if f.Box == nil && f.Zone == nil {
+		return false
+	}
+
+	if f.Box != nil && !f.Box.Contains(alert.Coordinate) {
+		return false
+	}
+
+	if f.Zone != nil && db.Distance(f.Zone.Center, alert.Coordinate) > f.Zone.Radius {
+		return false
+	}
+
+	return true
+}
+
+// Broker distributes the events of alerts to subscribers. Hub is an
+// in-process broker; a broker backed by a message queue lets several
+// instances of the service share events.
+type Broker interface {
+	// Publish sends an event of eventType for alert to the
+	// subscriptions it matches
+	Publish(eventType string, alert *db.Alert)
+
+	// Subscribe returns a subscription to the events matching filter. A
+	// non-zero lastEventID resumes after that event, replaying the events
+	// since or sending EventReset if they are not all retained.
+	Subscribe(filter Filter, lastEventID uint64) (Subscription, error)
+}
+
+// Subscription is a stream of events from a Broker
+type Subscription interface {
+	// Events returns the channel events are delivered on. It is
+	// closed when the subscription ends.
+	Events() <-chan Event
+
+	// Err returns why the subscription ended, or nil if it was
+	// closed by the subscriber
+	Err() error
+
+	// Close ends the subscription
+	Close()
+}
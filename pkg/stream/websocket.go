@@ -0,0 +1,251 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the key of a handshake to compute the
+// accept key, as defined by RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxFrameSize is the largest frame read from clients. Clients are not
+// expected to send messages, so anything larger is rejected.
+const maxFrameSize = 4096
+
+// opcodes of WebSocket frames
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+// status codes of WebSocket close frames
+const (
+	closeNormal        = 1000
+	closeProtocolError = 1002
+	closeTooBig        = 1009
+	closeTryAgainLater = 1013
+)
+
+var (
+	errProtocol = errors.New("stream: websocket protocol error")
+	errTooBig   = errors.New("stream: websocket frame too big")
+)
+
+// websocket streams events as text messages over a WebSocket. Clients
+// must answer the pings sent as heartbeats, or any other frame, within
+// two heartbeats, or they are considered gone.
+type websocket struct {
+	cfg  ConnConfig
+	conn net.Conn
+	mu   sync.Mutex
+	gone chan error
+}
+
+func acceptWebSocket(w http.ResponseWriter, r *http.Request, cfg ConnConfig) (*websocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || r.Header.Get("Sec-WebSocket-Version") != "13" || len(key) == 0 {
+		return nil, ErrBadHandshake
+	}
+
+	conn, err := hijack(w)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &websocket{cfg: cfg, conn: conn, gone: make(chan error, 1)}
+
+	header := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n" +
+		"\r\n"
+
+	err = writeWithTimeout(conn, cfg.WriteTimeout, []byte(header))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go func() {
+		ws.gone <- ws.readLoop(bufio.NewReader(conn))
+	}()
+
+	return ws, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (ws *websocket) send(ev Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return ws.writeFrame(opText, data)
+}
+
+func (ws *websocket) heartbeat() error {
+	return ws.writeFrame(opPing, nil)
+}
+
+func (ws *websocket) done() <-chan error {
+	return ws.gone
+}
+
+// close sends a close frame before closing the connection. Slow consumers
+// are asked to try again later, when they can resume where they left off.
+func (ws *websocket) close(err error) error {
+	code := closeNormal
+	switch err {
+	case ErrSlowConsumer:
+		code = closeTryAgainLater
+	case errProtocol:
+		code = closeProtocolError
+	case errTooBig:
+		code = closeTooBig
+	}
+
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	ws.writeFrame(opClose, payload)
+
+	return ws.conn.Close()
+}
+
+// readLoop reads frames from the client until it closes the connection or
+// stops responding, answering pings. Messages from the client are ignored.
+// It returns nil when the client closed the connection.
+func (ws *websocket) readLoop(br *bufio.Reader) error {
+	for {
+		err := ws.conn.SetReadDeadline(time.Now().Add(2 * ws.cfg.Heartbeat))
+		if err != nil {
+			return err
+		}
+
+		op, payload, err := readFrame(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case opPing:
+			err = ws.writeFrame(opPong, payload)
+			if err != nil {
+				return err
+			}
+		case opClose:
+			return nil
+		}
+	}
+}
+
+// readFrame reads a frame sent by a client, which must be masked
+func readFrame(br *bufio.Reader) (byte, []byte, error) {
+	var h [2]byte
+	_, err := io.ReadFull(br, h[:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fin := h[0]&0x80 != 0
+	op := h[0] & 0x0f
+	masked := h[1]&0x80 != 0
+	size := uint64(h[1] & 0x7f)
+
+	// no extensions are negotiated, so the reserved bits must be clear
+	if h[0]&0x70 != 0 || !masked {
+		return 0, nil, errProtocol
+	}
+
+	switch size {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(br, ext[:])
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(br, ext[:])
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// control frames must not be fragmented and are at most 125 bytes
+	if op >= opClose && (!fin || size > 125) {
+		return 0, nil, errProtocol
+	}
+
+	if size > maxFrameSize {
+		return 0, nil, errTooBig
+	}
+
+	frame := make([]byte, 4+size)
+	_, err = io.ReadFull(br, frame)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	mask, payload := frame[:4], frame[4:]
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return op, payload, nil
+}
+
+// writeFrame writes a single unmasked frame, as servers do
+func (ws *websocket) writeFrame(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+
+	switch size := len(payload); {
+	case size <= 125:
+		frame = append(frame, byte(size))
+	case size <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(size))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(size))
+	}
+	frame = append(frame, payload...)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return writeWithTimeout(ws.conn, ws.cfg.WriteTimeout, frame)
+}
+
+// headerContains reports whether the comma separated values
+// of the header key include value, ignoring case
+func headerContains(header http.Header, key, value string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(key)] {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,69 @@
+package twilio
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// do sends a request with form as its body to endpoint, authenticated with
+// the credentials of an account, and decodes the JSON response into out.
+// Error responses are returned as *Error values. The request is canceled
+// when ctx is done.
+func do(ctx context.Context, client *http.Client, accountSID, authToken, method, endpoint string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(accountSID, authToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		return parseError(res)
+	}
+
+	if out == nil {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func parseError(res *http.Response) error {
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	terr := &Error{}
+	if err := json.Unmarshal(data, terr); err != nil || len(terr.Message) == 0 {
+		terr.Message = strings.TrimSpace(string(data))
+		if len(terr.Message) == 0 {
+			terr.Message = res.Status
+		}
+	}
+
+	terr.Status = res.StatusCode
+	return terr
+}
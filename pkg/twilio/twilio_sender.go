@@ -0,0 +1,93 @@
+package twilio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMessagingHost is the base URL of Twilio's Programmable Messaging API
+const DefaultMessagingHost = "https://api.twilio.com"
+
+// Message is an SMS message sent with Twilio Programmable Messaging
+type Message struct {
+	SID    string `json:"sid"`
+	To     string `json:"to"`
+	From   string `json:"from"`
+	Status string `json:"status"`
+}
+
+// SenderConfig holds the credentials and settings of a TwilioSender
+type SenderConfig struct {
+	// Host is the base URL of the Messaging API. It defaults to
+	// DefaultMessagingHost.
+	Host string
+
+	AccountSID string
+	AuthToken  string
+
+	// From is the phone number or alphanumeric sender ID messages are sent
+	// from. It is ignored when MessagingServiceSID is set, in which case
+	// Twilio picks the sender from the messaging service.
+	From                string
+	MessagingServiceSID string
+}
+
+// TwilioSender sends SMS messages through Twilio's Programmable Messaging
+// API. It implements sms.Sender.
+type TwilioSender struct {
+	client              *http.Client
+	host                string
+	accountSID          string
+	authToken           string
+	from                string
+	messagingServiceSID string
+}
+
+// NewTwilioSender returns a pointer to a value of TwilioSender
+func NewTwilioSender(client *http.Client, cfg SenderConfig) *TwilioSender {
+	host := cfg.Host
+	if len(host) == 0 {
+		host = DefaultMessagingHost
+	}
+
+	return &TwilioSender{
+		client:              client,
+		host:                strings.TrimRight(host, "/"),
+		accountSID:          cfg.AccountSID,
+		authToken:           cfg.AuthToken,
+		from:                cfg.From,
+		messagingServiceSID: cfg.MessagingServiceSID,
+	}
+}
+
+// Send sends body to the phone number to
+func (ts *TwilioSender) Send(to, body string) error {
+	_, err := ts.SendMessage(to, body)
+	return err
+}
+
+// SendMessage sends body to the phone number to and returns the message
+// Twilio queued for delivery
+func (ts *TwilioSender) SendMessage(to, body string) (*Message, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	if len(ts.messagingServiceSID) > 0 {
+		form.Set("MessagingServiceSid", ts.messagingServiceSID)
+	} else {
+		form.Set("From", ts.from)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", ts.host, url.PathEscape(ts.accountSID))
+
+	msg := &Message{}
+	err := do(context.Background(), ts.client, ts.accountSID, ts.authToken, http.MethodPost, endpoint, form, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,86 @@
+package twilio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testMessagingServiceSID = "MG0123456789abcdef0123456789abcdef"
+
+func NewMockTwilioMessagingHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/2010-04-01/Accounts/"+testAccountSID+"/Messages.json", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != testAccountSID || pass != testAuthToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code": 20003, "message": "Authenticate", "status": 401}`))
+			return
+		}
+
+		if r.FormValue("To") != "+491794491095" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 21211, "message": "The 'To' number is not a valid phone number.", "status": 400}`))
+			return
+		}
+
+		if len(r.FormValue("Body")) == 0 || (len(r.FormValue("From")) == 0 && len(r.FormValue("MessagingServiceSid")) == 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": 21602, "message": "Message body is required.", "status": 400}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{
+			"sid": "SM0123456789abcdef0123456789abcdef",
+			"to": "` + r.FormValue("To") + `",
+			"from": "` + r.FormValue("From") + `",
+			"status": "queued"
+		}`))
+	})
+
+	return mux
+}
+
+func newTestSender(host string, cfg SenderConfig) *TwilioSender {
+	cfg.Host = host
+	cfg.AccountSID = testAccountSID
+	cfg.AuthToken = testAuthToken
+	return NewTwilioSender(&http.Client{Timeout: 10 * time.Second}, cfg)
+}
+
+func TestTwilioSenderSendMessage_ShouldPass(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioMessagingHandler())
+	defer srv.Close()
+
+	for _, cfg := range []SenderConfig{{From: "Hoodcops"}, {MessagingServiceSID: testMessagingServiceSID}} {
+		sender := newTestSender(srv.URL, cfg)
+		msg, err := sender.SendMessage("+491794491095", "Hello")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if msg.SID != "SM0123456789abcdef0123456789abcdef" || msg.Status != "queued" {
+			t.Fatalf("expected queued message, got %+v", msg)
+		}
+	}
+}
+
+func TestTwilioSenderSend_ShouldFail(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioMessagingHandler())
+	defer srv.Close()
+
+	sender := newTestSender(srv.URL, SenderConfig{From: "Hoodcops"})
+	err := sender.Send("+233200662782", "Hello")
+
+	terr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+
+	if terr.Status != http.StatusBadRequest || terr.Code != 21211 {
+		t.Fatalf("unexpected error %+v", terr)
+	}
+}
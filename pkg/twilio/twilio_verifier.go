@@ -1,96 +1,250 @@
 package twilio
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+
+	"github.com/hoodcops/xcore/pkg/verification"
+)
+
+// DefaultVerifyHost is the base URL of Twilio's Verify v2 API
+const DefaultVerifyHost = "https://verify.twilio.com"
+
+// Channels through which Twilio Verify can deliver verification codes
+const (
+	ChannelSMS      = "sms"
+	ChannelVoice    = "call"
+	ChannelWhatsApp = "whatsapp"
+	ChannelEmail    = "email"
+)
+
+// Statuses of a Twilio Verify verification
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusCanceled = "canceled"
+)
+
+// Twilio error codes that users can act on
+const (
+	codeNotFound             = 20404
+	codeTooManyRequests      = 20429
+	codeInvalidToNumber      = 21211
+	codeInvalidParameter     = 60200
+	codeMaxCheckAttempts     = 60202
+	codeMaxSendAttempts      = 60203
+	codeLandlineNotSupported = 60205
 )
 
-// TwilioVerifier wraps around Twilio's phone number verification APIs
-// to provide methods for sending verification codes to phone numbers
-// and for checking if users provided the correct codes received via SMS
+// Error is an error response returned by Twilio's APIs
+type Error struct {
+	Status   int    `json:"status"`
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("twilio: %s (status %d, code %d)", e.Message, e.Status, e.Code)
+}
+
+// Verification is a phone number or email verification started
+// with Twilio Verify
+type Verification struct {
+	SID     string `json:"sid"`
+	To      string `json:"to"`
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	Valid   bool   `json:"valid"`
+}
+
+// VerifierConfig holds the credentials and settings of a TwilioVerifier
+type VerifierConfig struct {
+	// Host is the base URL of the Verify API. It defaults to DefaultVerifyHost.
+	Host string
+
+	AccountSID string
+	AuthToken  string
+	ServiceSID string
+
+	// Channel is the channel SendCode delivers codes through. It defaults
+	// to ChannelSMS.
+	Channel string
+
+	Locale string
+}
+
+// TwilioVerifier wraps around Twilio's Verify v2 APIs to provide methods for
+// sending verification codes to phone numbers and for checking if users
+// provided the correct codes they received
 type TwilioVerifier struct {
-	client *http.Client
-	host   string
-	locale string
-	apiKey string
+	client     *http.Client
+	host       string
+	accountSID string
+	authToken  string
+	serviceSID string
+	channel    string
+	locale     string
 }
 
 // NewTwilioVerifier returns a pointer to a value of TwilioVerifier
-func NewTwilioVerifier(client *http.Client, host, locale, apiKey string) *TwilioVerifier {
+func NewTwilioVerifier(client *http.Client, cfg VerifierConfig) *TwilioVerifier {
+	host := cfg.Host
+	if len(host) == 0 {
+		host = DefaultVerifyHost
+	}
+
+	channel := cfg.Channel
+	if len(channel) == 0 {
+		channel = ChannelSMS
+	}
+
 	return &TwilioVerifier{
-		client: client,
-		host:   host,
-		locale: locale,
-		apiKey: apiKey,
+		client:     client,
+		host:       strings.TrimRight(host, "/"),
+		accountSID: cfg.AccountSID,
+		authToken:  cfg.AuthToken,
+		serviceSID: cfg.ServiceSID,
+		channel:    channel,
+		locale:     cfg.Locale,
 	}
 }
 
-// SendCode sends a X-digits verification code via SMS to authenticate
-// and validate the phoneNumber given by the user.
-func (tv *TwilioVerifier) SendCode(countryCode, phoneNumber string) error {
-	form := url.Values{}
-	form.Add("via", "sms")
-	form.Add("country_code", countryCode)
-	form.Add("phone_number", phoneNumber)
-	form.Add("locale", tv.locale)
-
-	endpoint := fmt.Sprintf("%s/protected/json/phones/verification/start", tv.host)
-	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+// SendCode sends a verification code to msisdn through the configured channel
+func (tv *TwilioVerifier) SendCode(ctx context.Context, msisdn string) error {
+	_, err := tv.StartVerification(ctx, msisdn, tv.channel)
 	if err != nil {
-		return err
+		return classify(err)
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("X-Authy-API-Key", tv.apiKey)
+	return nil
+}
 
-	res, err := tv.client.Do(req)
+// VerifyCode sends the user-provided verification code to Twilio to verify if
+// it is the same code they received
+func (tv *TwilioVerifier) VerifyCode(ctx context.Context, msisdn, verificationCode string) error {
+	v, err := tv.CheckVerification(ctx, msisdn, verificationCode)
 	if err != nil {
-		return err
+		return classify(err)
 	}
 
-	_, _ = io.Copy(ioutil.Discard, res.Body)
-	res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return errors.New(res.Status)
+	if v.Status != StatusApproved {
+		return verification.ErrInvalidCode
 	}
 
 	return nil
 }
 
-// VerifyCode sends the user-provided verfication code to Twilio to verify if
-// that is the same X-digits code they received via SMS
-func (tv *TwilioVerifier) VerifyCode(countryCode, phoneNumber, verificationCode string) error {
-	endpoint := fmt.Sprintf("%s/protected/json/phones/verification/check?country_code=%s&phone_number=%s&verification_code=%s",
-		tv.host,
-		countryCode,
-		phoneNumber,
-		verificationCode,
-	)
-
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+// CancelVerification cancels the verification pending for msisdn
+func (tv *TwilioVerifier) CancelVerification(ctx context.Context, msisdn string) error {
+	form := url.Values{}
+	form.Set("Status", StatusCanceled)
+
+	return tv.do(ctx, http.MethodPost, tv.verificationsEndpoint(msisdn), form, nil)
+}
+
+// VerificationStatus reports the status of the verification pending for
+// msisdn. Twilio forgets verifications once they are approved, canceled or
+// expired, so StatusNone is reported for all of those.
+func (tv *TwilioVerifier) VerificationStatus(ctx context.Context, msisdn string) (verification.Status, error) {
+	v := Verification{}
+
+	err := tv.do(ctx, http.MethodGet, tv.verificationsEndpoint(msisdn), nil, &v)
 	if err != nil {
-		return err
+		if terr, ok := err.(*Error); ok && terr.Status == http.StatusNotFound {
+			return verification.StatusNone, nil
+		}
+		return "", err
 	}
 
-	req.Header.Set("X-Authy-API-Key", tv.apiKey)
+	switch v.Status {
+	case StatusApproved:
+		return verification.StatusApproved, nil
+	case StatusCanceled:
+		return verification.StatusCanceled, nil
+	case StatusPending:
+		return verification.StatusPending, nil
+	default:
+		return verification.StatusExpired, nil
+	}
+}
 
-	res, err := tv.client.Do(req)
+// StartVerification sends a verification code to to through channel. For
+// phone channels to is an E.164 phone number, and for ChannelEmail it is an
+// email address.
+func (tv *TwilioVerifier) StartVerification(ctx context.Context, to, channel string) (*Verification, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Channel", channel)
+	if len(tv.locale) > 0 {
+		form.Set("Locale", tv.locale)
+	}
+
+	v := &Verification{}
+	err := tv.do(ctx, http.MethodPost, tv.verificationsEndpoint(""), form, v)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// CheckVerification checks code against the verification pending for to
+func (tv *TwilioVerifier) CheckVerification(ctx context.Context, to, code string) (*Verification, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Code", code)
+
+	endpoint := fmt.Sprintf("%s/v2/Services/%s/VerificationCheck", tv.host, url.PathEscape(tv.serviceSID))
+
+	v := &Verification{}
+	err := tv.do(ctx, http.MethodPost, endpoint, form, v)
+	if err != nil {
+		return nil, err
 	}
 
-	_, _ = io.Copy(ioutil.Discard, res.Body)
-	res.Body.Close()
+	return v, nil
+}
 
-	if res.StatusCode >= 400 {
-		return errors.New(res.Status)
+func (tv *TwilioVerifier) verificationsEndpoint(to string) string {
+	endpoint := fmt.Sprintf("%s/v2/Services/%s/Verifications", tv.host, url.PathEscape(tv.serviceSID))
+	if len(to) > 0 {
+		endpoint += "/" + url.PathEscape(to)
 	}
 
-	return nil
+	return endpoint
+}
+
+func (tv *TwilioVerifier) do(ctx context.Context, method, endpoint string, form url.Values, out interface{}) error {
+	return do(ctx, tv.client, tv.accountSID, tv.authToken, method, endpoint, form, out)
+}
+
+// classify converts errors returned by Twilio into verification errors
+// users can act on. Errors caused by misconfiguration are returned as is.
+func classify(err error) error {
+	terr, ok := err.(*Error)
+	if !ok {
+		if _, ok := err.(*url.Error); ok {
+			return verification.NewError(verification.KindUnavailable, "twilio is unreachable", err)
+		}
+		return err
+	}
+
+	switch {
+	case terr.Code == codeInvalidToNumber || terr.Code == codeInvalidParameter || terr.Code == codeLandlineNotSupported:
+		return verification.NewError(verification.KindInvalidPhoneNumber, "phone number cannot be verified", err)
+	case terr.Code == codeMaxCheckAttempts:
+		return verification.NewError(verification.KindTooManyAttempts, "too many incorrect verification attempts", err)
+	case terr.Code == codeMaxSendAttempts || terr.Code == codeTooManyRequests || terr.Status == http.StatusTooManyRequests:
+		return verification.NewError(verification.KindRateLimited, "too many verification codes requested", err)
+	case terr.Code == codeNotFound || terr.Status == http.StatusNotFound:
+		return verification.NewError(verification.KindExpiredCode, "no pending verification for phone number", err)
+	case terr.Status >= http.StatusInternalServerError:
+		return verification.NewError(verification.KindUnavailable, "twilio is unavailable", err)
+	default:
+		return err
+	}
 }
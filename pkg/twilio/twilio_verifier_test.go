@@ -1,83 +1,142 @@
 package twilio
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/hoodcops/xcore/pkg/verification"
+)
+
+const (
+	testAccountSID = "AC0123456789abcdef0123456789abcdef"
+	testAuthToken  = "50m3h@rd2gu355t3xt0rh@5h"
+	testServiceSID = "VA0123456789abcdef0123456789abcdef"
 )
 
 func NewMockTwilioVerificationHander(shouldFail bool) http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/protected/json/phones/verification/start", func(w http.ResponseWriter, r *http.Request) {
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != testAccountSID || pass != testAuthToken {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code": 20003, "message": "Authenticate", "more_info": "https://www.twilio.com/docs/errors/20003", "status": 401}`))
+			return false
+		}
+		return true
+	}
+
+	mux.HandleFunc("/v2/Services/"+testServiceSID+"/Verifications", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
 		if shouldFail {
-			data := `{
-				"message": "No pending verifications for +49 179-449-1095 found.",
-				"success": false,
-				"errors": {
-					"message": "No pending verifications for +49 179-449-1095 found."
-				},
-				"error_code": "60023"
-			}`
-
-			http.Error(w, data, http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{
+				"code": 60200,
+				"message": "Invalid parameter: To",
+				"more_info": "https://www.twilio.com/docs/errors/60200",
+				"status": 400
+			}`))
+			return
+		}
+
+		if r.FormValue("To") != "+491794491095" || len(r.FormValue("Channel")) == 0 {
+			http.Error(w, `{"code": 60200, "message": "Invalid parameter", "status": 400}`, http.StatusBadRequest)
 			return
 		}
-		data := `{
-				"carrier": "Telefonica (O2 Germany GmbH & Co. OHG)",
-				"is_cellphone": true,
-				"message": "Text message sent to +49 179-449-1095.",
-				"seconds_to_expire": 599,
-				"uuid": "ac5ed8e0-e5af-0136-a779-0a5b7c2a32fe",
-				"success": true
-			}`
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(data))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{
+			"sid": "VE0123456789abcdef0123456789abcdef",
+			"service_sid": "` + testServiceSID + `",
+			"to": "` + r.FormValue("To") + `",
+			"channel": "` + r.FormValue("Channel") + `",
+			"status": "pending",
+			"valid": false
+		}`))
+	})
+
+	mux.HandleFunc("/v2/Services/"+testServiceSID+"/Verifications/+491794491095", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		if shouldFail {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code": 20404, "message": "The requested resource was not found", "status": 404}`))
+			return
+		}
+
+		status := "pending"
+		if r.Method == http.MethodPost {
+			status = r.FormValue("Status")
+		}
 
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sid": "VE0123456789abcdef0123456789abcdef", "to": "+491794491095", "status": "` + status + `"}`))
 	})
 
-	mux.HandleFunc("/protected/json/phones/verification/check", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/v2/Services/"+testServiceSID+"/VerificationCheck", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
 		if shouldFail {
-			data := `{
-				"message": "No pending verifications for +49 179-449-1095 found.",
-				"success": false,
-				"errors": {
-					"message": "No pending verifications for +49 179-449-1095 found."
-				},
-				"error_code": "60023"
-			}`
-
-			http.Error(w, data, http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{
+				"code": 20404,
+				"message": "The requested resource /Services/` + testServiceSID + `/VerificationCheck was not found",
+				"more_info": "https://www.twilio.com/docs/errors/20404",
+				"status": 404
+			}`))
 			return
 		}
 
-		data := `{
-			"message": "Verification code is correct.",
-			"success": true
-		}`
+		status := "pending"
+		if r.FormValue("Code") == "4591" {
+			status = "approved"
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(data))
+		w.Write([]byte(`{
+			"sid": "VE0123456789abcdef0123456789abcdef",
+			"to": "` + r.FormValue("To") + `",
+			"channel": "sms",
+			"status": "` + status + `",
+			"valid": ` + map[bool]string{true: "true", false: "false"}[status == "approved"] + `
+		}`))
 	})
 
 	return mux
 }
 
+func newTestVerifier(host string) *TwilioVerifier {
+	cl := &http.Client{Timeout: 10 * time.Second}
+	return NewTwilioVerifier(cl, VerifierConfig{
+		Host:       host,
+		AccountSID: testAccountSID,
+		AuthToken:  testAuthToken,
+		ServiceSID: testServiceSID,
+		Locale:     "en",
+	})
+}
+
 func TestTwilioVerifierSendCode_ShouldPass(t *testing.T) {
 	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
 	defer srv.Close()
 
-	cl := &http.Client{Timeout: 10 * time.Second}
-	locale := "en"
-	apiKey := "50m3h@rd2gu355t3xt0rh@5h"
-	host := srv.URL
-
-	verifier := NewTwilioVerifier(cl, host, locale, apiKey)
-	err := verifier.SendCode("49", "179-449-1095")
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.SendCode(context.Background(), "+491794491095")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -87,46 +146,169 @@ func TestTwilioVerifierSendCode_ShouldFail(t *testing.T) {
 	srv := httptest.NewServer(NewMockTwilioVerificationHander(true))
 	defer srv.Close()
 
-	cl := &http.Client{Timeout: 10 * time.Second}
-	locale := "en"
-	apiKey := "50m3h@rd2gu355t3xt0rh@5h"
-	host := srv.URL
-
-	verifier := NewTwilioVerifier(cl, host, locale, apiKey)
-	err := verifier.SendCode("49", "179-449-1095")
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.SendCode(context.Background(), "+491794491095")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
+
+	if kind := verification.KindOf(err); kind != verification.KindInvalidPhoneNumber {
+		t.Fatalf("expected kind %s, got %s", verification.KindInvalidPhoneNumber, kind)
+	}
+
+	terr, ok := err.(*verification.Error).Cause().(*Error)
+	if !ok {
+		t.Fatalf("expected *Error cause, got %v", err)
+	}
+
+	if terr.Status != http.StatusBadRequest || terr.Code != 60200 || terr.Message != "Invalid parameter: To" {
+		t.Fatalf("unexpected error %+v", terr)
+	}
 }
 
-func TestTwilioVerifierVerifyCode_ShouldPass(t *testing.T) {
+func TestTwilioVerifierSendCode_ShouldFailWithBadCredentials(t *testing.T) {
 	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
 	defer srv.Close()
 
-	cl := &http.Client{Timeout: 10 * time.Second}
-	locale := "en"
-	apiKey := "50m3h@rd2gu355t3xt0rh@5h"
-	host := srv.URL
+	verifier := newTestVerifier(srv.URL)
+	verifier.authToken = "wr0ng"
+
+	err := verifier.SendCode(context.Background(), "+491794491095")
+	if terr, ok := err.(*Error); !ok || terr.Code != 20003 {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+}
+
+func TestTwilioVerifierStartVerification_ShouldUseChannel(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
+	defer srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	for _, channel := range []string{ChannelSMS, ChannelVoice, ChannelWhatsApp} {
+		v, err := verifier.StartVerification(context.Background(), "+491794491095", channel)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if v.Channel != channel || v.Status != StatusPending {
+			t.Fatalf("expected pending %s verification, got %+v", channel, v)
+		}
+	}
+}
 
-	verifier := NewTwilioVerifier(cl, host, locale, apiKey)
-	err := verifier.VerifyCode("49", "179-449-1095", "4591")
+func TestTwilioVerifierVerifyCode_ShouldPass(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
+	defer srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.VerifyCode(context.Background(), "+491794491095", "4591")
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
 
+func TestTwilioVerifierVerifyCode_ShouldFailForWrongCode(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
+	defer srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.VerifyCode(context.Background(), "+491794491095", "0000")
+	if err != verification.ErrInvalidCode {
+		t.Fatalf("expected %v, got %v", verification.ErrInvalidCode, err)
+	}
+}
+
 func TestTwilioVerifierVerifyCode_ShouldFail(t *testing.T) {
 	srv := httptest.NewServer(NewMockTwilioVerificationHander(true))
 	defer srv.Close()
 
-	cl := &http.Client{Timeout: 10 * time.Second}
-	locale := "en"
-	apiKey := "50m3h@rd2gu355t3xt0rh@5h"
-	host := srv.URL
-
-	verifier := NewTwilioVerifier(cl, host, locale, apiKey)
-	err := verifier.VerifyCode("49", "179-449-1095", "4591")
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.VerifyCode(context.Background(), "+491794491095", "4591")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
+
+	if kind := verification.KindOf(err); kind != verification.KindExpiredCode {
+		t.Fatalf("expected kind %s, got %s", verification.KindExpiredCode, kind)
+	}
+}
+
+func TestTwilioVerifierVerifyCode_ShouldClassifyErrors(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		kind   verification.Kind
+	}{
+		{http.StatusTooManyRequests, `{"code": 60202, "message": "Max check attempts reached", "status": 429}`, verification.KindTooManyAttempts},
+		{http.StatusTooManyRequests, `{"code": 60203, "message": "Max send attempts reached", "status": 429}`, verification.KindRateLimited},
+		{http.StatusTooManyRequests, `{"code": 20429, "message": "Too Many Requests", "status": 429}`, verification.KindRateLimited},
+		{http.StatusServiceUnavailable, `Service Unavailable`, verification.KindUnavailable},
+	}
+
+	for _, c := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+
+		verifier := newTestVerifier(srv.URL)
+		err := verifier.VerifyCode(context.Background(), "+491794491095", "4591")
+		if kind := verification.KindOf(err); kind != c.kind {
+			t.Errorf("expected kind %s for %q, got %v", c.kind, c.body, err)
+		}
+
+		srv.Close()
+	}
+}
+
+func TestTwilioVerifierSendCode_ShouldFailWhenUnreachable(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
+	srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.SendCode(context.Background(), "+491794491095")
+	if kind := verification.KindOf(err); kind != verification.KindUnavailable {
+		t.Fatalf("expected kind %s, got %v", verification.KindUnavailable, err)
+	}
+}
+
+func TestTwilioVerifierCancelVerification_ShouldPass(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
+	defer srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	err := verifier.CancelVerification(context.Background(), "+491794491095")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestTwilioVerifierVerificationStatus_ShouldPass(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(false))
+	defer srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	status, err := verifier.VerificationStatus(context.Background(), "+491794491095")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if status != verification.StatusPending {
+		t.Fatalf("expected status %s, got %s", verification.StatusPending, status)
+	}
+}
+
+func TestTwilioVerifierVerificationStatus_ShouldReportNoneWhenNotFound(t *testing.T) {
+	srv := httptest.NewServer(NewMockTwilioVerificationHander(true))
+	defer srv.Close()
+
+	verifier := newTestVerifier(srv.URL)
+	status, err := verifier.VerificationStatus(context.Background(), "+491794491095")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if status != verification.StatusNone {
+		t.Fatalf("expected status %s, got %s", verification.StatusNone, status)
+	}
 }
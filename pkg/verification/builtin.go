@@ -0,0 +1,178 @@
+package verification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hoodcops/xcore/pkg/db"
+	"github.com/hoodcops/xcore/pkg/sms"
+)
+
+// CodeStore persists the verification codes sent by a BuiltinVerifier.
+// It is implemented by *db.VerificationCodesRepo.
+type CodeStore interface {
+	Create(ctx context.Context, code *db.VerificationCode) (*db.VerificationCode, error)
+	GetLatest(ctx context.Context, msisdn string) (*db.VerificationCode, error)
+	UseAttempt(ctx context.Context, id, maxAttempts int) (bool, error)
+	MarkVerified(ctx context.Context, id int) (bool, error)
+	CancelPending(ctx context.Context, msisdn string) error
+}
+
+// BuiltinConfig holds the settings of a BuiltinVerifier
+type BuiltinConfig struct {
+	// Secret keys the hashes codes are stored under, so that stored
+	// hashes cannot be reversed by trying every possible code
+	Secret string
+
+	CodeLength  int
+	TTL         time.Duration
+	MaxAttempts int
+}
+
+// BuiltinVerifier is a Verifier that generates verification codes itself,
+// stores their hashes in a CodeStore and delivers them through an SMS sender
+type BuiltinVerifier struct {
+	store       CodeStore
+	sender      sms.Sender
+	secret      []byte
+	codeLength  int
+	ttl         time.Duration
+	maxAttempts int
+	now         func() time.Time
+}
+
+// NewBuiltinVerifier returns a pointer to a value of BuiltinVerifier
+func NewBuiltinVerifier(store CodeStore, sender sms.Sender, cfg BuiltinConfig) *BuiltinVerifier {
+	return &BuiltinVerifier{
+		store:       store,
+		sender:      sender,
+		secret:      []byte(cfg.Secret),
+		codeLength:  cfg.CodeLength,
+		ttl:         cfg.TTL,
+		maxAttempts: cfg.MaxAttempts,
+		now:         time.Now,
+	}
+}
+
+// SendCode generates a new verification code for msisdn and sends it via
+// SMS. Codes previously sent to msisdn can no longer be used.
+func (bv *BuiltinVerifier) SendCode(ctx context.Context, msisdn string) error {
+	code, err := randomDigits(bv.codeLength)
+	if err != nil {
+		return err
+	}
+
+	err = bv.store.CancelPending(ctx, msisdn)
+	if err != nil {
+		return err
+	}
+
+	_, err = bv.store.Create(ctx, &db.VerificationCode{
+		Msisdn:    msisdn,
+		CodeHash:  bv.hash(msisdn, code),
+		ExpiresAt: bv.now().Add(bv.ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = bv.sender.Send(msisdn, fmt.Sprintf("Your Hoodcops verification code is %s", code))
+	if err != nil {
+		return NewError(KindUnavailable, "failed sending verification code", err)
+	}
+
+	return nil
+}
+
+// VerifyCode checks verificationCode against the code last sent to msisdn.
+// Every check uses up one of the attempts at entering the code, whether
+// or not the code is correct, before the code is compared.
+func (bv *BuiltinVerifier) VerifyCode(ctx context.Context, msisdn, verificationCode string) error {
+	code, err := bv.store.GetLatest(ctx, msisdn)
+	if err != nil {
+		return err
+	}
+
+	if code == nil || code.VerifiedAt.Valid || code.CanceledAt.Valid {
+		return ErrNoPendingVerification
+	}
+
+	if !bv.now().Before(code.ExpiresAt) {
+		return ErrExpiredCode
+	}
+
+	ok, err := bv.store.UseAttempt(ctx, code.ID, bv.maxAttempts)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrTooManyAttempts
+	}
+
+	if !hmac.Equal([]byte(code.CodeHash), []byte(bv.hash(msisdn, verificationCode))) {
+		return ErrInvalidCode
+	}
+
+	ok, err = bv.store.MarkVerified(ctx, code.ID)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNoPendingVerification
+	}
+
+	return nil
+}
+
+// CancelVerification cancels the code pending for msisdn
+func (bv *BuiltinVerifier) CancelVerification(ctx context.Context, msisdn string) error {
+	return bv.store.CancelPending(ctx, msisdn)
+}
+
+// VerificationStatus reports the status of the code last sent to msisdn
+func (bv *BuiltinVerifier) VerificationStatus(ctx context.Context, msisdn string) (Status, error) {
+	code, err := bv.store.GetLatest(ctx, msisdn)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case code == nil:
+		return StatusNone, nil
+	case code.VerifiedAt.Valid:
+		return StatusApproved, nil
+	case code.CanceledAt.Valid:
+		return StatusCanceled, nil
+	case !bv.now().Before(code.ExpiresAt) || code.Attempts >= bv.maxAttempts:
+		return StatusExpired, nil
+	default:
+		return StatusPending, nil
+	}
+}
+
+func (bv *BuiltinVerifier) hash(msisdn, code string) string {
+	mac := hmac.New(sha256.New, bv.secret)
+	mac.Write([]byte(msisdn + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomDigits(n int) (string, error) {
+	buf := make([]byte, n)
+	for i := range buf {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		buf[i] = byte('0' + d.Int64())
+	}
+
+	return string(buf), nil
+}
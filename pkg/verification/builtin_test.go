@@ -0,0 +1,165 @@
+package verification
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingSender struct {
+	to   string
+	body string
+}
+
+func (rs *recordingSender) Send(to, body string) error {
+	rs.to, rs.body = to, body
+	return nil
+}
+
+func newTestBuiltinVerifier() (*BuiltinVerifier, *recordingSender) {
+	sender := &recordingSender{}
+	verifier := NewBuiltinVerifier(newMemoryCodeStore(), sender, BuiltinConfig{
+		Secret:      "50m3h@rd2gu355t3xt",
+		CodeLength:  6,
+		TTL:         10 * time.Minute,
+		MaxAttempts: 3,
+	})
+
+	return verifier, sender
+}
+
+func sentCode(t *testing.T, sender *recordingSender) string {
+	code := regexp.MustCompile(`\d{6}`).FindString(sender.body)
+	if len(code) == 0 {
+		t.Fatalf("expected a 6 digit code in message, got %q", sender.body)
+	}
+
+	return code
+}
+
+func TestBuiltinVerifier_VerifyCode_ShouldPass(t *testing.T) {
+	verifier, sender := newTestBuiltinVerifier()
+
+	err := verifier.SendCode(context.Background(), "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if sender.to != "+233200662782" {
+		t.Fatalf("expected code to be sent to %s, got %s", "+233200662782", sender.to)
+	}
+
+	err = verifier.VerifyCode(context.Background(), "+233200662782", sentCode(t, sender))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	status, _ := verifier.VerificationStatus(context.Background(), "+233200662782")
+	if status != StatusApproved {
+		t.Fatalf("expected status %s, got %s", StatusApproved, status)
+	}
+
+	err = verifier.VerifyCode(context.Background(), "+233200662782", sentCode(t, sender))
+	if err != ErrNoPendingVerification {
+		t.Fatalf("expected %v, got %v", ErrNoPendingVerification, err)
+	}
+}
+
+func TestBuiltinVerifier_VerifyCode_ShouldFailAfterTooManyAttempts(t *testing.T) {
+	verifier, sender := newTestBuiltinVerifier()
+
+	err := verifier.SendCode(context.Background(), "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	code := sentCode(t, sender)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := verifier.VerifyCode(context.Background(), "+233200662782", wrong); err != ErrInvalidCode {
+			t.Fatalf("expected %v, got %v", ErrInvalidCode, err)
+		}
+	}
+
+	if err := verifier.VerifyCode(context.Background(), "+233200662782", code); err != ErrTooManyAttempts {
+		t.Fatalf("expected %v, got %v", ErrTooManyAttempts, err)
+	}
+}
+
+func TestBuiltinVerifier_VerifyCode_ShouldLimitConcurrentAttempts(t *testing.T) {
+	verifier, sender := newTestBuiltinVerifier()
+
+	err := verifier.SendCode(context.Background(), "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	code := sentCode(t, sender)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- verifier.VerifyCode(context.Background(), "+233200662782", wrong)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	checked := 0
+	for err := range errs {
+		if err == ErrInvalidCode {
+			checked++
+		} else if err != ErrTooManyAttempts {
+			t.Fatalf("expected %v or %v, got %v", ErrInvalidCode, ErrTooManyAttempts, err)
+		}
+	}
+
+	if checked != 3 {
+		t.Fatalf("expected 3 codes to be checked, got %d", checked)
+	}
+}
+
+func TestBuiltinVerifier_VerifyCode_ShouldFailForExpiredCode(t *testing.T) {
+	verifier, sender := newTestBuiltinVerifier()
+
+	err := verifier.SendCode(context.Background(), "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	verifier.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if err := verifier.VerifyCode(context.Background(), "+233200662782", sentCode(t, sender)); err != ErrExpiredCode {
+		t.Fatalf("expected %v, got %v", ErrExpiredCode, err)
+	}
+}
+
+func TestBuiltinVerifier_CancelVerification_ShouldPass(t *testing.T) {
+	verifier, sender := newTestBuiltinVerifier()
+
+	err := verifier.SendCode(context.Background(), "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = verifier.CancelVerification(context.Background(), "+233200662782")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := verifier.VerifyCode(context.Background(), "+233200662782", sentCode(t, sender)); err != ErrNoPendingVerification {
+		t.Fatalf("expected %v, got %v", ErrNoPendingVerification, err)
+	}
+}
@@ -0,0 +1,125 @@
+package verification
+
+import "context"
+
+// Kind identifies the class of a verification failure, so that callers can
+// tell users what went wrong without inspecting provider specific errors
+type Kind string
+
+const (
+	// KindInvalidCode means the code entered does not match the one sent
+	KindInvalidCode Kind = "invalid_code"
+
+	// KindExpiredCode means the code sent has expired or was already used,
+	// and a new one has to be requested
+	KindExpiredCode Kind = "expired_code"
+
+	// KindTooManyAttempts means too many incorrect codes were entered
+	KindTooManyAttempts Kind = "too_many_attempts"
+
+	// KindInvalidPhoneNumber means codes cannot be sent to the phone number
+	KindInvalidPhoneNumber Kind = "invalid_phone_number"
+
+	// KindRateLimited means the provider refused to send more codes for now
+	KindRateLimited Kind = "rate_limited"
+
+	// KindUnavailable means the provider could not be reached or failed
+	KindUnavailable Kind = "unavailable"
+)
+
+// Error is a verification failure of a known kind. Err holds the underlying
+// provider error, if any.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Cause returns the underlying provider error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// NewError returns an Error of the specified kind wrapping err
+func NewError(kind Kind, message string, err error) *Error {
+	return &Error{
+		Kind:    kind,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// KindOf returns the kind of err, or an empty Kind if err is not an *Error
+func KindOf(err error) Kind {
+	if verr, ok := err.(*Error); ok {
+		return verr.Kind
+	}
+	return ""
+}
+
+var (
+	// ErrNoPendingVerification is returned when a code is checked for a phone
+	// number that no code has been sent to, or whose code was already used
+	ErrNoPendingVerification = NewError(KindExpiredCode, "no pending verification for phone number", nil)
+
+	// ErrInvalidCode is returned when the code entered does not match the one sent
+	ErrInvalidCode = NewError(KindInvalidCode, "verification code is incorrect", nil)
+
+	// ErrExpiredCode is returned when the code sent has expired
+	ErrExpiredCode = NewError(KindExpiredCode, "verification code has expired", nil)
+
+	// ErrTooManyAttempts is returned when too many incorrect codes were entered
+	ErrTooManyAttempts = NewError(KindTooManyAttempts, "too many incorrect verification attempts", nil)
+)
+
+// Verifier sends one-time verification codes to phone numbers and checks
+// the codes users enter to prove they own those numbers. Failures users can
+// act on are reported as *Error values.
+type Verifier interface {
+	// SendCode sends a verification code to msisdn, an E.164 phone number
+	SendCode(ctx context.Context, msisdn string) error
+
+	// VerifyCode checks that verificationCode is the code that was
+	// last sent to msisdn
+	VerifyCode(ctx context.Context, msisdn, verificationCode string) error
+}
+
+// Canceler is implemented by verifiers that can cancel a pending verification,
+// so that the code sent can no longer be used
+type Canceler interface {
+	CancelVerification(ctx context.Context, msisdn string) error
+}
+
+// Status is the state of the latest verification started for a phone number
+type Status string
+
+const (
+	// StatusNone means no verification was ever started for the phone number
+	StatusNone Status = "none"
+
+	// StatusPending means a code was sent and is waiting to be checked
+	StatusPending Status = "pending"
+
+	// StatusApproved means the code sent was entered correctly
+	StatusApproved Status = "approved"
+
+	// StatusCanceled means the verification was canceled
+	StatusCanceled Status = "canceled"
+
+	// StatusExpired means the code sent expired, or too many incorrect
+	// codes were entered, before the verification was approved
+	StatusExpired Status = "expired"
+)
+
+// StatusReporter is implemented by verifiers that can report the status of
+// the latest verification started for a phone number
+type StatusReporter interface {
+	VerificationStatus(ctx context.Context, msisdn string) (Status, error)
+}